@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AbortHandler announces a body of size bytes (default 1KB), sends only after
+// bytes of it (default half), waits delay and closes the connection. With
+// reset=true the connection is reset (RST) instead of closed gracefully (FIN)
+func AbortHandler(w http.ResponseWriter, r *http.Request) {
+	size := int64(1 << 10)
+	if v := r.URL.Query().Get("size"); v != "" {
+		var err error
+		if size, err = parseSize(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	after := size / 2
+	if v := r.URL.Query().Get("after"); v != "" {
+		var err error
+		if after, err = parseSize(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	delay, err := queryDuration(r, "delay", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if size < 1 || size > maxPayloadSize || after >= size {
+		http.Error(w, "size must be between 1 byte and 1GB and after smaller than size.", http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	chunk := bytes.Repeat([]byte("*"), payloadChunkSize)
+	for sent := int64(0); sent < after; {
+		n, err := w.Write(chunk[:min(int64(len(chunk)), after-sent)])
+		if err != nil {
+			return
+		}
+		sent += int64(n)
+	}
+	// the partial body must leave the server buffers before the connection is taken over
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	conn, _, err := rc.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+	}
+	if r.URL.Query().Get("reset") == "true" {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+	}
+}
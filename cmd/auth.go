@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const authTokenHeader = "X-Auth-Token"
+
+// the request headers carrying the credentials of the client, they are not
+// passed on to the targets of the outbound requests
+var credentialHeaders = []string{authTokenHeader, "Authorization", "Cookie"}
+
+// AuthToken is a token of the protected endpoints, given in the X-Auth-Token
+// header or as an Authorization Bearer token. It is allowed on the paths of
+// its scopes and the paths below them, or everywhere with the "*" scope
+type AuthToken struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
+var (
+	// tokens of the protected endpoints, none leaves them open
+	authTokens []AuthToken
+
+	authFailures = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "auth_failures_total",
+		Help:      "Requests of the protected endpoints rejected by reason: missing, invalid or forbidden.",
+	}, []string{"reason"})
+)
+
+// SetAuthTokens sets the tokens the protected endpoints require
+func SetAuthTokens(list []AuthToken) error {
+	seen := make(map[string]bool)
+	for _, t := range list {
+		if t.Token == "" {
+			return fmt.Errorf("auth token %q without token", t.Name)
+		}
+		if seen[t.Token] {
+			return fmt.Errorf("auth token %q is not unique", t.Name)
+		}
+		if len(t.Scopes) == 0 {
+			return fmt.Errorf("auth token %q without scopes", t.Name)
+		}
+		seen[t.Token] = true
+	}
+	authTokens = list
+	return nil
+}
+
+// whether the path is the scope or below it
+func pathWithin(path, scope string) bool {
+	return scope == "*" || path == scope || strings.HasPrefix(path, strings.TrimSuffix(scope, "/")+"/")
+}
+
+// whether the token is allowed on the path
+func (t AuthToken) allows(path string) bool {
+	for _, scope := range t.Scopes {
+		if pathWithin(path, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// token of the request, from X-Auth-Token or else the Authorization header
+func requestAuthToken(r *http.Request) string {
+	if token := r.Header.Get(authTokenHeader); token != "" {
+		return token
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// the token with the value, every token is compared in constant time
+func findAuthToken(value string) (AuthToken, bool) {
+	var found AuthToken
+	ok := false
+	for _, t := range authTokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(value)) == 1 {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+// TokenAuthMiddleware rejects the requests without an auth token, 401, or
+// with a token whose scopes do not cover the path, 403
+func TokenAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(authTokens) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		value := requestAuthToken(r)
+		t, ok := findAuthToken(value)
+		if !ok {
+			reason := "invalid"
+			if value == "" {
+				reason = "missing"
+			}
+			authFailures.WithLabelValues(reason).Inc()
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+			http.Error(w, "Invalid or missing auth token.", http.StatusUnauthorized)
+			return
+		}
+		if !t.allows(r.URL.Path) {
+			authFailures.WithLabelValues("forbidden").Inc()
+			http.Error(w, fmt.Sprintf("Token %s is not allowed on %s.", t.Name, r.URL.Path), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
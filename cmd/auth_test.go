@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenAuthMiddleware(t *testing.T) {
+	if err := SetAuthTokens([]AuthToken{
+		{Name: "admin", Token: "all", Scopes: []string{"*"}},
+		{Name: "respond", Token: "some", Scopes: []string{"/respond", "/kv"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetAuthTokens(nil)
+	h := TokenAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		path, header, value string
+		want                int
+	}{
+		{"/cpu", "", "", http.StatusUnauthorized},
+		{"/cpu", "X-Auth-Token", "wrong", http.StatusUnauthorized},
+		{"/cpu", "X-Auth-Token", "all", http.StatusOK},
+		{"/cpu", "Authorization", "Bearer all", http.StatusOK},
+		{"/cpu", "Authorization", "Basic all", http.StatusUnauthorized},
+		{"/cpu", "X-Auth-Token", "some", http.StatusForbidden},
+		{"/respond", "X-Auth-Token", "some", http.StatusOK},
+		{"/respond/rules", "X-Auth-Token", "some", http.StatusOK},
+		{"/respondx", "X-Auth-Token", "some", http.StatusForbidden},
+		{"/kv", "X-Auth-Token", "some", http.StatusOK},
+		{"/kv/key", "Authorization", "bearer some", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s with %s %q: got status %d, want %d", tc.path, tc.header, tc.value, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestSetAuthTokens(t *testing.T) {
+	defer SetAuthTokens(nil)
+	for _, list := range [][]AuthToken{
+		{{Name: "empty", Scopes: []string{"*"}}},
+		{{Name: "unscoped", Token: "a"}},
+		{{Name: "a", Token: "same", Scopes: []string{"*"}}, {Name: "b", Token: "same", Scopes: []string{"*"}}},
+	} {
+		if err := SetAuthTokens(list); err == nil {
+			t.Errorf("SetAuthTokens(%+v) succeeded, want an error", list)
+		}
+	}
+}
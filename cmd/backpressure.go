@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// BackpressureSettings configures the token bucket behind /backpressure
+type BackpressureSettings struct {
+	Capacity float64 `json:"capacity"`
+	Rate     float64 `json:"rate"`
+}
+
+type BackpressureResponse struct {
+	Remaining int `json:"remaining"`
+}
+
+var backpressureBucket *tokenBucket
+
+// SetBackpressure (re)creates the full token bucket behind /backpressure
+func SetBackpressure(s BackpressureSettings) {
+	backpressureBucket = newTokenBucket(s.Capacity, s.Rate)
+}
+
+// BackpressureHandler consumes a token per request. Once the bucket is drained
+// it answers with status (429 or 503) and a Retry-After header, either the
+// time until the next token or the fixed retry_after seconds, written as
+// seconds or as an HTTP date with retry_after_format=date
+func BackpressureHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := queryInt(r, "status", http.StatusTooManyRequests)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable {
+		http.Error(w, "status must be 429 or 503.", http.StatusBadRequest)
+		return
+	}
+	fixed, err := queryInt(r, "retry_after", -1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("retry_after_format")
+	if format != "" && format != "seconds" && format != "date" {
+		http.Error(w, "retry_after_format must be seconds or date.", http.StatusBadRequest)
+		return
+	}
+
+	ok, wait := backpressureBucket.take()
+	backpressureBucket.writeHeaders(w.Header(), RateLimitHeaders)
+	if !ok {
+		if fixed >= 0 {
+			wait = time.Duration(fixed) * time.Second
+		}
+		w.Header().Set("Retry-After", retryAfter(wait, format))
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	remaining, _ := backpressureBucket.state()
+	writeJSON(w, http.StatusOK, BackpressureResponse{Remaining: remaining})
+}
+
+// format a Retry-After value as whole seconds (rounded up) or as an HTTP
+// date, the wait of a bucket that never refills bounded like the headers
+func retryAfter(wait time.Duration, format string) string {
+	seconds := int64(headerSeconds(wait.Seconds()))
+	if format == "date" {
+		return Now().Add(time.Duration(seconds) * time.Second).UTC().Format(http.TimeFormat)
+	}
+	return strconv.FormatInt(seconds, 10)
+}
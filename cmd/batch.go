@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type BatchJob struct {
+	ID                 string     `json:"id"`
+	Status             string     `json:"status"`
+	TotalItems         int        `json:"total_items"`
+	ItemsPerSecond     float64    `json:"items_per_second"`
+	FailureProbability float64    `json:"failure_probability"`
+	Processed          int        `json:"processed"`
+	Failed             int        `json:"failed"`
+	Progress           float64    `json:"progress"`
+	ETA                string     `json:"eta,omitempty"`
+	Started            time.Time  `json:"started"`
+	Finished           *time.Time `json:"finished,omitempty"`
+
+	// decides the failed items, derived from the request seed when there is one
+	rng *rand.Rand
+}
+
+const (
+	batchRunning   = "running"
+	batchSucceeded = "succeeded"
+	batchFailed    = "failed"
+
+	// slowest and fastest jobs, in items per second
+	minBatchRate = 0.001
+	maxBatchRate = 10000
+	// finished jobs kept, the oldest ones are dropped beyond
+	maxFinishedBatchJobs = 100
+)
+
+var (
+	batchMu   sync.Mutex
+	batchJobs = make(map[string]*BatchJob)
+
+	batchActive = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "batch_jobs_active",
+		Help:      "Number of batch jobs running.",
+	})
+	batchCompleted = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "batch_jobs_completed_total",
+		Help:      "Batch jobs completed by final status.",
+	}, []string{"status"})
+	batchItems = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "batch_items_processed_total",
+		Help:      "Batch items processed by result.",
+	}, []string{"result"})
+	batchDuration = promauto.With(Registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "batch_job_duration_seconds",
+		Help:      "Duration of the completed batch jobs.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+)
+
+// snapshot of the job with the progress and ETA computed, the lock must be held
+func (j *BatchJob) snapshot() BatchJob {
+	s := *j
+	s.Started = Skew(j.Started)
+	if j.Finished != nil {
+		finished := Skew(*j.Finished)
+		s.Finished = &finished
+	}
+	s.Progress = float64(j.Processed) / float64(j.TotalItems) * 100
+	if j.Status == batchRunning {
+		remaining := float64(j.TotalItems-j.Processed) / j.ItemsPerSecond
+		s.ETA = Now().Add(time.Duration(remaining * float64(time.Second))).Format(time.RFC3339)
+	}
+	return s
+}
+
+// drop the oldest finished jobs beyond the ones kept, the lock must be held
+func pruneBatchJobs() {
+	var finished []*BatchJob
+	for _, j := range batchJobs {
+		if j.Finished != nil {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxFinishedBatchJobs {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool { return finished[i].Finished.Before(*finished[k].Finished) })
+	for _, j := range finished[:len(finished)-maxFinishedBatchJobs] {
+		delete(batchJobs, j.ID)
+	}
+}
+
+// process the items of the job at its rate, every item failing with its probability
+func runBatchJob(j *BatchJob) {
+	batchActive.Inc()
+	defer batchActive.Dec()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / j.ItemsPerSecond))
+	defer ticker.Stop()
+	for range ticker.C {
+		failed := j.rng.Float64() < j.FailureProbability
+
+		batchMu.Lock()
+		j.Processed++
+		if failed {
+			j.Failed++
+		}
+		done := j.Processed == j.TotalItems
+		if done {
+			now := time.Now()
+			j.Finished = &now
+			j.Status = batchSucceeded
+			if j.Failed > 0 {
+				j.Status = batchFailed
+			}
+			batchCompleted.WithLabelValues(j.Status).Inc()
+			batchDuration.Observe(now.Sub(j.Started).Seconds())
+		}
+		batchMu.Unlock()
+
+		if failed {
+			batchItems.WithLabelValues("failed").Inc()
+		} else {
+			batchItems.WithLabelValues("succeeded").Inc()
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// BatchHandler starts a batch job (POST) with items (default 100),
+// items_per_second (default 10, from 0.001 to 10000) and failure_probability (0-1,
+// default 0), or lists the jobs (GET), the last 100 finished ones included
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		batchMu.Lock()
+		jobs := []BatchJob{}
+		for _, j := range batchJobs {
+			jobs = append(jobs, j.snapshot())
+		}
+		batchMu.Unlock()
+		sort.Slice(jobs, func(i, k int) bool { return jobs[i].Started.Before(jobs[k].Started) })
+		writeJSON(w, http.StatusOK, jobs)
+		return
+	case "POST":
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	items, err := queryInt(r, "items", 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate, err := queryFloat(r, "items_per_second", 10)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	failure, err := queryFloat(r, "failure_probability", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if items < 1 || rate < minBatchRate || rate > maxBatchRate || failure < 0 || failure > 1 {
+		http.Error(w, "items must be at least 1, items_per_second between 0.001 and 10000 and failure_probability between 0 and 1.", http.StatusBadRequest)
+		return
+	}
+
+	j := &BatchJob{
+		ID:                 newID(),
+		Status:             batchRunning,
+		TotalItems:         items,
+		ItemsPerSecond:     rate,
+		FailureProbability: failure,
+		Started:            time.Now(),
+		rng:                newRand(requestRand(r).Int63()),
+	}
+	batchMu.Lock()
+	pruneBatchJobs()
+	batchJobs[j.ID] = j
+	resp := j.snapshot()
+	batchMu.Unlock()
+	go runBatchJob(j)
+
+	w.Header().Set("Location", "/batch/"+j.ID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// BatchJobHandler reports the progress of the job /batch/{id}
+func BatchJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/batch/")
+
+	batchMu.Lock()
+	j, ok := batchJobs[id]
+	var resp BatchJob
+	if ok {
+		resp = j.snapshot()
+	}
+	batchMu.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("Batch job %s not found.", id), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBatchHandlerRejectsInvalidRates(t *testing.T) {
+	for _, rate := range []string{"1e10", "0", "1e-11", "NaN", "Inf", "-Inf"} {
+		w := httptest.NewRecorder()
+		BatchHandler(w, httptest.NewRequest("POST", "/batch?items=1&items_per_second="+rate, nil))
+		if w.Code != 400 {
+			t.Errorf("items_per_second=%s: got status %d, want 400", rate, w.Code)
+		}
+	}
+}
+
+func TestPruneBatchJobs(t *testing.T) {
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	defer func() { batchJobs = make(map[string]*BatchJob) }()
+	start := time.Now()
+	for i := 0; i < maxFinishedBatchJobs+10; i++ {
+		finished := start.Add(time.Duration(i) * time.Second)
+		j := &BatchJob{ID: newID(), Finished: &finished}
+		batchJobs[j.ID] = j
+	}
+	running := &BatchJob{ID: newID(), Status: batchRunning}
+	batchJobs[running.ID] = running
+
+	pruneBatchJobs()
+	if len(batchJobs) != maxFinishedBatchJobs+1 {
+		t.Errorf("got %d jobs, want %d", len(batchJobs), maxFinishedBatchJobs+1)
+	}
+	if _, ok := batchJobs[running.ID]; !ok {
+		t.Error("the running job was pruned")
+	}
+	for _, j := range batchJobs {
+		if j.Finished != nil && j.Finished.Before(start.Add(10*time.Second)) {
+			t.Errorf("an old job finished at %v was kept", j.Finished)
+		}
+	}
+}
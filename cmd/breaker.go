@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// BreakerSettings configures the circuit breaker simulated by /breaker
+type BreakerSettings struct {
+	// consecutive failures opening the breaker
+	Threshold int `json:"threshold"`
+	// time the breaker stays open before letting a trial request through
+	Cooldown Duration `json:"cooldown"`
+}
+
+type BreakerResponse struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            string `json:"opened_at,omitempty"`
+}
+
+const (
+	breakerClosed   = "closed"
+	breakerHalfOpen = "half-open"
+	breakerOpen     = "open"
+)
+
+var (
+	breakerMu       sync.Mutex
+	breakerSettings BreakerSettings
+	breakerState    = breakerClosed
+	breakerFailures int
+	breakerOpenedAt time.Time
+	// a trial request is in progress while half-open
+	breakerTrial bool
+
+	breakerStateGauge = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "breaker_state",
+		Help:      "State of the simulated circuit breaker: 0 closed, 1 half-open, 2 open.",
+	})
+	breakerTransitions = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "breaker_transitions_total",
+		Help:      "Transitions of the simulated circuit breaker by new state.",
+	}, []string{"state"})
+)
+
+// SetBreaker configures the circuit breaker and closes it
+func SetBreaker(s BreakerSettings) {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	breakerSettings = s
+	setBreakerState(breakerClosed)
+}
+
+// setBreakerState moves the breaker to a new state, the lock must be held
+func setBreakerState(state string) {
+	if state != breakerState {
+		breakerTransitions.WithLabelValues(state).Inc()
+	}
+	breakerState = state
+	breakerTrial = false
+	switch state {
+	case breakerClosed:
+		breakerFailures = 0
+		breakerStateGauge.Set(0)
+	case breakerHalfOpen:
+		breakerStateGauge.Set(1)
+	case breakerOpen:
+		breakerOpenedAt = time.Now()
+		breakerStateGauge.Set(2)
+	}
+}
+
+// breakerAllow reports whether a request may go through, moving an open breaker
+// to half-open once the cooldown elapsed
+func breakerAllow() bool {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	if breakerState == breakerOpen && time.Since(breakerOpenedAt) >= time.Duration(breakerSettings.Cooldown) {
+		setBreakerState(breakerHalfOpen)
+	}
+	switch breakerState {
+	case breakerOpen:
+		return false
+	case breakerHalfOpen:
+		if breakerTrial {
+			return false
+		}
+		breakerTrial = true
+	}
+	return true
+}
+
+// breakerRecord updates the breaker with the outcome of an allowed request
+func breakerRecord(failed bool) {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	switch {
+	case breakerState == breakerHalfOpen && failed:
+		setBreakerState(breakerOpen)
+	case breakerState == breakerHalfOpen:
+		setBreakerState(breakerClosed)
+	case failed:
+		breakerFailures++
+		if breakerFailures >= breakerSettings.Threshold {
+			setBreakerState(breakerOpen)
+		}
+	default:
+		breakerFailures = 0
+	}
+}
+
+func breakerStatus() BreakerResponse {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	resp := BreakerResponse{State: breakerState, ConsecutiveFailures: breakerFailures}
+	if breakerState != breakerClosed {
+		resp.OpenedAt = Skew(breakerOpenedAt).Format(time.RFC3339)
+	}
+	return resp
+}
+
+// BreakerHandler goes through the simulated circuit breaker: requests with
+// ?fail=true fail with 500 and count towards opening it, while open every
+// request is rejected with 503. The state is sent in the X-Breaker-State header.
+func BreakerHandler(w http.ResponseWriter, r *http.Request) {
+	if !breakerAllow() {
+		w.Header().Set("X-Breaker-State", breakerStatus().State)
+		http.Error(w, "Circuit breaker is open.", http.StatusServiceUnavailable)
+		return
+	}
+
+	failed := r.URL.Query().Get("fail") == "true"
+	breakerRecord(failed)
+
+	status := breakerStatus()
+	w.Header().Set("X-Breaker-State", status.State)
+	if failed {
+		http.Error(w, "Injected failure.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// BreakerAdminHandler trips (POST /breaker/trip) or resets (POST /breaker/reset) the breaker
+func BreakerAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	breakerMu.Lock()
+	switch r.URL.Path {
+	case "/breaker/trip":
+		setBreakerState(breakerOpen)
+	case "/breaker/reset":
+		setBreakerState(breakerClosed)
+	default:
+		breakerMu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	breakerMu.Unlock()
+
+	status := breakerStatus()
+	w.Header().Set("X-Breaker-State", status.State)
+	writeJSON(w, http.StatusOK, status)
+}
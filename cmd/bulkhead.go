@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Bulkhead is an independent pool of concurrency slots shared by the routes
+// starting with one of Paths
+type Bulkhead struct {
+	Name          string   `json:"name"`
+	Paths         []string `json:"paths"`
+	MaxConcurrent int      `json:"max_concurrent"`
+	slots         chan struct{}
+}
+
+type BulkheadStatus struct {
+	Name          string   `json:"name"`
+	Paths         []string `json:"paths"`
+	MaxConcurrent int      `json:"max_concurrent"`
+	InUse         int      `json:"in_use"`
+}
+
+var (
+	bulkheads []*Bulkhead
+
+	bulkheadInUse = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "bulkhead_in_use",
+		Help:      "Concurrency slots in use by bulkhead.",
+	}, []string{"bulkhead"})
+	bulkheadCapacity = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "bulkhead_capacity",
+		Help:      "Concurrency slots available by bulkhead.",
+	}, []string{"bulkhead"})
+	bulkheadRejections = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "bulkhead_rejections_total",
+		Help:      "Requests rejected because their bulkhead was saturated.",
+	}, []string{"bulkhead"})
+)
+
+// SetBulkheads configures the bulkheads, they must be set before serving requests
+func SetBulkheads(bs []Bulkhead) error {
+	bulkheads = nil
+	for _, b := range bs {
+		if b.Name == "" || len(b.Paths) == 0 || b.MaxConcurrent < 1 {
+			return fmt.Errorf("invalid bulkhead %q: name, paths and max_concurrent are required", b.Name)
+		}
+		b := b
+		b.slots = make(chan struct{}, b.MaxConcurrent)
+		bulkheads = append(bulkheads, &b)
+		bulkheadCapacity.WithLabelValues(b.Name).Set(float64(b.MaxConcurrent))
+		bulkheadInUse.WithLabelValues(b.Name).Set(0)
+	}
+	return nil
+}
+
+// find the bulkhead of the first path prefix matching the request path
+func matchBulkhead(path string) *Bulkhead {
+	for _, b := range bulkheads {
+		for _, prefix := range b.Paths {
+			if strings.HasPrefix(path, prefix) {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// BulkheadMiddleware rejects with 503 the requests whose bulkhead has no free slot
+func BulkheadMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := matchBulkhead(r.URL.Path)
+		if b == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case b.slots <- struct{}{}:
+		default:
+			bulkheadRejections.WithLabelValues(b.Name).Inc()
+			http.Error(w, fmt.Sprintf("Bulkhead %s is saturated.", b.Name), http.StatusServiceUnavailable)
+			return
+		}
+		bulkheadInUse.WithLabelValues(b.Name).Inc()
+		defer func() {
+			<-b.slots
+			bulkheadInUse.WithLabelValues(b.Name).Dec()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BulkheadsHandler lists the bulkheads and their slots in use
+func BulkheadsHandler(w http.ResponseWriter, r *http.Request) {
+	status := []BulkheadStatus{}
+	for _, b := range bulkheads {
+		status = append(status, BulkheadStatus{
+			Name:          b.Name,
+			Paths:         b.Paths,
+			MaxConcurrent: b.MaxConcurrent,
+			InUse:         len(b.slots),
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
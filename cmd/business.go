@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	businessOrders = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Subsystem: "business",
+		Name:      "orders_total",
+		Help:      "Fake orders placed, increasing at a rate following a daily-like wave.",
+	})
+	businessQueueDepth = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Subsystem: "business",
+		Name:      "queue_depth",
+		Help:      "Fake queue depth following a random walk.",
+	})
+	businessPaymentErrors = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Subsystem: "business",
+		Name:      "payment_errors_total",
+		Help:      "Fake payment errors, low most of the time with occasional spikes.",
+	})
+)
+
+// StartBusinessMetrics updates the fake business metrics every second, orders
+// arrive at about ordersRate per second
+func StartBusinessMetrics(ordersRate float64) {
+	go func() {
+		start := time.Now()
+		depth := 0.0
+		var spikeUntil time.Time
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			// the order rate rises and falls over an hour, with some noise on top
+			wave := 1 + 0.5*math.Sin(2*math.Pi*now.Sub(start).Hours())
+			orders := math.Max(0, ordersRate*wave*(1+0.3*random.NormFloat64()))
+			businessOrders.Add(math.Round(orders))
+
+			depth = math.Max(0, depth+random.NormFloat64()*math.Max(1, ordersRate/5))
+			businessQueueDepth.Set(math.Round(depth))
+
+			// a spike starts about every 10 minutes and lasts 30 seconds
+			if now.After(spikeUntil) && random.Float64() < 1.0/600 {
+				spikeUntil = now.Add(30 * time.Second)
+			}
+			errorRatio := 0.01
+			if now.Before(spikeUntil) {
+				errorRatio = 0.3
+			}
+			businessPaymentErrors.Add(math.Round(orders * errorRatio * 2 * random.Float64()))
+		}
+	}()
+}
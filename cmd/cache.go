@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CacheSettings configures the cache served by /cached/{key}
+type CacheSettings struct {
+	OriginLatency Duration `json:"origin_latency"`
+	TTL           Duration `json:"ttl"`
+	// coalesce concurrent misses of a key into a single origin call
+	SingleFlight bool `json:"single_flight"`
+}
+
+type CachedResponse struct {
+	Key     string    `json:"key"`
+	Value   string    `json:"value"`
+	Cached  bool      `json:"cached"`
+	Fetched time.Time `json:"fetched"`
+	Age     string    `json:"age"`
+}
+
+type cacheEntry struct {
+	value   string
+	fetched time.Time
+}
+
+// an origin call other requests for the same key can wait for
+type originCall struct {
+	done  chan struct{}
+	entry cacheEntry
+}
+
+// entries the cache holds at most
+const maxCacheEntries = 10000
+
+var (
+	cacheSettings CacheSettings
+	cacheMu       sync.Mutex
+	cacheEntries  = make(map[string]cacheEntry)
+	cacheCalls    = make(map[string]*originCall)
+
+	cacheRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "cache_requests_total",
+		Help:      "Requests to /cached by result: hit, miss, or coalesced when waiting for another origin call.",
+	}, []string{"result"})
+	cacheOriginRequests = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "cache_origin_requests_total",
+		Help:      "Calls to the slow origin behind /cached.",
+	})
+	cacheOriginInflight = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "cache_origin_inflight",
+		Help:      "Calls to the slow origin in progress, high values during a stampede.",
+	})
+	cacheHitAge = promauto.With(Registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "cache_hit_age_seconds",
+		Help:      "Age of the cache entries served on hits.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+)
+
+// SetCache configures the cache and empties it
+func SetCache(s CacheSettings) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cacheSettings = s
+	cacheEntries = make(map[string]cacheEntry)
+}
+
+// fetchOrigin simulates the slow origin, its value changes on every call
+func fetchOrigin(key string) cacheEntry {
+	cacheOriginRequests.Inc()
+	cacheOriginInflight.Inc()
+	defer cacheOriginInflight.Dec()
+	time.Sleep(time.Duration(cacheSettings.OriginLatency))
+	now := time.Now()
+	return cacheEntry{value: fmt.Sprintf("%s@%d", key, now.UnixNano()), fetched: now}
+}
+
+// store the entry, making room when the cache is full by dropping the expired
+// entries, then random ones down to nine tenths of the capacity so that the
+// next stores do not scan again. The lock must be held
+func cacheStore(key string, e cacheEntry) {
+	if _, ok := cacheEntries[key]; !ok && len(cacheEntries) >= maxCacheEntries {
+		for k, old := range cacheEntries {
+			if time.Since(old.fetched) >= time.Duration(cacheSettings.TTL) {
+				delete(cacheEntries, k)
+			}
+		}
+		for k := range cacheEntries {
+			if len(cacheEntries) < maxCacheEntries*9/10 {
+				break
+			}
+			delete(cacheEntries, k)
+		}
+	}
+	cacheEntries[key] = e
+}
+
+// lookup the key, calling the origin on a miss
+func cacheGet(key string) (cacheEntry, string) {
+	cacheMu.Lock()
+	if e, ok := cacheEntries[key]; ok && time.Since(e.fetched) < time.Duration(cacheSettings.TTL) {
+		cacheMu.Unlock()
+		return e, "hit"
+	}
+	if !cacheSettings.SingleFlight {
+		cacheMu.Unlock()
+		e := fetchOrigin(key)
+		cacheMu.Lock()
+		cacheStore(key, e)
+		cacheMu.Unlock()
+		return e, "miss"
+	}
+
+	// wait for the origin call already in progress for this key
+	if call, ok := cacheCalls[key]; ok {
+		cacheMu.Unlock()
+		<-call.done
+		return call.entry, "coalesced"
+	}
+	call := &originCall{done: make(chan struct{})}
+	cacheCalls[key] = call
+	cacheMu.Unlock()
+
+	call.entry = fetchOrigin(key)
+	cacheMu.Lock()
+	cacheStore(key, call.entry)
+	delete(cacheCalls, key)
+	cacheMu.Unlock()
+	close(call.done)
+	return call.entry, "miss"
+}
+
+// CachedHandler serves /cached/{key} from the in-memory TTL cache, calling the
+// slow origin on misses. The X-Cache and Age headers describe the result.
+func CachedHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/cached/")
+	if key == "" {
+		http.Error(w, "Missing cache key.", http.StatusBadRequest)
+		return
+	}
+
+	entry, result := cacheGet(key)
+	cacheRequests.WithLabelValues(result).Inc()
+	age := time.Since(entry.fetched)
+	if result == "hit" {
+		cacheHitAge.Observe(age.Seconds())
+	}
+
+	w.Header().Set("X-Cache", strings.ToUpper(result))
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	writeJSON(w, http.StatusOK, CachedResponse{
+		Key:     key,
+		Value:   entry.value,
+		Cached:  result == "hit",
+		Fetched: Skew(entry.fetched),
+		Age:     age.String(),
+	})
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCacheStoreIsBounded(t *testing.T) {
+	SetCache(CacheSettings{TTL: Duration(time.Hour)})
+	defer SetCache(CacheSettings{})
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	for i := 0; i < 3*maxCacheEntries; i++ {
+		cacheStore(fmt.Sprint("key-", i), cacheEntry{fetched: time.Now()})
+		if len(cacheEntries) > maxCacheEntries {
+			t.Fatalf("the cache holds %d entries, more than %d", len(cacheEntries), maxCacheEntries)
+		}
+	}
+	if _, ok := cacheEntries[fmt.Sprint("key-", 3*maxCacheEntries-1)]; !ok {
+		t.Error("the last stored entry is missing")
+	}
+}
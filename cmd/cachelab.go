@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CacheResource is a resource of /cache/{seconds}, its revision changes on
+// POST. Served and NotModified count the requests reaching the origin, a
+// cache in between answers the others
+type CacheResource struct {
+	Resource    string    `json:"resource"`
+	Revision    int       `json:"revision"`
+	Modified    time.Time `json:"modified"`
+	Served      int       `json:"served"`
+	NotModified int       `json:"not_modified"`
+	Time        time.Time `json:"time"`
+}
+
+const (
+	// random resources are forgotten beyond this number of them
+	maxCacheResources = 10000
+	// farthest Expires from now, ten years
+	maxCacheExpires = 10 * 365 * 24 * 60 * 60
+)
+
+var (
+	cacheResourcesMu sync.Mutex
+	cacheResources   = make(map[string]*CacheResource)
+
+	cacheLabRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "cache_lab_requests_total",
+		Help:      "Requests to /cache reaching the origin by result: served, not_modified or revised.",
+	}, []string{"result"})
+)
+
+// the resource of the name, created at revision 1, the lock must be held
+func cacheResource(name string) *CacheResource {
+	res, ok := cacheResources[name]
+	if !ok {
+		if len(cacheResources) >= maxCacheResources {
+			for n := range cacheResources {
+				if len(cacheResources) < maxCacheResources*9/10 {
+					break
+				}
+				delete(cacheResources, n)
+			}
+		}
+		res = &CacheResource{Resource: name, Revision: 1, Modified: Now().Truncate(time.Second)}
+		cacheResources[name] = res
+	}
+	return res
+}
+
+// whether the conditional request matches the current revision, an empty
+// etag or zero modified time is not compared
+func cacheNotModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etag == "" {
+			return false
+		}
+		for _, m := range strings.Split(match, ",") {
+			m = strings.TrimPrefix(strings.TrimSpace(m), "W/")
+			if m == "*" || m == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.IsZero() && !modified.After(since)
+}
+
+// CacheHandler answers /cache/{seconds} with the resource (default) cacheable
+// for seconds, or the Cache-Control of control. etag=false, strong or weak
+// (default), last_modified=true, vary, age and expires (seconds from now, may
+// be negative) set the other headers. Requests matching the ETag or
+// Last-Modified are answered 304. POST bumps the revision of the resource
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/cache/"))
+	if err != nil || seconds < 0 {
+		http.Error(w, "The path must be /cache/{seconds} with seconds a non-negative integer.", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	name := q.Get("resource")
+	if name == "" {
+		name = "default"
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST":
+		cacheResourcesMu.Lock()
+		res := cacheResource(name)
+		res.Revision++
+		res.Modified = Now().Truncate(time.Second)
+		res.Time = Now()
+		revised := *res
+		cacheResourcesMu.Unlock()
+		cacheLabRequests.WithLabelValues("revised").Inc()
+		writeJSON(w, http.StatusOK, revised)
+		return
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h := w.Header()
+	if v := q.Get("expires"); v != "" {
+		expires, err := strconv.Atoi(v)
+		if err != nil || expires < -maxCacheExpires || expires > maxCacheExpires {
+			http.Error(w, fmt.Sprintf("expires must be a number of seconds between -%d and %d.", maxCacheExpires, maxCacheExpires), http.StatusBadRequest)
+			return
+		}
+		h.Set("Expires", Now().Add(time.Duration(expires)*time.Second).UTC().Format(http.TimeFormat))
+	}
+	control := q.Get("control")
+	if control == "" {
+		control = fmt.Sprintf("public, max-age=%d", seconds)
+	}
+	h.Set("Cache-Control", control)
+	if v := q.Get("vary"); v != "" {
+		h.Add("Vary", v)
+	}
+	if v := q.Get("age"); v != "" {
+		h.Set("Age", v)
+	}
+
+	cacheResourcesMu.Lock()
+	res := cacheResource(name)
+	etag := fmt.Sprintf(`W/"%s-%d"`, name, res.Revision)
+	switch q.Get("etag") {
+	case "false":
+		etag = ""
+	case "strong":
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+	// the validators the response does not carry are not compared
+	var modified time.Time
+	if q.Get("last_modified") == "true" {
+		modified = res.Modified
+	}
+	notModified := cacheNotModified(r, etag, modified)
+	if notModified {
+		res.NotModified++
+	} else {
+		res.Served++
+		res.Time = Now()
+	}
+	served := *res
+	cacheResourcesMu.Unlock()
+
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified {
+		cacheLabRequests.WithLabelValues("not_modified").Inc()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	cacheLabRequests.WithLabelValues("served").Inc()
+	writeJSON(w, http.StatusOK, served)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCacheHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	CacheHandler(rec, httptest.NewRequest("GET", "/cache/60?resource=test-etag", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag != `W/"test-etag-1"` {
+		t.Fatalf("got status %d and ETag %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/cache/60?resource=test-etag", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	CacheHandler(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("matching ETag: got status %d, want 304", rec.Code)
+	}
+
+	CacheHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/cache/60?resource=test-etag", nil))
+	rec = httptest.NewRecorder()
+	CacheHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("ETag of the previous revision: got status %d, want 200", rec.Code)
+	}
+
+	for _, expires := range []string{"soon", "-315360001", "9223372036854775807"} {
+		rec = httptest.NewRecorder()
+		CacheHandler(rec, httptest.NewRequest("GET", "/cache/60?expires="+expires, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expires=%s: got status %d, want 400", expires, rec.Code)
+		}
+	}
+}
+
+func TestCacheResourcesBounded(t *testing.T) {
+	cacheResourcesMu.Lock()
+	defer cacheResourcesMu.Unlock()
+	for i := 0; i < maxCacheResources+10; i++ {
+		cacheResource("bounded-" + strconv.Itoa(i))
+	}
+	if len(cacheResources) > maxCacheResources {
+		t.Errorf("got %d resources, want at most %d", len(cacheResources), maxCacheResources)
+	}
+}
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CallbackRetry is the retry policy of a callback: failed attempts (an error
+// or a status other than 2xx) are retried after a backoff doubling up to MaxBackoff
+type CallbackRetry struct {
+	// attempts in total, default 1
+	MaxAttempts int      `json:"max_attempts,omitempty"`
+	Backoff     Duration `json:"backoff,omitempty"`
+	MaxBackoff  Duration `json:"max_backoff,omitempty"`
+}
+
+type CallbackAttempt struct {
+	Time     time.Time `json:"time"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration Duration  `json:"duration"`
+}
+
+// Callback is a request sent to a caller supplied URL after a delay, such as a webhook
+type Callback struct {
+	ID      string            `json:"id"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Delay   Duration          `json:"delay,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// JSON document sent as the body, or Body sent as it is
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Body    string          `json:"body,omitempty"`
+	Retry   CallbackRetry   `json:"retry"`
+
+	Status   string            `json:"status"`
+	Created  time.Time         `json:"created"`
+	Attempts []CallbackAttempt `json:"attempts"`
+	NextTry  *time.Time        `json:"next_try,omitempty"`
+	Finished *time.Time        `json:"finished,omitempty"`
+
+	// correlation ID and trace context of the registering request
+	trace  http.Header
+	cancel context.CancelFunc
+}
+
+const (
+	callbackScheduled = "scheduled"
+	callbackDelivered = "delivered"
+	callbackFailed    = "failed"
+	callbackCanceled  = "canceled"
+
+	maxCallbackAttempts = 100
+)
+
+var (
+	callbackMu sync.Mutex
+	callbacks  = make(map[string]*Callback)
+
+	callbackAttempts = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "callback_attempts_total",
+		Help:      "Callback delivery attempts by result: status class (2xx, 5xx...) or error.",
+	}, []string{"result"})
+	callbacksFinished = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "callbacks_total",
+		Help:      "Callbacks finished by final status.",
+	}, []string{"status"})
+)
+
+func (c *Callback) validate() error {
+	target, err := url.Parse(c.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid url %q, expected an http or https URL", c.URL)
+	}
+	if len(c.Payload) > 0 && c.Body != "" {
+		return errors.New("payload and body are exclusive")
+	}
+	if c.Delay < 0 || c.Timeout < 0 || c.Retry.Backoff < 0 || c.Retry.MaxBackoff < 0 {
+		return errors.New("delay, timeout, backoff and max_backoff must not be negative")
+	}
+	if c.Retry.MaxAttempts < 0 || c.Retry.MaxAttempts > maxCallbackAttempts {
+		return fmt.Errorf("max_attempts must be between 1 and %d", maxCallbackAttempts)
+	}
+	return nil
+}
+
+// snapshot of the callback, the lock must be held
+func (c *Callback) snapshot() Callback {
+	s := *c
+	s.Created = Skew(c.Created)
+	s.Attempts = make([]CallbackAttempt, len(c.Attempts))
+	for i, a := range c.Attempts {
+		a.Time = Skew(a.Time)
+		s.Attempts[i] = a
+	}
+	if c.NextTry != nil {
+		next := Skew(*c.NextTry)
+		s.NextTry = &next
+	}
+	if c.Finished != nil {
+		finished := Skew(*c.Finished)
+		s.Finished = &finished
+	}
+	return s
+}
+
+// deliver the callback, retrying the failed attempts, until it succeeds,
+// runs out of attempts or is canceled
+func runCallback(ctx context.Context, c *Callback) {
+	wait := time.Duration(c.Delay)
+	backoff := time.Duration(c.Retry.Backoff)
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		a := sendCallback(ctx, c, attempt)
+		if ctx.Err() != nil {
+			return
+		}
+		callbackMu.Lock()
+		c.Attempts = append(c.Attempts, a)
+		done := a.Error == "" && a.Status >= 200 && a.Status < 300
+		if done || attempt >= c.Retry.MaxAttempts {
+			now := time.Now()
+			c.Finished, c.NextTry = &now, nil
+			c.Status = callbackFailed
+			if done {
+				c.Status = callbackDelivered
+			}
+			callbacksFinished.WithLabelValues(c.Status).Inc()
+			callbackMu.Unlock()
+			return
+		}
+		wait = backoff
+		next := time.Now().Add(wait)
+		c.NextTry = &next
+		callbackMu.Unlock()
+
+		backoff *= 2
+		if c.Retry.MaxBackoff > 0 {
+			backoff = min(backoff, time.Duration(c.Retry.MaxBackoff))
+		}
+	}
+}
+
+func sendCallback(ctx context.Context, c *Callback, attempt int) (a CallbackAttempt) {
+	body := []byte(c.Body)
+	if len(c.Payload) > 0 {
+		body = c.Payload
+	}
+	a.Time = time.Now()
+	defer func() { a.Duration = Duration(time.Since(a.Time)) }()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.Timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, c.Method, c.URL, bytes.NewReader(body))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	for key, values := range c.trace {
+		req.Header[key] = values
+	}
+	if len(c.Payload) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range c.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("X-Dummybox-Callback-ID", c.ID)
+	req.Header.Set("X-Dummybox-Attempt", strconv.Itoa(attempt))
+
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		a.Error = err.Error()
+		callbackAttempts.WithLabelValues("error").Inc()
+		return a
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	a.Status = resp.StatusCode
+	callbackAttempts.WithLabelValues(fmt.Sprintf("%dxx", resp.StatusCode/100)).Inc()
+	return a
+}
+
+// CallbackHandler registers a callback (POST) with a JSON body such as
+// {"url": "http://consumer/hook", "delay": "5s", "payload": {...},
+// "retry": {"max_attempts": 5, "backoff": "1s"}}, or lists all of them (GET)
+func CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		callbackMu.Lock()
+		list := []Callback{}
+		for _, c := range callbacks {
+			list = append(list, c.snapshot())
+		}
+		callbackMu.Unlock()
+		sort.Slice(list, func(i, k int) bool { return list[i].Created.Before(list[k].Created) })
+		writeJSON(w, http.StatusOK, list)
+		return
+	case "POST":
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c := &Callback{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if c.Method == "" {
+		c.Method = "POST"
+	}
+	if c.Timeout == 0 {
+		c.Timeout = Duration(10 * time.Second)
+	}
+	c.Retry.MaxAttempts = max(1, c.Retry.MaxAttempts)
+	if c.Retry.Backoff == 0 {
+		c.Retry.Backoff = Duration(time.Second)
+	}
+	c.ID = newID()
+	c.Status = callbackScheduled
+	c.Created = time.Now()
+	c.Attempts = []CallbackAttempt{}
+	next := c.Created.Add(time.Duration(c.Delay))
+	c.NextTry = &next
+	c.trace = http.Header{}
+	propagate(r, c.trace)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	callbackMu.Lock()
+	callbacks[c.ID] = c
+	resp := c.snapshot()
+	callbackMu.Unlock()
+	go runCallback(ctx, c)
+
+	w.Header().Set("Location", "/callback/"+c.ID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// CallbackJobHandler reports (GET) or cancels (DELETE) the callback /callback/{id}
+func CallbackJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/callback/")
+
+	callbackMu.Lock()
+	defer callbackMu.Unlock()
+	c, ok := callbacks[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Callback %s not found.", id), http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		if c.Status == callbackScheduled {
+			c.cancel()
+			now := time.Now()
+			c.Status, c.Finished, c.NextTry = callbackCanceled, &now, nil
+			callbacksFinished.WithLabelValues(c.Status).Inc()
+		}
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.snapshot())
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendCallbackTimeout(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Dummybox-Attempt") == "1" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer target.Close()
+
+	c := &Callback{ID: "test", Method: "POST", URL: target.URL, Timeout: Duration(50 * time.Millisecond)}
+	if a := sendCallback(context.Background(), c, 1); a.Error == "" {
+		t.Errorf("got %+v, want the attempt to time out", a)
+	}
+	if a := sendCallback(context.Background(), c, 2); a.Error != "" || a.Status != http.StatusOK {
+		t.Errorf("got %+v, want a 200", a)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CanaryRule switches the behavior of requests carrying Header with Value:
+// the response is delayed and reports Version instead of the real one
+type CanaryRule struct {
+	Header  string   `json:"header"`
+	Value   string   `json:"value"`
+	Delay   Duration `json:"delay,omitempty"`
+	Version string   `json:"version,omitempty"`
+}
+
+type versionKey struct{}
+
+var (
+	canaryMu    sync.RWMutex
+	canaryRules []CanaryRule
+
+	variantDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "variant_request_duration_seconds",
+		Help:      "Duration of the requests by reported version, to compare canary and baseline behavior.",
+	}, []string{"version"})
+)
+
+// SetCanaryRules replaces the active canary rules, every rule needs a header
+// and a value
+func SetCanaryRules(rules []CanaryRule) error {
+	for _, rule := range rules {
+		if rule.Header == "" || rule.Value == "" {
+			return errors.New("every canary rule needs a header and a value")
+		}
+	}
+	canaryMu.Lock()
+	defer canaryMu.Unlock()
+	canaryRules = rules
+	return nil
+}
+
+func matchCanaryRule(r *http.Request) (CanaryRule, bool) {
+	canaryMu.RLock()
+	defer canaryMu.RUnlock()
+	for _, rule := range canaryRules {
+		if values := r.Header.Values(rule.Header); len(values) > 0 && values[0] == rule.Value {
+			return rule, true
+		}
+	}
+	return CanaryRule{}, false
+}
+
+// requestVersion is the version reported to the client, which a canary rule may override
+func requestVersion(r *http.Request) string {
+	if v, ok := r.Context().Value(versionKey{}).(string); ok {
+		return v
+	}
+	return Version
+}
+
+// CanaryMiddleware applies the first canary rule matching the request headers
+func CanaryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		version := Version
+
+		if rule, ok := matchCanaryRule(r); ok {
+			if rule.Version != "" {
+				version = rule.Version
+				w.Header().Set("X-Dummybox-Version", version)
+				r = r.WithContext(context.WithValue(r.Context(), versionKey{}, version))
+			}
+			select {
+			case <-time.After(time.Duration(rule.Delay)):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+		variantDuration.WithLabelValues(version).Observe(time.Since(start).Seconds())
+	})
+}
+
+// CanaryHandler lists (GET), replaces (POST) or removes (DELETE) the canary rules
+func CanaryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var rules []CanaryRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := SetCanaryRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		SetCanaryRules(nil)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	canaryMu.RLock()
+	defer canaryMu.RUnlock()
+	writeJSON(w, http.StatusOK, canaryRules)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetCanaryRulesNeedsValue(t *testing.T) {
+	if err := SetCanaryRules([]CanaryRule{{Header: "X-Canary"}}); err == nil {
+		t.Error("a rule without value was accepted")
+	}
+	if err := SetCanaryRules([]CanaryRule{{Header: "X-Canary", Value: "true"}}); err != nil {
+		t.Errorf("a valid rule was rejected: %v", err)
+	}
+	defer SetCanaryRules(nil)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := matchCanaryRule(r); ok {
+		t.Error("a request without the header matched")
+	}
+	r.Header.Set("X-Canary", "true")
+	if _, ok := matchCanaryRule(r); !ok {
+		t.Error("a request with the header did not match")
+	}
+}
+
+func TestCanaryDelayCancelled(t *testing.T) {
+	if err := SetCanaryRules([]CanaryRule{{Header: "X-Canary", Value: "slow", Delay: Duration(time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCanaryRules(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	req.Header.Set("X-Canary", "slow")
+	served := false
+	done := make(chan struct{})
+	go func() {
+		CanaryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = true })).ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delay went on after the request was cancelled")
+	}
+	if served {
+		t.Error("the cancelled request was served")
+	}
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clock ticks per second of the /proc times, fixed on Linux
+const clockTicks = 100
+
+// number of CPUs the container may use: the cgroup quota when there is one,
+// otherwise all the CPUs of the machine
+func availableCPUs() float64 {
+	cpus := float64(runtime.NumCPU())
+	// cgroup v2
+	if b, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) == 2 && fields[0] != "max" {
+			quota, err1 := strconv.ParseFloat(fields[0], 64)
+			period, err2 := strconv.ParseFloat(fields[1], 64)
+			if err1 == nil && err2 == nil && period > 0 {
+				return min(cpus, quota/period)
+			}
+		}
+		return cpus
+	}
+	// cgroup v1
+	quota, err1 := readCgroupFloat("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	period, err2 := readCgroupFloat("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+		return min(cpus, quota/period)
+	}
+	return cpus
+}
+
+func readCgroupFloat(path string) (float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+}
+
+// CPU time (user and system) used by the process so far, from /proc/self/stat
+func processCPUTime() (time.Duration, error) {
+	b, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces, the fields start after its closing parenthesis
+	i := strings.LastIndexByte(string(b), ')')
+	if i < 0 {
+		return 0, errors.New("invalid /proc/self/stat")
+	}
+	// utime and stime are the 14th and 15th fields, the state (3rd) is the first one after the name
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 13 {
+		return 0, errors.New("invalid /proc/self/stat")
+	}
+	utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+	stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, errors.New("invalid /proc/self/stat")
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
+
+// cgroupRoot is where the cgroup of the container is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+type CPULimits struct {
+	// CPUs allowed by the quota, absent without quota
+	QuotaCores *float64 `json:"quota_cores,omitempty"`
+	Period     Duration `json:"period,omitempty"`
+	// relative weight against the other cgroups, cpu.shares in v1 and cpu.weight in v2
+	Shares           int64    `json:"shares,omitempty"`
+	Weight           int64    `json:"weight,omitempty"`
+	Periods          int64    `json:"periods"`
+	ThrottledPeriods int64    `json:"throttled_periods"`
+	ThrottledTime    Duration `json:"throttled_time"`
+}
+
+type MemoryLimits struct {
+	// bytes, absent without limit
+	Limit *int64 `json:"limit,omitempty"`
+	Usage int64  `json:"usage"`
+	Peak  int64  `json:"peak,omitempty"`
+	// times the limit was reached and the OOM killer ran, v2 only
+	OOMEvents int64 `json:"oom_events"`
+	OOMKills  int64 `json:"oom_kills"`
+}
+
+type PidsLimits struct {
+	Max     *int64 `json:"max,omitempty"`
+	Current int64  `json:"current"`
+}
+
+type LimitsResponse struct {
+	// cgroup version, v1 or v2, empty when no cgroup is mounted
+	Cgroup        string       `json:"cgroup"`
+	AvailableCPUs float64      `json:"available_cpus"`
+	CPU           CPULimits    `json:"cpu"`
+	Memory        MemoryLimits `json:"memory"`
+	Pids          PidsLimits   `json:"pids"`
+}
+
+// read an integer cgroup file, "max" and the v1 "unlimited" values are nil
+func readCgroupLimit(path string) *int64 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	// v1 writes no limit as the largest page aligned int64
+	if err != nil || n < 0 || n >= 1<<62 {
+		return nil
+	}
+	return &n
+}
+
+func readCgroupInt(path string) int64 {
+	if n := readCgroupLimit(path); n != nil {
+		return *n
+	}
+	return 0
+}
+
+// read a flat keyed file such as cpu.stat or memory.events
+func readCgroupStats(path string) map[string]int64 {
+	stats := make(map[string]int64)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return stats
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			stats[fields[0]] = n
+		}
+	}
+	return stats
+}
+
+func cgroupV2Limits() LimitsResponse {
+	l := LimitsResponse{Cgroup: "v2"}
+	if b, err := os.ReadFile(cgroupRoot + "/cpu.max"); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) == 2 {
+			period, _ := strconv.ParseFloat(fields[1], 64)
+			l.CPU.Period = Duration(time.Duration(period) * time.Microsecond)
+			if quota, err := strconv.ParseFloat(fields[0], 64); err == nil && period > 0 {
+				cores := quota / period
+				l.CPU.QuotaCores = &cores
+			}
+		}
+	}
+	l.CPU.Weight = readCgroupInt(cgroupRoot + "/cpu.weight")
+	cpuStat := readCgroupStats(cgroupRoot + "/cpu.stat")
+	l.CPU.Periods = cpuStat["nr_periods"]
+	l.CPU.ThrottledPeriods = cpuStat["nr_throttled"]
+	l.CPU.ThrottledTime = Duration(time.Duration(cpuStat["throttled_usec"]) * time.Microsecond)
+
+	l.Memory.Limit = readCgroupLimit(cgroupRoot + "/memory.max")
+	l.Memory.Usage = readCgroupInt(cgroupRoot + "/memory.current")
+	l.Memory.Peak = readCgroupInt(cgroupRoot + "/memory.peak")
+	events := readCgroupStats(cgroupRoot + "/memory.events")
+	l.Memory.OOMEvents = events["oom"]
+	l.Memory.OOMKills = events["oom_kill"]
+
+	l.Pids.Max = readCgroupLimit(cgroupRoot + "/pids.max")
+	l.Pids.Current = readCgroupInt(cgroupRoot + "/pids.current")
+	return l
+}
+
+func cgroupV1Limits() LimitsResponse {
+	l := LimitsResponse{Cgroup: "v1"}
+	period := readCgroupInt(cgroupRoot + "/cpu/cpu.cfs_period_us")
+	l.CPU.Period = Duration(time.Duration(period) * time.Microsecond)
+	if quota := readCgroupLimit(cgroupRoot + "/cpu/cpu.cfs_quota_us"); quota != nil && period > 0 {
+		cores := float64(*quota) / float64(period)
+		l.CPU.QuotaCores = &cores
+	}
+	l.CPU.Shares = readCgroupInt(cgroupRoot + "/cpu/cpu.shares")
+	cpuStat := readCgroupStats(cgroupRoot + "/cpu/cpu.stat")
+	l.CPU.Periods = cpuStat["nr_periods"]
+	l.CPU.ThrottledPeriods = cpuStat["nr_throttled"]
+	l.CPU.ThrottledTime = Duration(cpuStat["throttled_time"])
+
+	l.Memory.Limit = readCgroupLimit(cgroupRoot + "/memory/memory.limit_in_bytes")
+	l.Memory.Usage = readCgroupInt(cgroupRoot + "/memory/memory.usage_in_bytes")
+	l.Memory.Peak = readCgroupInt(cgroupRoot + "/memory/memory.max_usage_in_bytes")
+	l.Memory.OOMKills = readCgroupStats(cgroupRoot + "/memory/memory.oom_control")["oom_kill"]
+
+	l.Pids.Max = readCgroupLimit(cgroupRoot + "/pids/pids.max")
+	l.Pids.Current = readCgroupInt(cgroupRoot + "/pids/pids.current")
+	return l
+}
+
+// LimitsHandler reports the CPU, memory and process limits of the container
+// read from its cgroup, with the current usage, throttling and OOM kills
+func LimitsHandler(w http.ResponseWriter, r *http.Request) {
+	var l LimitsResponse
+	if _, err := os.Stat(cgroupRoot + "/cgroup.controllers"); err == nil {
+		l = cgroupV2Limits()
+	} else if _, err := os.Stat(cgroupRoot + "/memory"); err == nil {
+		l = cgroupV1Limits()
+	}
+	l.AvailableCPUs = availableCPUs()
+	writeJSON(w, http.StatusOK, l)
+}
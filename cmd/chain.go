@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChainRequest lists the downstream services called by /chain
+type ChainRequest struct {
+	URLs []string `json:"urls"`
+	// call the URLs at the same time instead of one after the other
+	Parallel bool `json:"parallel,omitempty"`
+	// method of every call, GET when empty
+	Method string `json:"method,omitempty"`
+	// time limit of every call, 10s when empty
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+type ChainCall struct {
+	URL      string   `json:"url"`
+	Status   int      `json:"status,omitempty"`
+	Duration Duration `json:"duration"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type ChainResponse struct {
+	CorrelationID string      `json:"correlation_id"`
+	Parallel      bool        `json:"parallel"`
+	Passed        bool        `json:"passed"`
+	Duration      Duration    `json:"duration"`
+	Calls         []ChainCall `json:"calls"`
+}
+
+// largest number of downstream URLs of a chain
+const maxChainURLs = 100
+
+func chainCall(r *http.Request, method, url string, timeout time.Duration) (call ChainCall) {
+	call.URL = url
+	start := time.Now()
+	defer func() { call.Duration = Duration(time.Since(start)) }()
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		call.Error = err.Error()
+		return call
+	}
+	propagate(r, req.Header)
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		call.Error = err.Error()
+		return call
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	call.Status = resp.StatusCode
+	return call
+}
+
+// ChainHandler calls the downstream URLs of the JSON body one after the other
+// or in parallel, passing the correlation ID and trace context along, and reports the status and
+// latency of every call. It answers 502 when a call fails or gets a status of
+// 400 or more
+func ChainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ChainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) == 0 || len(req.URLs) > maxChainURLs {
+		http.Error(w, fmt.Sprintf("urls must list between 1 and %d URLs.", maxChainURLs), http.StatusBadRequest)
+		return
+	}
+	for _, url := range req.URLs {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			http.Error(w, fmt.Sprintf("%q is not an http or https URL.", url), http.StatusBadRequest)
+			return
+		}
+	}
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = "GET"
+	}
+	timeout := time.Duration(req.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	resp := ChainResponse{CorrelationID: correlationID(r), Parallel: req.Parallel, Passed: true, Calls: make([]ChainCall, len(req.URLs))}
+	start := time.Now()
+	if req.Parallel {
+		var wg sync.WaitGroup
+		for i, url := range req.URLs {
+			i, url := i, url
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp.Calls[i] = chainCall(r, method, url, timeout)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i, url := range req.URLs {
+			resp.Calls[i] = chainCall(r, method, url, timeout)
+		}
+	}
+	resp.Duration = Duration(time.Since(start))
+
+	for _, call := range resp.Calls {
+		if call.Error != "" || call.Status >= 400 {
+			resp.Passed = false
+		}
+	}
+	status := http.StatusOK
+	if !resp.Passed {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChainCallTimeout(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer target.Close()
+
+	r := httptest.NewRequest("POST", "/chain", nil)
+	if call := chainCall(r, "GET", target.URL+"/slow", 50*time.Millisecond); call.Error == "" {
+		t.Errorf("got %+v, want the call to time out", call)
+	}
+	if call := chainCall(r, "GET", target.URL+"/fast", 50*time.Millisecond); call.Error != "" || call.Status != http.StatusOK {
+		t.Errorf("got %+v, want a 200", call)
+	}
+}
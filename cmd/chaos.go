@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Chaos injects latency and errors into a share of the requests on every route
+type Chaos struct {
+	// percentage (0-100) of the requests affected
+	Percent float64 `json:"percent"`
+	// latency added to the affected requests
+	Latency Duration `json:"latency,omitempty"`
+	// spread of the added latency around its value
+	Jitter Duration `json:"jitter,omitempty"`
+	// distribution of the jitter: uniform (default), normal or exponential
+	Distribution string `json:"distribution,omitempty"`
+	// percentage (0-100) of the affected requests answered with an error
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// codes of the errors with their weights, 500 when empty
+	ErrorCodes []WeightedCode `json:"error_codes,omitempty"`
+	// path prefixes never affected, besides /chaos and /scenario
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+const chaosPath = "/chaos"
+
+var (
+	chaosMu sync.RWMutex
+	chaos   Chaos
+
+	chaosInjected = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "chaos_injected_total",
+		Help:      "Faults injected by the chaos middleware by type.",
+	}, []string{"type"})
+)
+
+func (c Chaos) validate() error {
+	if c.Percent < 0 || c.Percent > 100 || c.ErrorRate < 0 || c.ErrorRate > 100 {
+		return errors.New("percent and error_rate must be between 0 and 100")
+	}
+	if c.Latency < 0 || c.Jitter < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	switch c.Distribution {
+	case "", "uniform", "normal", "exponential":
+	default:
+		return fmt.Errorf("invalid distribution %q, expected uniform, normal or exponential", c.Distribution)
+	}
+	for _, code := range c.ErrorCodes {
+		if code.Code < 200 || code.Code > 599 || code.Weight < 1 || code.Weight > maxCodeWeight {
+			return fmt.Errorf("error code %d must be between 200 and 599 with a weight between 1 and %d", code.Code, maxCodeWeight)
+		}
+	}
+	return nil
+}
+
+// draw the latency added to an affected request
+func (c Chaos) delay(rng *rand.Rand) time.Duration {
+	var jitter float64
+	switch c.Distribution {
+	case "normal":
+		jitter = rng.NormFloat64()
+	case "exponential":
+		jitter = rng.ExpFloat64()
+	default:
+		jitter = 2*rng.Float64() - 1
+	}
+	return max(0, time.Duration(c.Latency)+time.Duration(jitter*float64(c.Jitter)))
+}
+
+func (c Chaos) excludes(path string) bool {
+	// the faults must not lock out the endpoints removing them
+	if path == chaosPath || path == scenarioPath {
+		return true
+	}
+	for _, prefix := range c.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChaosMiddleware injects the configured latency and errors into a share of the requests
+func ChaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chaosMu.RLock()
+		c := chaos
+		chaosMu.RUnlock()
+
+		rng := requestRand(r)
+		if c.Percent <= 0 || c.excludes(r.URL.Path) || rng.Float64()*100 >= c.Percent {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.Latency > 0 || c.Jitter > 0 {
+			chaosInjected.WithLabelValues("latency").Inc()
+			select {
+			case <-time.After(c.delay(rng)):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if c.ErrorRate > 0 && rng.Float64()*100 < c.ErrorRate {
+			chaosInjected.WithLabelValues("error").Inc()
+			code := http.StatusInternalServerError
+			if len(c.ErrorCodes) > 0 {
+				code = pickCode(rng, c.ErrorCodes)
+			}
+			http.Error(w, "Error injected by chaos.", code)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ChaosHandler shows (GET), sets (POST) or removes (DELETE) the faults injected on every route
+func ChaosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var c Chaos
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chaosMu.Lock()
+		chaos = c
+		chaosMu.Unlock()
+	case "DELETE":
+		chaosMu.Lock()
+		chaos = Chaos{}
+		chaosMu.Unlock()
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chaosMu.RLock()
+	defer chaosMu.RUnlock()
+	writeJSON(w, http.StatusOK, chaos)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+)
+
+// ClockSettings skews every timestamp dummybox writes: logs, Date and
+// Retry-After headers, JSON responses and server-sent events
+type ClockSettings struct {
+	// constant offset added to the real time
+	Offset Duration `json:"offset"`
+	// additional offset gained every hour since the start
+	Drift Duration `json:"drift"`
+}
+
+var (
+	clock      ClockSettings
+	clockStart = time.Now()
+)
+
+// SetClock configures the clock skew, the drift starts accumulating now
+func SetClock(s ClockSettings) {
+	clock = s
+	clockStart = time.Now()
+}
+
+// Skew converts a real time into the skewed time written in logs and responses
+func Skew(t time.Time) time.Time {
+	drift := time.Duration(float64(clock.Drift) * t.Sub(clockStart).Hours())
+	return t.Add(time.Duration(clock.Offset) + drift)
+}
+
+// Now is the skewed current time
+func Now() time.Time {
+	return Skew(time.Now())
+}
+
+// ClockMiddleware writes the skewed time in the Date header when a skew is configured
+func ClockMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clock.Offset != 0 || clock.Drift != 0 {
+			w.Header().Set("Date", Now().UTC().Format(http.TimeFormat))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CompressionSettings compresses the response bodies of at least MinSize
+// bytes with the first of the Encodings (gzip or deflate) the client
+// accepts. No encoding disables it
+type CompressionSettings struct {
+	Encodings []string `json:"encodings"`
+	MinSize   string   `json:"min_size"`
+}
+
+// an encoder flushing the bytes compressed so far
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+var (
+	compression        CompressionSettings
+	compressionMinSize int64
+
+	compressedResponses = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "compressed_responses_total",
+		Help:      "Responses compressed by the compression middleware by encoding.",
+	}, []string{"encoding"})
+)
+
+// SetCompression configures the compression middleware
+func SetCompression(s CompressionSettings) error {
+	for i, e := range s.Encodings {
+		s.Encodings[i] = strings.ToLower(e)
+		// the br writer frames the body without making it smaller
+		if s.Encodings[i] != "gzip" && s.Encodings[i] != "deflate" {
+			return fmt.Errorf("invalid compression encoding %q, expected gzip or deflate", e)
+		}
+	}
+	minSize := int64(0)
+	if s.MinSize != "" {
+		var err error
+		if minSize, err = parseSize(s.MinSize); err != nil {
+			return fmt.Errorf("invalid compression min size: %w", err)
+		}
+	}
+	compression, compressionMinSize = s, minSize
+	return nil
+}
+
+// encoder of the content coding writing to w, nil for an unknown one
+func newCompressor(encoding string, w io.Writer) compressor {
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w)
+	case "deflate":
+		// the deflate content coding is the zlib format
+		return zlib.NewWriter(w)
+	case "br":
+		return &brotliWriter{w: w}
+	}
+	return nil
+}
+
+// the first of the offered encodings with the highest quality in the
+// Accept-Encoding header, empty when the client accepts none of them
+func negotiateEncoding(header string, offered []string) string {
+	qualities := map[string]float64{}
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, e := range offered {
+		q, ok := qualities[e]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds the body back until it reaches the minimum size, then
+// compresses it. Smaller bodies, and the ones flushed before, are sent as is
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	enc      compressor
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	h := cw.Header()
+	switch length, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); {
+	case code == http.StatusNoContent || code == http.StatusNotModified || h.Get("Content-Encoding") != "":
+		cw.decide(false)
+	case err == nil:
+		cw.decide(length >= compressionMinSize)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.WriteHeader(http.StatusOK)
+		}
+		if !cw.decided {
+			cw.buf = append(cw.buf, p...)
+			if int64(len(cw.buf)) >= compressionMinSize {
+				if err := cw.decide(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(p), nil
+		}
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// send the header, compressed or not, and the body held back so far
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if compress && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		// the compressed body is not the same bytes anymore
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = newCompressor(cw.encoding, cw.ResponseWriter)
+		compressedResponses.WithLabelValues(cw.encoding).Inc()
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.hijacked = true
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.NewResponseController access to the wrapped writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// send what is still held back and end the compressed body
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided && cw.status != 0 {
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+	}
+}
+
+// CompressionMiddleware compresses the response bodies for the clients
+// accepting one of the compression encodings, unless compress=none is in the
+// query. Range requests and upgrades are left alone
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(compression.Encodings) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), compression.Encodings)
+		if encoding == "" || r.URL.Query().Get("compress") == "none" ||
+			r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		next.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
+
+// compressReader reads src compressed with an encoding, compressing it as it
+// is read
+type compressReader struct {
+	src   io.Reader
+	enc   compressor
+	buf   bytes.Buffer
+	chunk []byte
+	done  bool
+}
+
+func newCompressReader(encoding string, src io.Reader) *compressReader {
+	cr := &compressReader{src: src, chunk: make([]byte, payloadChunkSize)}
+	cr.enc = newCompressor(encoding, &cr.buf)
+	return cr
+}
+
+func (cr *compressReader) Read(p []byte) (int, error) {
+	for cr.buf.Len() == 0 && !cr.done {
+		n, err := cr.src.Read(cr.chunk)
+		// the writes to the buffer do not fail
+		cr.enc.Write(cr.chunk[:n])
+		if err == io.EOF {
+			cr.enc.Close()
+			cr.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if cr.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return cr.buf.Read(p)
+}
+
+// CompressedHandler answers with a payload compressed with encoding (gzip,
+// deflate or br) whatever the Accept-Encoding of the client, taking the size
+// and content parameters of /payload for the uncompressed body. The
+// conditional requests are answered from its ETag and Last-Modified, a single
+// range of the compressed body is served at the cost of compressing it twice
+func CompressedHandler(w http.ResponseWriter, r *http.Request) {
+	encoding := r.URL.Query().Get("encoding")
+	if encoding == "" {
+		encoding = "gzip"
+	}
+	if !slices.Contains([]string{"gzip", "deflate", "br"}, encoding) {
+		http.Error(w, "encoding must be gzip, deflate or br.", http.StatusBadRequest)
+		return
+	}
+	size, content, err := payloadParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	seed := requestRand(r).Int63()
+	compressed := func(offset int64) io.Reader {
+		cr := newCompressReader(encoding, payloadReader(content, size, 0, seed))
+		io.CopyN(io.Discard, cr, offset)
+		return cr
+	}
+	h := w.Header()
+	h.Set("Content-Type", payloadContentTypes[content])
+	h.Set("Content-Encoding", encoding)
+	h.Set("X-Uncompressed-Length", strconv.FormatInt(size, 10))
+	etag := fmt.Sprintf(`"%s-%s-%d"`, encoding, content, size)
+	if content == "random" {
+		etag = fmt.Sprintf(`"%s-%s-%d-%x"`, encoding, content, size, seed)
+	}
+	h.Set("ETag", etag)
+
+	// the length of the compressed body is only known once compressed, only
+	// the range requests pay for it
+	limitRanges(r, 1)
+	if r.Header.Get("Range") != "" {
+		length, _ := io.Copy(io.Discard, compressed(0))
+		http.ServeContent(w, r, "", payloadModified, &payloadSeeker{open: compressed, size: length})
+		return
+	}
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Last-Modified", payloadModified.UTC().Format(http.TimeFormat))
+	if cacheNotModified(r, etag, payloadModified) {
+		h.Del("Content-Type")
+		h.Del("Content-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	io.Copy(w, compressed(0))
+}
+
+// brotliWriter writes the brotli format with uncompressed meta-blocks only:
+// every decoder reads it, without making the body any smaller
+type brotliWriter struct {
+	w       io.Writer
+	started bool
+	buf     []byte
+}
+
+// bytes of an uncompressed meta-block with a 16 bits length
+const brotliBlockSize = 1 << 16
+
+func (bw *brotliWriter) Write(p []byte) (int, error) {
+	bw.buf = append(bw.buf, p...)
+	for len(bw.buf) >= brotliBlockSize {
+		if err := bw.block(bw.buf[:brotliBlockSize]); err != nil {
+			return 0, err
+		}
+		bw.buf = bw.buf[brotliBlockSize:]
+	}
+	return len(p), nil
+}
+
+// write p as an uncompressed meta-block, the bits are packed from the lowest
+func (bw *brotliWriter) block(p []byte) error {
+	var bits uint32
+	offset := 0
+	if !bw.started {
+		// the stream header, a 0 bit for a 64KB window
+		offset, bw.started = 1, true
+	}
+	// ISLAST 0 and MNIBBLES 0 for a 4 nibbles length, then MLEN-1 and
+	// ISUNCOMPRESSED 1, padded to the byte
+	bits |= uint32(len(p)-1) << (offset + 3)
+	bits |= 1 << (offset + 19)
+	if _, err := bw.w.Write([]byte{byte(bits), byte(bits >> 8), byte(bits >> 16)}); err != nil {
+		return err
+	}
+	_, err := bw.w.Write(p)
+	return err
+}
+
+func (bw *brotliWriter) Flush() error {
+	if len(bw.buf) == 0 {
+		return nil
+	}
+	err := bw.block(bw.buf)
+	bw.buf = nil
+	return err
+}
+
+// Close writes the last, empty, meta-block
+func (bw *brotliWriter) Close() error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	last := byte(0b11) // ISLAST and ISLASTEMPTY
+	if !bw.started {
+		last <<= 1
+	}
+	_, err := bw.w.Write([]byte{last})
+	return err
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"br", "gzip"}
+	for _, tc := range []struct{ header, want string }{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"identity", ""},
+	} {
+		if got := negotiateEncoding(tc.header, offered); got != tc.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestSetCompressionRejectsBrotli(t *testing.T) {
+	defer SetCompression(CompressionSettings{})
+	if err := SetCompression(CompressionSettings{Encodings: []string{"gzip", "br"}}); err == nil {
+		t.Error("br accepted by the compression middleware")
+	}
+	if err := SetCompression(CompressionSettings{Encodings: []string{"GZIP", "deflate"}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	if err := SetCompression(CompressionSettings{Encodings: []string{"gzip"}, MinSize: "100"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCompression(CompressionSettings{})
+
+	body := bytes.Repeat([]byte("a"), 1000)
+	h := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body[:len(r.URL.Query().Get("n"))*100])
+	}))
+	for _, tc := range []struct {
+		query, accept, ranges string
+		compressed            bool
+	}{
+		{"n=nnnnn", "gzip", "", true},
+		{"n=", "gzip", "", false},
+		{"n=nnnnn", "br", "", false},
+		{"n=nnnnn&compress=none", "gzip", "", false},
+		{"n=nnnnn", "gzip", "bytes=0-1", false},
+	} {
+		req := httptest.NewRequest("GET", "/?"+tc.query, nil)
+		req.Header.Set("Accept-Encoding", tc.accept)
+		if tc.ranges != "" {
+			req.Header.Set("Range", tc.ranges)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tc.compressed {
+			t.Errorf("%s, %s, %s: compressed %v, want %v", tc.query, tc.accept, tc.ranges, got, tc.compressed)
+			continue
+		}
+		if tc.compressed {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := io.ReadAll(zr); len(got) != 500 {
+				t.Errorf("%s: decompressed %d bytes, want 500", tc.query, len(got))
+			}
+		}
+	}
+}
+
+func TestCompressedHandlerRangeAndConditional(t *testing.T) {
+	rec := httptest.NewRecorder()
+	CompressedHandler(rec, httptest.NewRequest("GET", "/compressed?size=10KB&content=lorem", nil))
+	whole := rec.Body.Bytes()
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got status %d and ETag %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/compressed?size=10KB&content=lorem", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	rec = httptest.NewRecorder()
+	CompressedHandler(rec, req)
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), whole[10:20]) {
+		t.Errorf("range: got status %d and %q, want 206 and %q", rec.Code, rec.Body, whole[10:20])
+	}
+
+	req = httptest.NewRequest("GET", "/compressed?size=10KB&content=lorem", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	CompressedHandler(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("matching ETag: got status %d with %d bytes, want 304", rec.Code, rec.Body.Len())
+	}
+}
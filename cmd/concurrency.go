@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ConcurrencySettings limits the requests served at the same time to
+// MaxInFlight, the next QueueSize ones wait up to QueueTimeout for a slot.
+// A zero MaxInFlight disables it
+type ConcurrencySettings struct {
+	MaxInFlight  int      `json:"max_in_flight"`
+	QueueSize    int      `json:"queue_size"`
+	QueueTimeout Duration `json:"queue_timeout"`
+	Exclude      []string `json:"exclude"`
+}
+
+var (
+	concurrency     ConcurrencySettings
+	concurrentSlots chan struct{}
+	waitingSlots    chan struct{}
+
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "concurrency_in_flight",
+		Help:      "Requests holding a slot of the concurrency limit.",
+	}, func() float64 { return float64(len(concurrentSlots)) })
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "concurrency_queued",
+		Help:      "Requests waiting for a slot of the concurrency limit.",
+	}, func() float64 { return float64(len(waitingSlots)) })
+	concurrencyQueueTime = promauto.With(Registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "concurrency_queue_seconds",
+		Help:      "Time requests waited for a slot of the concurrency limit, rejected ones included.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+	concurrencyRejections = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "concurrency_rejections_total",
+		Help:      "Requests rejected by the concurrency limit by reason: queue_full or queue_timeout.",
+	}, []string{"reason"})
+)
+
+// SetConcurrencyLimit configures the concurrency limit, it must be set
+// before serving requests
+func SetConcurrencyLimit(s ConcurrencySettings) {
+	concurrency = s
+	if s.MaxInFlight > 0 {
+		concurrentSlots = make(chan struct{}, s.MaxInFlight)
+		waitingSlots = make(chan struct{}, s.QueueSize)
+	}
+}
+
+// ConcurrencyLimitMiddleware serves at most MaxInFlight requests at the same
+// time. The next ones wait in the queue and are rejected with 503 when the
+// queue is full or their wait exceeds the queue timeout
+func ConcurrencyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if concurrency.MaxInFlight == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range concurrency.Exclude {
+			if pathWithin(r.URL.Path, p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		select {
+		case concurrentSlots <- struct{}{}:
+			concurrencyQueueTime.Observe(0)
+		default:
+			if !waitForSlot(w, r) {
+				return
+			}
+		}
+		defer func() { <-concurrentSlots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// queue the request until a slot is free, answering 503 when it cannot
+func waitForSlot(w http.ResponseWriter, r *http.Request) bool {
+	select {
+	case waitingSlots <- struct{}{}:
+	default:
+		concurrencyRejections.WithLabelValues("queue_full").Inc()
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many requests in flight, the queue is full.", http.StatusServiceUnavailable)
+		return false
+	}
+	defer func() { <-waitingSlots }()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if concurrency.QueueTimeout > 0 {
+		timer := time.NewTimer(time.Duration(concurrency.QueueTimeout))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case concurrentSlots <- struct{}{}:
+		concurrencyQueueTime.Observe(time.Since(start).Seconds())
+		return true
+	case <-timeout:
+		concurrencyQueueTime.Observe(time.Since(start).Seconds())
+		concurrencyRejections.WithLabelValues("queue_timeout").Inc()
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many requests in flight, no slot freed within the queue timeout.", http.StatusServiceUnavailable)
+		return false
+	case <-r.Context().Done():
+		// the client gave up, nobody reads the answer
+		concurrencyQueueTime.Observe(time.Since(start).Seconds())
+		return false
+	}
+}
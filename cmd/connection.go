@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ConnectionSettings controls how long client connections are kept alive
+type ConnectionSettings struct {
+	// answer every request with Connection: close
+	ForceClose bool `json:"force_close"`
+	// close the connection after this many requests, 0 means unlimited
+	MaxRequestsPerConn int `json:"max_requests_per_conn"`
+	// probability (0-1) of closing a keep-alive connection as soon as it becomes idle
+	IdleCloseRatio float64 `json:"idle_close_ratio"`
+}
+
+type connRequestsKey struct{}
+
+var (
+	Connections ConnectionSettings
+
+	connectionsClosed = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "connections_closed_total",
+		Help:      "Connections closed on purpose by the connection lifecycle controls.",
+	}, []string{"reason"})
+)
+
+// ConnContext attaches a request counter to every new connection, it is used
+// as http.Server.ConnContext
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey{}, new(atomic.Int64))
+}
+
+// ConnState randomly closes connections becoming idle, it is used as http.Server.ConnState
+func ConnState(c net.Conn, state http.ConnState) {
+	if state == http.StateIdle && Connections.IdleCloseRatio > 0 && random.Float64() < Connections.IdleCloseRatio {
+		connectionsClosed.WithLabelValues("idle").Inc()
+		c.Close()
+	}
+}
+
+// ConnectionMiddleware asks the server to close the connection after the
+// response when forced or when the connection served too many requests
+func ConnectionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Connections.ForceClose {
+			connectionsClosed.WithLabelValues("forced").Inc()
+			w.Header().Set("Connection", "close")
+		} else if Connections.MaxRequestsPerConn > 0 {
+			requests, ok := r.Context().Value(connRequestsKey{}).(*atomic.Int64)
+			if ok && requests.Add(1) >= int64(Connections.MaxRequestsPerConn) {
+				connectionsClosed.WithLabelValues("max_requests").Inc()
+				w.Header().Set("Connection", "close")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type RequestCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type CookiesResponse struct {
+	Cookies []RequestCookie `json:"cookies"`
+	// the Cookie header as received
+	Header string `json:"header,omitempty"`
+}
+
+type SetCookiesResponse struct {
+	// the Set-Cookie headers sent
+	SetCookie []string `json:"set_cookie"`
+}
+
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// CookiesHandler echoes the cookies of the request, duplicates included
+func CookiesHandler(w http.ResponseWriter, r *http.Request) {
+	resp := CookiesResponse{Cookies: []RequestCookie{}, Header: strings.Join(r.Header.Values("Cookie"), "; ")}
+	for _, c := range r.Cookies() {
+		resp.Cookies = append(resp.Cookies, RequestCookie{Name: c.Name, Value: c.Value})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// cookie attributes from the query parameters: domain, path (default /),
+// max_age in seconds, expires (RFC 3339), secure, http_only and same_site
+func cookieAttributes(r *http.Request) (http.Cookie, error) {
+	q := r.URL.Query()
+	c := http.Cookie{Domain: q.Get("domain"), Path: q.Get("path")}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	var err error
+	if c.MaxAge, err = queryInt(r, "max_age", 0); err != nil {
+		return c, err
+	}
+	if v := q.Get("expires"); v != "" {
+		if c.Expires, err = time.Parse(time.RFC3339, v); err != nil {
+			return c, fmt.Errorf("invalid expires: %q is not an RFC 3339 time", v)
+		}
+	}
+	c.Secure = q.Get("secure") == "true"
+	c.HttpOnly = q.Get("http_only") == "true"
+	if v := q.Get("same_site"); v != "" {
+		mode, ok := sameSiteModes[strings.ToLower(v)]
+		if !ok {
+			return c, fmt.Errorf("invalid same_site %q, expected lax, strict or none", v)
+		}
+		c.SameSite = mode
+	}
+	return c, nil
+}
+
+// CookiesSetHandler sets the cookies given as repeated cookie=name=value
+// parameters, with the attributes of cookieAttributes
+func CookiesSetHandler(w http.ResponseWriter, r *http.Request) {
+	attrs, err := cookieAttributes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pairs := r.URL.Query()["cookie"]
+	if len(pairs) == 0 {
+		http.Error(w, "Expected at least one cookie=name=value parameter.", http.StatusBadRequest)
+		return
+	}
+
+	resp := SetCookiesResponse{}
+	for _, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		c := attrs
+		c.Name, c.Value = name, value
+		if err := c.Valid(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp.SetCookie = append(resp.SetCookie, c.String())
+	}
+	for _, header := range resp.SetCookie {
+		w.Header().Add("Set-Cookie", header)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CookiesDeleteHandler expires the cookies given as repeated name parameters,
+// domain and path must match the ones they were set with
+func CookiesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Query()["name"]
+	if len(names) == 0 {
+		http.Error(w, "Expected at least one name parameter.", http.StatusBadRequest)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = "/"
+	}
+
+	resp := SetCookiesResponse{}
+	for _, name := range names {
+		c := http.Cookie{Name: name, Domain: r.URL.Query().Get("domain"), Path: path, MaxAge: -1, Expires: time.Unix(0, 0)}
+		if err := c.Valid(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp.SetCookie = append(resp.SetCookie, c.String())
+	}
+	for _, header := range resp.SetCookie {
+		w.Header().Add("Set-Cookie", header)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
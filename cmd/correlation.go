@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	correlationIDHeader = "X-Correlation-ID"
+	// W3C trace context, and its draft response counterpart carrying the span of dummybox
+	traceparentHeader   = "traceparent"
+	traceresponseHeader = "traceresponse"
+)
+
+type correlationIDKey struct{}
+
+type traceContextKey struct{}
+
+// traceContext is the trace a request belongs to, received as W3C traceparent
+// or B3 headers, with the span dummybox opens for the request
+type traceContext struct {
+	// w3c, b3 (single header) or b3multi, the format of the received headers
+	// and of the propagated ones
+	Format  string
+	TraceID string
+	// span of the caller, the parent of SpanID
+	ParentID string
+	SpanID   string
+	Sampled  bool
+}
+
+// CorrelationIDMiddleware reuses the correlation ID sent by the client or
+// generates a new one, and returns it in the response headers. It also
+// recognizes the W3C traceparent and B3 headers, opens a span for the request
+// and returns it in the traceresponse header
+func CorrelationIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlationIDHeader)
+		tc, traced := parseTraceContext(r.Header)
+		if id == "" && traced {
+			id = tc.TraceID
+		}
+		if id == "" {
+			id = newID()
+		}
+		w.Header().Set(correlationIDHeader, id)
+		ctx := context.WithValue(r.Context(), correlationIDKey{}, id)
+		if traced {
+			w.Header().Set(traceresponseHeader, tc.traceparent())
+			ctx = context.WithValue(ctx, traceContextKey{}, tc)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// correlationID of the request, empty when the middleware did not run
+func correlationID(r *http.Request) string {
+	id, _ := r.Context().Value(correlationIDKey{}).(string)
+	return id
+}
+
+// parseTraceContext reads the traceparent, b3 or X-B3-* headers, in that order
+func parseTraceContext(h http.Header) (traceContext, bool) {
+	if v := h.Get(traceparentHeader); v != "" {
+		parts := strings.Split(v, "-")
+		if len(parts) >= 4 && len(parts[0]) == 2 && parts[0] != "ff" && isTraceID(parts[1], 32) && isTraceID(parts[2], 16) && isHex(parts[3], 2) {
+			return newTraceContext("w3c", parts[1], parts[2], parts[3][1]&1 == 1), true
+		}
+	}
+	if v := h.Get("b3"); v != "" {
+		// traceid-spanid[-sampled[-parentspanid]]
+		parts := strings.Split(v, "-")
+		if len(parts) >= 2 && (isTraceID(parts[0], 16) || isTraceID(parts[0], 32)) && isTraceID(parts[1], 16) {
+			sampled := len(parts) < 3 || parts[2] == "1" || parts[2] == "d"
+			return newTraceContext("b3", parts[0], parts[1], sampled), true
+		}
+	}
+	traceID, spanID := h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId")
+	if (isTraceID(traceID, 16) || isTraceID(traceID, 32)) && isTraceID(spanID, 16) {
+		sampled := h.Get("X-B3-Sampled") != "0" || h.Get("X-B3-Flags") == "1"
+		return newTraceContext("b3multi", traceID, spanID, sampled), true
+	}
+	return traceContext{}, false
+}
+
+// open a span of the trace, child of the caller span
+func newTraceContext(format, traceID, parentID string, sampled bool) traceContext {
+	span := make([]byte, 8)
+	rand.Read(span)
+	return traceContext{Format: format, TraceID: strings.ToLower(traceID), ParentID: strings.ToLower(parentID), SpanID: hex.EncodeToString(span), Sampled: sampled}
+}
+
+// trace context of the request, false when it carried none
+func requestTraceContext(r *http.Request) (traceContext, bool) {
+	tc, ok := r.Context().Value(traceContextKey{}).(traceContext)
+	return tc, ok
+}
+
+// W3C header value with the span of dummybox
+func (tc traceContext) traceparent() string {
+	flags := "00"
+	if tc.Sampled {
+		flags = "01"
+	}
+	// 64 bit B3 trace IDs are left padded to the 128 bits of W3C
+	return "00-" + fmt.Sprintf("%032s", tc.TraceID) + "-" + tc.SpanID + "-" + flags
+}
+
+// propagate sets the correlation ID and the trace context of the request in
+// the headers of an outbound request, so the span of dummybox is its parent
+func propagate(r *http.Request, h http.Header) {
+	if id := correlationID(r); id != "" {
+		h.Set(correlationIDHeader, id)
+	}
+	tc, ok := requestTraceContext(r)
+	if !ok {
+		return
+	}
+	sampled := "0"
+	if tc.Sampled {
+		sampled = "1"
+	}
+	switch tc.Format {
+	case "w3c":
+		h.Set(traceparentHeader, tc.traceparent())
+	case "b3":
+		h.Set("b3", tc.TraceID+"-"+tc.SpanID+"-"+sampled+"-"+tc.ParentID)
+	case "b3multi":
+		h.Del("X-B3-Flags")
+		h.Set("X-B3-TraceId", tc.TraceID)
+		h.Set("X-B3-SpanId", tc.SpanID)
+		h.Set("X-B3-ParentSpanId", tc.ParentID)
+		h.Set("X-B3-Sampled", sampled)
+	}
+}
+
+// logAttrs identify the request in the log lines, from the response headers
+// set by CorrelationIDMiddleware so that outer middlewares can use them too
+func logAttrs(h http.Header) []any {
+	attrs := []any{"correlation_id", h.Get(correlationIDHeader)}
+	parts := strings.Split(h.Get(traceresponseHeader), "-")
+	if len(parts) == 4 {
+		attrs = append(attrs, "trace_id", parts[1], "span_id", parts[2])
+	}
+	return attrs
+}
+
+// ExemplarLabels link a metric observation to the request, from the response
+// headers set by CorrelationIDMiddleware. The correlation ID is left out when
+// it is not valid UTF-8 or does not fit in the 128 runes allowed to exemplar
+// labels
+func ExemplarLabels(h http.Header) prometheus.Labels {
+	labels := prometheus.Labels{}
+	size := 0
+	if parts := strings.Split(h.Get(traceresponseHeader), "-"); len(parts) == 4 {
+		labels["trace_id"], labels["span_id"] = parts[1], parts[2]
+		size = len("trace_id") + len(parts[1]) + len("span_id") + len(parts[2])
+	}
+	if id := h.Get(correlationIDHeader); id != "" && utf8.ValidString(id) &&
+		size+len("correlation_id")+utf8.RuneCountInString(id) <= 128 {
+		labels["correlation_id"] = id
+	}
+	return labels
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// valid trace or span ID of n hex digits, never all zeros
+func isTraceID(s string, n int) bool {
+	return isHex(s, n) && strings.Trim(s, "0") != ""
+}
+
+// random 128 bit identifier in hex
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExemplarLabels(t *testing.T) {
+	traceresponse := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	for _, tc := range []struct {
+		id   string
+		kept bool
+	}{
+		{"abc", true},
+		{strings.Repeat("é", 128-len("trace_id")-32-len("span_id")-16-len("correlation_id")), true},
+		{strings.Repeat("é", 128-len("trace_id")-32-len("span_id")-16-len("correlation_id")+1), false},
+		{"bad\xff", false},
+	} {
+		h := http.Header{}
+		h.Set(traceresponseHeader, traceresponse)
+		h.Set(correlationIDHeader, tc.id)
+		labels := ExemplarLabels(h)
+		if _, ok := labels["correlation_id"]; ok != tc.kept {
+			t.Errorf("correlation ID %q: kept %v, want %v", tc.id, ok, tc.kept)
+		}
+		// an exemplar the client library refuses panics
+		prometheus.NewCounter(prometheus.CounterOpts{Name: "test"}).(prometheus.ExemplarAdder).AddWithExemplar(1, labels)
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CORSSettings configures the cross-origin requests the browsers may send.
+// An origin is exact, * for any or *.example.com for the subdomains. Without
+// headers the ones a preflight asks for are allowed. No origin disables CORS
+type CORSSettings struct {
+	Origins       []string `json:"origins"`
+	Methods       []string `json:"methods"`
+	Headers       []string `json:"headers"`
+	ExposeHeaders []string `json:"expose_headers"`
+	Credentials   bool     `json:"credentials"`
+	MaxAge        Duration `json:"max_age"`
+}
+
+// CORSPage is the /cors test page, calling Target from the browser
+type CORSPage struct {
+	Target string
+	CORS   CORSSettings
+}
+
+var (
+	corsSettings CORSSettings
+	corsPage     = parsePage("cors")
+
+	corsPreflights = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "cors_preflights_total",
+		Help:      "CORS preflight requests by result: allowed or rejected.",
+	}, []string{"result"})
+)
+
+// SetCORS configures the CORS middleware
+func SetCORS(s CORSSettings) {
+	for i, m := range s.Methods {
+		s.Methods[i] = strings.ToUpper(m)
+	}
+	corsSettings = s
+}
+
+// whether the origin is one of the allowed origins
+func corsOriginAllowed(origin string) bool {
+	for _, allowed := range corsSettings.Origins {
+		switch {
+		case allowed == "*", strings.EqualFold(allowed, origin):
+			return true
+		case strings.HasPrefix(allowed, "*."):
+			// the scheme is part of the origin, the wildcard only covers the host
+			_, host, ok := strings.Cut(origin, "://")
+			if ok && strings.HasSuffix(strings.ToLower(host), strings.ToLower(allowed[1:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CORSMiddleware answers the CORS preflight requests of the allowed origins,
+// 403 for the others, and adds the CORS headers to their requests
+func CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(corsSettings.Origins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !corsOriginAllowed(origin) || (preflight && !slices.Contains(corsSettings.Methods, method)) {
+			if !preflight {
+				next.ServeHTTP(w, r)
+				return
+			}
+			corsPreflights.WithLabelValues("rejected").Inc()
+			http.Error(w, "Origin or method not allowed by the CORS settings.", http.StatusForbidden)
+			return
+		}
+
+		// credentials need the origin itself, not a wildcard
+		if slices.Contains(corsSettings.Origins, "*") && !corsSettings.Credentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if corsSettings.Credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if len(corsSettings.ExposeHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(corsSettings.ExposeHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", strings.Join(corsSettings.Methods, ", "))
+		if len(corsSettings.Headers) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(corsSettings.Headers, ", "))
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+		if corsSettings.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(corsSettings.MaxAge).Seconds())))
+		}
+		corsPreflights.WithLabelValues("allowed").Inc()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// CORSHandler serves a page calling the target URL (this instance by
+// default) from the browser with the method, headers and credentials chosen,
+// to see how the browser and the ingresses on the way handle the CORS
+// requests. Without HTML it answers with the CORS settings
+func CORSHandler(w http.ResponseWriter, r *http.Request) {
+	if !wantsHTML(r) {
+		writeJSON(w, http.StatusOK, corsSettings)
+		return
+	}
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = "/version"
+	}
+	writeHTML(w, r, http.StatusOK, corsPage, "cors", CORSPage{Target: target, CORS: corsSettings})
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counter is a named value shared by the clients of the instance
+type Counter struct {
+	Name    string     `json:"name"`
+	Value   int64      `json:"value"`
+	Created time.Time  `json:"created"`
+	Updated time.Time  `json:"updated"`
+	TTL     Duration   `json:"ttl,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+const maxCounters = 10000
+
+var (
+	countersMu sync.Mutex
+	counters   = make(map[string]*Counter)
+)
+
+// expired reports whether the counter outlived its TTL since its last update
+func (c *Counter) expired(now time.Time) bool {
+	return c.TTL > 0 && now.Sub(c.Updated) >= time.Duration(c.TTL)
+}
+
+// snapshot of the counter with the expiry computed, the lock must be held
+func (c *Counter) snapshot() Counter {
+	s := *c
+	s.Created = Skew(c.Created)
+	s.Updated = Skew(c.Updated)
+	if c.TTL > 0 {
+		expires := Skew(c.Updated.Add(time.Duration(c.TTL)))
+		s.Expires = &expires
+	}
+	return s
+}
+
+// forget the expired counters, the lock must be held
+func pruneCounters(now time.Time) {
+	for name, c := range counters {
+		if c.expired(now) {
+			delete(counters, name)
+		}
+	}
+}
+
+// CounterHandler reads (GET), increments (POST) or resets (DELETE) the counter
+// /counter/{name}. POST adds by (default 1, negative to decrement) and sets
+// the optional ttl the counter is forgotten after without updates. A counter
+// never incremented reads 0. GET /counter lists all of them
+func CounterHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/counter"), "/")
+	now := time.Now()
+
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	pruneCounters(now)
+	if name == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+			return
+		}
+		list := []Counter{}
+		for _, c := range counters {
+			list = append(list, c.snapshot())
+		}
+		sort.Slice(list, func(i, k int) bool { return list[i].Name < list[k].Name })
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	c, ok := counters[name]
+	switch r.Method {
+	case "GET":
+		if !ok {
+			c = &Counter{Name: name, Created: now, Updated: now}
+		}
+	case "POST":
+		by, err := queryInt(r, "by", 1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl, err := queryDuration(r, "ttl", 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ttl < 0 {
+			http.Error(w, "ttl must not be negative.", http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			if len(counters) >= maxCounters {
+				http.Error(w, fmt.Sprintf("Too many counters, at most %d.", maxCounters), http.StatusInsufficientStorage)
+				return
+			}
+			c = &Counter{Name: name, Created: now}
+			counters[name] = c
+		}
+		c.Value += int64(by)
+		c.Updated = now
+		// 0 removes the TTL, without ttl the counter keeps its own
+		if r.URL.Query().Has("ttl") {
+			c.TTL = Duration(ttl)
+		}
+	case "DELETE":
+		delete(counters, name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.snapshot())
+}
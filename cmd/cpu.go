@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// cpuSlice is the period the work/sleep ratio of an intensity applies to
+const cpuSlice = 100 * time.Millisecond
+
+// intensityLevels is the share of every slice a CPU worker spends busy
+var intensityLevels = map[string]float64{
+	"low":    0.25,
+	"medium": 0.5,
+	"high":   0.75,
+	"max":    1,
+}
+
+// cpuPatterns scale the intensity over time, phase is the position (0-1)
+// in the current period and elapsed the number of periods since the start
+var cpuPatterns = map[string]func(phase, elapsed float64) float64{
+	"steady": func(phase, elapsed float64) float64 { return 1 },
+	// rises from idle to the intensity over the first period, then holds it
+	"ramp-up": func(phase, elapsed float64) float64 { return min(1, elapsed) },
+	// the intensity for the first tenth of every period, a tenth of it otherwise
+	"spike": func(phase, elapsed float64) float64 {
+		if phase < 0.1 {
+			return 1
+		}
+		return 0.1
+	},
+	"sine":     func(phase, elapsed float64) float64 { return 0.5 + 0.5*math.Sin(2*math.Pi*phase) },
+	"sawtooth": func(phase, elapsed float64) float64 { return phase },
+}
+
+type CPUJob struct {
+	JobKey    string    `json:"job_key"`
+	Intensity string    `json:"intensity,omitempty"`
+	Pattern   string    `json:"pattern,omitempty"`
+	Period    Duration  `json:"period,omitempty"`
+	Cores     int       `json:"cores"`
+	Duration  Duration  `json:"duration"`
+	Started   time.Time `json:"started"`
+	Remaining Duration  `json:"remaining"`
+	// target and last measured CPU usage of the process, in percent of the available CPUs
+	Percent         float64 `json:"percent,omitempty"`
+	MeasuredPercent float64 `json:"measured_percent,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+var (
+	cpuMu   sync.Mutex
+	cpuJobs = make(map[string]*CPUJob)
+
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "cpu_jobs_active",
+		Help:      "Number of /cpu jobs running.",
+	}, func() float64 {
+		cpuMu.Lock()
+		defer cpuMu.Unlock()
+		return float64(len(cpuJobs))
+	})
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "cpu_job_workers",
+		Help:      "Number of goroutines burning CPU for the /cpu jobs.",
+	}, func() float64 {
+		cpuMu.Lock()
+		defer cpuMu.Unlock()
+		workers := 0
+		for _, j := range cpuJobs {
+			workers += j.Cores
+		}
+		return float64(workers)
+	})
+)
+
+// snapshot of the job with the remaining duration computed, the lock must be held
+func (j *CPUJob) snapshot() CPUJob {
+	s := *j
+	s.Started = Skew(j.Started)
+	s.Remaining = Duration(max(0, time.Duration(j.Duration)-time.Since(j.Started)))
+	return s
+}
+
+// burn the CPU for the busy share of every slice until the context is done,
+// the share is asked for every slice with the time elapsed since the start
+func cpuWorker(ctx context.Context, busy func(elapsed time.Duration) float64) {
+	begin := time.Now()
+	for ctx.Err() == nil {
+		start := time.Now()
+		for work := time.Duration(busy(start.Sub(begin)) * float64(cpuSlice)); time.Since(start) < work; {
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(cpuSlice - time.Since(start)):
+		}
+	}
+}
+
+// share of the slices following the pattern of the intensity over the period
+func patternShare(intensity float64, pattern func(phase, elapsed float64) float64, period time.Duration) func(time.Duration) float64 {
+	return func(elapsed time.Duration) float64 {
+		periods := float64(elapsed) / float64(period)
+		return intensity * pattern(periods-math.Floor(periods), periods)
+	}
+}
+
+// adjust the busy share of the workers every second so the CPU usage of the
+// whole process stays near the target percent of the available CPUs
+func holdCPUPercent(ctx context.Context, j *CPUJob, share *atomic.Uint64) {
+	target := j.Percent / 100 * availableCPUs()
+	lastCPU, err := processCPUTime()
+	if err != nil {
+		return
+	}
+	last := time.Now()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cpu, err := processCPUTime()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		used := float64(cpu-lastCPU) / float64(now.Sub(last))
+		lastCPU, last = cpu, now
+
+		// the busy share of every worker moves by half of the error
+		busy := math.Float64frombits(share.Load()) + 0.5*(target-used)/float64(j.Cores)
+		share.Store(math.Float64bits(math.Max(0, math.Min(1, busy))))
+
+		cpuMu.Lock()
+		j.MeasuredPercent = math.Round(used/availableCPUs()*1000) / 10
+		cpuMu.Unlock()
+	}
+}
+
+// CPUHandler starts a CPU load job with intensity (low, medium, high or max,
+// default medium) on cores workers (default 1) for duration (default 30s),
+// the pattern (default steady) shapes the intensity over every period (default 1m).
+// With percent, the CPU usage of the process is held near that percent of the
+// available CPUs instead
+func CPUHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	duration, err := queryDuration(r, "duration", 30*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if duration <= 0 {
+		http.Error(w, "duration must be greater than 0.", http.StatusBadRequest)
+		return
+	}
+	j := &CPUJob{
+		JobKey:   newID(),
+		Duration: Duration(duration),
+		Started:  time.Now(),
+	}
+
+	var busy func(time.Duration) float64
+	var share atomic.Uint64
+	if r.URL.Query().Has("percent") {
+		j.Percent, err = queryFloat(r, "percent", 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if j.Percent <= 0 || j.Percent > 100 {
+			http.Error(w, "percent must be greater than 0 and at most 100.", http.StatusBadRequest)
+			return
+		}
+		if _, err := processCPUTime(); err != nil {
+			http.Error(w, "CPU usage of the process not available: "+err.Error(), http.StatusNotImplemented)
+			return
+		}
+		// enough workers for the target, starting at an even share of it
+		target := j.Percent / 100 * availableCPUs()
+		j.Cores = int(math.Ceil(target))
+		share.Store(math.Float64bits(target / float64(j.Cores)))
+		busy = func(time.Duration) float64 { return math.Float64frombits(share.Load()) }
+	} else {
+		j.Intensity = r.URL.Query().Get("intensity")
+		if j.Intensity == "" {
+			j.Intensity = "medium"
+		}
+		intensity, ok := intensityLevels[j.Intensity]
+		if !ok {
+			http.Error(w, "intensity must be low, medium, high or max.", http.StatusBadRequest)
+			return
+		}
+		j.Pattern = r.URL.Query().Get("pattern")
+		if j.Pattern == "" {
+			j.Pattern = "steady"
+		}
+		pattern, ok := cpuPatterns[j.Pattern]
+		if !ok {
+			http.Error(w, "pattern must be steady, ramp-up, spike, sine or sawtooth.", http.StatusBadRequest)
+			return
+		}
+		period, err := queryDuration(r, "period", time.Minute)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if period < time.Second {
+			http.Error(w, "period must be at least 1s.", http.StatusBadRequest)
+			return
+		}
+		j.Period = Duration(period)
+		j.Cores, err = queryInt(r, "cores", 1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if j.Cores < 1 || j.Cores > 256 {
+			http.Error(w, "cores must be between 1 and 256.", http.StatusBadRequest)
+			return
+		}
+		busy = patternShare(intensity, pattern, period)
+	}
+
+	resp := startCPUJob(j, busy, &share)
+	w.Header().Set("Location", "/cpu/jobs/"+j.JobKey)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// startCPUJob registers the job and starts its workers until its duration
+// is over, share is the busy share held by the percent mode
+func startCPUJob(j *CPUJob, busy func(time.Duration) float64, share *atomic.Uint64) CPUJob {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(j.Duration))
+	j.cancel = cancel
+	cpuMu.Lock()
+	cpuJobs[j.JobKey] = j
+	resp := j.snapshot()
+	cpuMu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < j.Cores; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cpuWorker(ctx, busy)
+		}()
+	}
+	if j.Percent > 0 {
+		go holdCPUPercent(ctx, j, share)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		cpuMu.Lock()
+		delete(cpuJobs, j.JobKey)
+		cpuMu.Unlock()
+	}()
+	return resp
+}
+
+// CPUJobsHandler lists the running CPU jobs (GET /cpu/jobs), or cancels
+// one of them (DELETE /cpu/jobs/{jobKey})
+func CPUJobsHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/cpu/jobs"), "/")
+	if key == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+			return
+		}
+		cpuMu.Lock()
+		jobs := []CPUJob{}
+		for _, j := range cpuJobs {
+			jobs = append(jobs, j.snapshot())
+		}
+		cpuMu.Unlock()
+		sort.Slice(jobs, func(i, k int) bool { return jobs[i].Started.Before(jobs[k].Started) })
+		writeJSON(w, http.StatusOK, jobs)
+		return
+	}
+
+	cpuMu.Lock()
+	j, ok := cpuJobs[key]
+	var resp CPUJob
+	if ok {
+		resp = j.snapshot()
+	}
+	cpuMu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("CPU job %s not found.", key), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, resp)
+	case "DELETE":
+		// the job removes itself once its workers stopped
+		j.cancel()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCPUHandlerRejectsInvalidPercent(t *testing.T) {
+	for _, percent := range []string{"NaN", "Inf", "0", "101"} {
+		w := httptest.NewRecorder()
+		CPUHandler(w, httptest.NewRequest("POST", "/cpu?duration=1ms&percent="+percent, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("percent=%s: got status %d, want 400", percent, w.Code)
+		}
+	}
+}
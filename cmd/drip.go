@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DripHandler writes size bytes (default 100) in chunks of chunk_size bytes
+// (default 10), flushing every chunk. The chunks are spread evenly over
+// duration (default 2s), or sent every interval when it is given. The
+// headers are sent after delay, with code (default 200)
+func DripHandler(w http.ResponseWriter, r *http.Request) {
+	size := int64(100)
+	if v := r.URL.Query().Get("size"); v != "" {
+		var err error
+		if size, err = parseSize(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	chunkSize, err := queryInt(r, "chunk_size", 10)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	duration, err := queryDuration(r, "duration", 2*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delay, err := queryDuration(r, "delay", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	code, err := queryInt(r, "code", http.StatusOK)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if size < 1 || size > maxPayloadSize || chunkSize < 1 || chunkSize > 1<<20 || duration < 0 || code < 200 || code > 599 {
+		http.Error(w, "size must be between 1 byte and 1GB, chunk_size between 1 and 1048576, duration not negative and code between 200 and 599.", http.StatusBadRequest)
+		return
+	}
+	chunks := (size + int64(chunkSize) - 1) / int64(chunkSize)
+	interval := duration / time.Duration(chunks)
+	if r.URL.Query().Has("interval") {
+		if interval, err = queryDuration(r, "interval", 0); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(code)
+	flusher.Flush()
+
+	chunk := bytes.Repeat([]byte("*"), chunkSize)
+	for sent := int64(0); sent < size; {
+		n := min(int64(chunkSize), size-sent)
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return
+		}
+		flusher.Flush()
+		sent += n
+		if sent == size {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// GlobalLatency is added to every request: the fixed part plus a value drawn
+// from the profile when there is one
+type GlobalLatency struct {
+	Fixed   Duration        `json:"fixed,omitempty"`
+	Profile *LatencyProfile `json:"profile,omitempty"`
+}
+
+const globalLatencyPath = "/latency"
+
+var (
+	globalLatencyMu sync.RWMutex
+	globalLatency   GlobalLatency
+)
+
+func globalDelay(rng *rand.Rand) time.Duration {
+	globalLatencyMu.RLock()
+	defer globalLatencyMu.RUnlock()
+	delay := time.Duration(globalLatency.Fixed)
+	if globalLatency.Profile != nil {
+		delay += globalLatency.Profile.sample(rng)
+	}
+	return delay
+}
+
+// GlobalLatencyMiddleware delays every request but the ones changing the global latency
+func GlobalLatencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != globalLatencyPath {
+			if delay := globalDelay(requestRand(r)); delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GlobalLatencyHandler shows (GET), sets (POST) or removes (DELETE) the latency added to all endpoints
+func GlobalLatencyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var l GlobalLatency
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if l.Fixed < 0 {
+			http.Error(w, "The fixed latency must not be negative.", http.StatusBadRequest)
+			return
+		}
+		if l.Profile != nil {
+			if err := l.Profile.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		globalLatencyMu.Lock()
+		globalLatency = l
+		globalLatencyMu.Unlock()
+	case "DELETE":
+		globalLatencyMu.Lock()
+		globalLatency = GlobalLatency{}
+		globalLatencyMu.Unlock()
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	globalLatencyMu.RLock()
+	defer globalLatencyMu.RUnlock()
+	writeJSON(w, http.StatusOK, globalLatency)
+}
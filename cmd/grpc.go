@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The echo service takes and returns google.protobuf.Struct messages, so it
+// needs no generated code and grpcurl can call it with plain JSON:
+//
+//	grpcurl -plaintext -d '{"message": "hi", "delay": "100ms", "count": 5, "abort_after": 3}' \
+//	  localhost:9090 dummybox.Echo/ServerStream
+//
+// Request fields: message is echoed back, delay is waited before every reply,
+// count is the number of replies of ServerStream (default 3) and abort_after
+// ends the call with ABORTED after that many replies.
+
+type echoService interface{}
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dummybox.Echo",
+	HandlerType: (*echoService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: echoUnary},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ServerStream", Handler: echoServerStream, ServerStreams: true},
+		{StreamName: "BidiStream", Handler: echoBidiStream, ServerStreams: true, ClientStreams: true},
+	},
+	Metadata: "dummybox/echo.proto",
+}
+
+// registerEchoDescriptor describes the echo service to the server reflection
+func registerEchoDescriptor() error {
+	method := func(name string, clientStreaming, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".google.protobuf.Struct"),
+			OutputType:      proto.String(".google.protobuf.Struct"),
+			ClientStreaming: proto.Bool(clientStreaming),
+			ServerStreaming: proto.Bool(serverStreaming),
+		}
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("dummybox/echo.proto"),
+		Package:    proto.String("dummybox"),
+		Dependency: []string{"google/protobuf/struct.proto"},
+		Syntax:     proto.String("proto3"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Echo", false, false),
+				method("ServerStream", false, true),
+				method("BidiStream", true, true),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		return err
+	}
+	return protoregistry.GlobalFiles.RegisterFile(file)
+}
+
+// StartGRPCServer serves the echo service and the server reflection on addr
+func StartGRPCServer(addr string) error {
+	if err := registerEchoDescriptor(); err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s := grpc.NewServer()
+	s.RegisterService(&echoServiceDesc, struct{}{})
+	reflection.Register(s)
+
+	go func() {
+		log.Default().Printf("gRPC server running on %s", addr)
+		log.Fatal(s.Serve(lis))
+	}()
+	return nil
+}
+
+// echoOptions are the behavior fields of a request
+type echoOptions struct {
+	message    string
+	delay      time.Duration
+	count      int
+	abortAfter int
+}
+
+func parseEchoOptions(req *structpb.Struct) (echoOptions, error) {
+	fields := req.GetFields()
+	opts := echoOptions{message: fields["message"].GetStringValue(), count: 3, abortAfter: -1}
+	if v, ok := fields["delay"]; ok {
+		d, err := time.ParseDuration(v.GetStringValue())
+		if err != nil {
+			return opts, status.Errorf(codes.InvalidArgument, "invalid delay: %v", err)
+		}
+		opts.delay = d
+	}
+	if v, ok := fields["count"]; ok {
+		opts.count = int(v.GetNumberValue())
+	}
+	if v, ok := fields["abort_after"]; ok {
+		opts.abortAfter = int(v.GetNumberValue())
+	}
+	return opts, nil
+}
+
+// wait the delay, or fail when the call is cancelled or its deadline expires
+func echoWait(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func echoReply(message string, index int) *structpb.Struct {
+	hostname, _ := os.Hostname()
+	reply, _ := structpb.NewStruct(map[string]any{
+		"message":  message,
+		"index":    index,
+		"hostname": hostname,
+		"instance": Instance.Name,
+	})
+	return reply
+}
+
+func echoAborted(sent int) error {
+	return status.Errorf(codes.Aborted, "aborted after %d messages", sent)
+}
+
+func echoUnary(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+	req := new(structpb.Struct)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	opts, err := parseEchoOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := echoWait(ctx, opts.delay); err != nil {
+		return nil, err
+	}
+	if opts.abortAfter == 0 {
+		return nil, echoAborted(0)
+	}
+	return echoReply(opts.message, 0), nil
+}
+
+func echoServerStream(_ any, stream grpc.ServerStream) error {
+	req := new(structpb.Struct)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	opts, err := parseEchoOptions(req)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < opts.count; i++ {
+		if i == opts.abortAfter {
+			return echoAborted(i)
+		}
+		if err := echoWait(stream.Context(), opts.delay); err != nil {
+			return err
+		}
+		if err := stream.SendMsg(echoReply(opts.message, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// echoBidiStream replies to every message, the options of each message apply to its reply
+func echoBidiStream(_ any, stream grpc.ServerStream) error {
+	for i := 0; ; i++ {
+		req := new(structpb.Struct)
+		if err := stream.RecvMsg(req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		opts, err := parseEchoOptions(req)
+		if err != nil {
+			return err
+		}
+		if i == opts.abortAfter {
+			return echoAborted(i)
+		}
+		if err := echoWait(stream.Context(), opts.delay); err != nil {
+			return err
+		}
+		if err := stream.SendMsg(echoReply(opts.message, i)); err != nil {
+			return fmt.Errorf("sending reply %d: %w", i, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthToggle makes a probe fail, or succeed again, for a duration
+type HealthToggle struct {
+	// liveness or readiness
+	Probe string `json:"probe"`
+	// fail or ok
+	State string `json:"state"`
+	// time the probe fails, 0 until the next toggle
+	Duration Duration `json:"duration,omitempty"`
+}
+
+type HealthStatus struct {
+	State string     `json:"state"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// a failing probe, until is zero when it fails until the next toggle
+type probeFailure struct {
+	until time.Time
+}
+
+var (
+	healthMu      sync.Mutex
+	probeFailures = make(map[string]probeFailure)
+
+	// the server reports not started until then
+	startedAt time.Time
+)
+
+// SetStartupDelay makes /startupz and /readyz fail for the delay from now
+func SetStartupDelay(delay time.Duration) {
+	startedAt = time.Now().Add(delay)
+}
+
+// StartupzHandler is the startup probe, it fails until the startup delay elapsed
+func StartupzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if remaining := time.Until(startedAt); remaining > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "starting, %s left\n", remaining.Round(time.Second))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// status of the probe, the lock must be held
+func healthProbeStatus(probe string) HealthStatus {
+	f, ok := probeFailures[probe]
+	if !ok {
+		return HealthStatus{State: "ok"}
+	}
+	if f.until.IsZero() {
+		return HealthStatus{State: "fail"}
+	}
+	if time.Now().After(f.until) {
+		delete(probeFailures, probe)
+		return HealthStatus{State: "ok"}
+	}
+	until := Skew(f.until)
+	return HealthStatus{State: "fail", Until: &until}
+}
+
+func writeProbe(w http.ResponseWriter, probe string) {
+	healthMu.Lock()
+	status := healthProbeStatus(probe)
+	healthMu.Unlock()
+	// a replica still starting is not ready
+	if probe == "readiness" && time.Now().Before(startedAt) {
+		status.State = "fail"
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if status.State == "fail" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write([]byte(status.State + "\n"))
+}
+
+// HealthzHandler is the liveness probe, it fails when toggled with /health
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, "liveness")
+}
+
+// ReadyzHandler is the readiness probe, it fails during the startup delay or
+// when toggled with /health
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, "readiness")
+}
+
+// HealthHandler shows (GET), toggles (POST) or resets (DELETE) the state of
+// the liveness and readiness probes
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var t HealthToggle
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if t.Probe != "liveness" && t.Probe != "readiness" {
+			http.Error(w, "The probe must be liveness or readiness.", http.StatusBadRequest)
+			return
+		}
+		if t.Duration < 0 {
+			http.Error(w, "The duration must not be negative.", http.StatusBadRequest)
+			return
+		}
+		healthMu.Lock()
+		switch t.State {
+		case "fail":
+			f := probeFailure{}
+			if t.Duration > 0 {
+				f.until = time.Now().Add(time.Duration(t.Duration))
+			}
+			probeFailures[t.Probe] = f
+		case "ok":
+			delete(probeFailures, t.Probe)
+		default:
+			healthMu.Unlock()
+			http.Error(w, "The state must be fail or ok.", http.StatusBadRequest)
+			return
+		}
+		healthMu.Unlock()
+	case "DELETE":
+		healthMu.Lock()
+		probeFailures = make(map[string]probeFailure)
+		healthMu.Unlock()
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]HealthStatus{
+		"liveness":  healthProbeStatus("liveness"),
+		"readiness": healthProbeStatus("readiness"),
+	})
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HostRule defines the response returned when the Host header (or the TLS
+// server name) matches Host. A leading "*." matches any subdomain.
+type HostRule struct {
+	Host    string            `json:"host"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Delay   Duration          `json:"delay,omitempty"`
+}
+
+type HostResponse struct {
+	Host    string `json:"host"`
+	SNI     string `json:"sni,omitempty"`
+	Matched string `json:"matched,omitempty"`
+}
+
+var HostRules []HostRule
+
+// SetHostRules replaces the host rules, a status must be 0 for 200 or a
+// status code between 200 and 599
+func SetHostRules(rules []HostRule) error {
+	for _, rule := range rules {
+		if rule.Status != 0 && (rule.Status < 200 || rule.Status > 599) {
+			return fmt.Errorf("invalid status %d of host rule %q, expected a status code between 200 and 599", rule.Status, rule.Host)
+		}
+	}
+	HostRules = rules
+	return nil
+}
+
+// HostHandler responds according to the first rule matching the requested host
+func HostHandler(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	var sni string
+	if r.TLS != nil {
+		sni = r.TLS.ServerName
+	}
+
+	resp := HostResponse{Host: host, SNI: sni}
+	rule, ok := matchHostRule(host, sni)
+	if !ok {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp.Matched = rule.Host
+	select {
+	case <-time.After(time.Duration(rule.Delay)):
+	case <-r.Context().Done():
+		return
+	}
+	for key, value := range rule.Headers {
+		w.Header().Set(key, value)
+	}
+	status := rule.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if rule.Body == "" {
+		writeJSON(w, status, resp)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(rule.Body))
+}
+
+// find the first rule matching the SNI name or the host, SNI takes precedence
+func matchHostRule(host, sni string) (HostRule, bool) {
+	for _, name := range []string{sni, host} {
+		if name == "" {
+			continue
+		}
+		for _, rule := range HostRules {
+			if hostMatches(rule.Host, name) {
+				return rule, true
+			}
+		}
+	}
+	return HostRule{}, false
+}
+
+func hostMatches(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetHostRulesStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		valid  bool
+	}{
+		{0, true},
+		{200, true},
+		{599, true},
+		{42, false},
+		{600, false},
+		{1000, false},
+	} {
+		err := SetHostRules([]HostRule{{Host: "example.com", Status: tc.status}})
+		if (err == nil) != tc.valid {
+			t.Errorf("status %d: got error %v, want valid %v", tc.status, err, tc.valid)
+		}
+	}
+	HostRules = nil
+}
+
+func TestHostMatches(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com", true},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"example.com", "api.example.com", false},
+	} {
+		if got := hostMatches(tc.pattern, tc.host); got != tc.want {
+			t.Errorf("hostMatches(%q, %q) = %v, want %v", tc.pattern, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestHostHandlerDelayCancelled(t *testing.T) {
+	if err := SetHostRules([]HostRule{{Host: "slow.example", Delay: Duration(time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { HostRules = nil }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/host", nil).WithContext(ctx)
+	req.Host = "slow.example"
+	done := make(chan struct{})
+	go func() {
+		HostHandler(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delay went on after the request was cancelled")
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const authRealm = "dummybox"
+
+type AuthResponse struct {
+	Authenticated bool   `json:"authenticated"`
+	User          string `json:"user"`
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA-256": sha256.New,
+}
+
+// split the credentials of /auth/{scheme}/{user}/{pass}
+func authPathCredentials(path, prefix string) (string, string, bool) {
+	user, pass, ok := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+	return user, pass, ok && user != ""
+}
+
+// BasicAuthHandler challenges the client for basic auth and accepts the
+// user and password of /auth/basic/{user}/{pass}
+func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := authPathCredentials(r.URL.Path, "/auth/basic/")
+	if !ok {
+		http.Error(w, "Expected /auth/basic/{user}/{pass}.", http.StatusNotFound)
+		return
+	}
+	gotUser, gotPass, ok := r.BasicAuth()
+	if !ok || gotUser != user || gotPass != pass {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", authRealm))
+		http.Error(w, "Invalid or missing credentials.", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, AuthResponse{Authenticated: true, User: user})
+}
+
+// parse the comma separated key=value or key="value" parameters of a Digest authorization
+func parseDigestParams(header string) (map[string]string, bool) {
+	rest, ok := strings.CutPrefix(header, "Digest ")
+	if !ok {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, false
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				return nil, false
+			}
+			params[key], rest = value[1:end+1], value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[key] = strings.TrimSpace(value)
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return params, true
+}
+
+// DigestAuthHandler challenges the client for digest auth (RFC 7616) and
+// accepts the user and password of /auth/digest/{user}/{pass}. The qop
+// parameter is auth (default), auth-int or none, algorithm is MD5 (default)
+// or SHA-256. Any nonce is accepted, it is not checked for reuse
+func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := authPathCredentials(r.URL.Path, "/auth/digest/")
+	if !ok {
+		http.Error(w, "Expected /auth/digest/{user}/{pass}.", http.StatusNotFound)
+		return
+	}
+	qop := r.URL.Query().Get("qop")
+	if qop == "" {
+		qop = "auth"
+	}
+	if qop != "auth" && qop != "auth-int" && qop != "none" {
+		http.Error(w, "qop must be auth, auth-int or none.", http.StatusBadRequest)
+		return
+	}
+	algorithm := r.URL.Query().Get("algorithm")
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	newHash, ok := digestAlgorithms[algorithm]
+	if !ok {
+		http.Error(w, "algorithm must be MD5 or SHA-256.", http.StatusBadRequest)
+		return
+	}
+	digest := func(parts ...string) string {
+		h := newHash()
+		io.WriteString(h, strings.Join(parts, ":"))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	params, ok := parseDigestParams(r.Header.Get("Authorization"))
+	if ok && params["username"] == user && params["realm"] == authRealm {
+		ha1 := digest(user, authRealm, pass)
+		ha2 := digest(r.Method, params["uri"])
+		var expected string
+		switch params["qop"] {
+		case "":
+			expected = digest(ha1, params["nonce"], ha2)
+		case "auth-int":
+			body, _ := io.ReadAll(r.Body)
+			h := newHash()
+			h.Write(body)
+			ha2 = digest(r.Method, params["uri"], hex.EncodeToString(h.Sum(nil)))
+			fallthrough
+		default:
+			expected = digest(ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+		}
+		qopMatches := params["qop"] == qop || (qop == "none" && params["qop"] == "")
+		if qopMatches && params["uri"] == r.URL.RequestURI() && params["response"] == expected {
+			writeJSON(w, http.StatusOK, AuthResponse{Authenticated: true, User: user})
+			return
+		}
+	}
+
+	challenge := fmt.Sprintf(`Digest realm=%q, nonce=%q, opaque=%q, algorithm=%s`, authRealm, newID(), newID(), algorithm)
+	if qop != "none" {
+		challenge += fmt.Sprintf(`, qop=%q`, qop)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Invalid or missing credentials.", http.StatusUnauthorized)
+}
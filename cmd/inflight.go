@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type InflightRequest struct {
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Start         time.Time `json:"start"`
+	Elapsed       string    `json:"elapsed"`
+	CorrelationID string    `json:"correlation_id"`
+	RemoteAddr    string    `json:"remote_addr"`
+}
+
+var (
+	inflight   sync.Map
+	inflightID atomic.Uint64
+
+	inflightRequests = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "inflight_requests",
+		Help:      "Number of requests currently being served.",
+	})
+)
+
+// InflightMiddleware keeps track of the requests being served
+func InflightMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := inflightID.Add(1)
+		inflight.Store(id, InflightRequest{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Start:         time.Now(),
+			CorrelationID: correlationID(r),
+			RemoteAddr:    r.RemoteAddr,
+		})
+		inflightRequests.Inc()
+		defer func() {
+			inflight.Delete(id)
+			inflightRequests.Dec()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inflightRequestsList returns the requests being served, oldest first
+func inflightRequestsList() []InflightRequest {
+	requests := []InflightRequest{}
+	inflight.Range(func(_, v any) bool {
+		req := v.(InflightRequest)
+		req.Elapsed = time.Since(req.Start).String()
+		req.Start = Skew(req.Start)
+		requests = append(requests, req)
+		return true
+	})
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Start.Before(requests[j].Start) })
+	return requests
+}
+
+// InflightHandler lists the requests currently being served, including itself
+func InflightHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, inflightRequestsList())
+}
@@ -1,14 +1,45 @@
 package cmd
 
 import (
-	"encoding/json"
 	"net/http"
 	"os"
 )
 
-// list all environment variables
+type InfoResponse struct {
+	Instance InstanceInfo `json:"instance"`
+	Hostname string       `json:"hostname"`
+	Listen   []string     `json:"listen"`
+	Env      []string     `json:"env"`
+	// only with --kube-introspect
+	Kubernetes *KubeInfo `json:"kubernetes,omitempty"`
+}
+
+var infoPage = parsePage("info")
+
+// list all environment variables. The page, or the JSON with details=true,
+// adds the instance, its listen addresses and the pod as the Kubernetes API
+// describes it with --kube-introspect
 func InfoHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(os.Environ())
+	html := wantsHTML(r)
+	if !html && r.URL.Query().Get("details") != "true" {
+		writeJSON(w, http.StatusOK, os.Environ())
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	info := InfoResponse{
+		Instance: Instance,
+		Hostname: hostname,
+		Listen:   listenAddresses,
+		Env:      os.Environ(),
+	}
+	if kube != nil {
+		info.Kubernetes = kube.cachedIntrospect(r.Context())
+	}
+
+	if html {
+		writeHTML(w, r, http.StatusOK, infoPage, "info", info)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
 }
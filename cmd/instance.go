@@ -0,0 +1,13 @@
+package cmd
+
+// InstanceInfo identifies this replica in pages, responses and logs
+type InstanceInfo struct {
+	Name   string            `json:"name"`
+	Color  string            `json:"color"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Zone   string            `json:"zone,omitempty"`
+	Region string            `json:"region,omitempty"`
+	Node   string            `json:"node,omitempty"`
+}
+
+var Instance InstanceInfo
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// IPRule allows or denies the clients of its networks on the paths of the
+// rule and the paths below them, on every path when it has none. A client
+// in a deny network is rejected, and so is a client outside of the allow
+// networks when there are some
+type IPRule struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths,omitempty"`
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+
+	allow, deny []*net.IPNet
+}
+
+// IPFilterSettings holds the IP rules and the proxies trusted to report the
+// client IP in X-Forwarded-For
+type IPFilterSettings struct {
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+	Rules          []IPRule `json:"rules,omitempty"`
+}
+
+var (
+	ipRules        []IPRule
+	trustedProxies []*net.IPNet
+
+	ipFilterRejections = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "ip_filter_rejections_total",
+		Help:      "Requests rejected by the IP rules by rule.",
+	}, []string{"rule"})
+)
+
+// parse CIDR networks, a single IP is a network of its own
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetIPFilter validates and sets the IP rules and the trusted proxies
+func SetIPFilter(s IPFilterSettings) error {
+	proxies, err := parseNetworks(s.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.allow, err = parseNetworks(rule.Allow); err != nil {
+			return fmt.Errorf("invalid ip rule %q: %w", rule.Name, err)
+		}
+		if rule.deny, err = parseNetworks(rule.Deny); err != nil {
+			return fmt.Errorf("invalid ip rule %q: %w", rule.Name, err)
+		}
+	}
+	trustedProxies = proxies
+	ipRules = s.Rules
+	return nil
+}
+
+// IP of the client: the address of the connection, or when it is a trusted
+// proxy the last address of X-Forwarded-For that is not a trusted proxy
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// whether the rule lets the client IP through on the path
+func (rule IPRule) allows(path string, ip net.IP) bool {
+	if len(rule.Paths) > 0 {
+		applies := false
+		for _, p := range rule.Paths {
+			applies = applies || pathWithin(path, p)
+		}
+		if !applies {
+			return true
+		}
+	}
+	if ip == nil {
+		return len(rule.allow) == 0
+	}
+	return !containsIP(rule.deny, ip) && (len(rule.allow) == 0 || containsIP(rule.allow, ip))
+}
+
+// IPFilterMiddleware rejects with 403 the requests of a client IP one of the
+// IP rules does not let through
+func IPFilterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(ipRules) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := clientIP(r)
+		for _, rule := range ipRules {
+			if !rule.allows(r.URL.Path, ip) {
+				ipFilterRejections.WithLabelValues(rule.Name).Inc()
+				http.Error(w, fmt.Sprintf("Client %s is not allowed by the rule %s.", ip, rule.Name), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
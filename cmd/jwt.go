@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTSettings configures the verification of the tokens of /auth/jwt: HMAC
+// tokens with the secret, RSA and ECDSA ones with the keys of the JWKS URL.
+// The issuer and audience are only checked when set. The tokens of /token are
+// signed with the MintSecret, none disables the HMAC ones, or the RSA key of
+// the SigningKey file, generated when not set
+type JWTSettings struct {
+	Secret     string `json:"-"`
+	MintSecret string `json:"-"`
+	JWKSURL    string `json:"jwks_url,omitempty"`
+	Issuer     string `json:"issuer,omitempty"`
+	Audience   string `json:"audience,omitempty"`
+	SigningKey string `json:"signing_key,omitempty"`
+}
+
+type JWTResponse struct {
+	Valid  bool           `json:"valid"`
+	Error  string         `json:"error,omitempty"`
+	Header map[string]any `json:"header,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// JWK is a public key of a JSON Web Key Set
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC curve and point
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+const (
+	// keys are fetched again after this time, or sooner for an unknown key id
+	jwksTTL         = 5 * time.Minute
+	jwksMinInterval = 10 * time.Second
+)
+
+var (
+	jwtSettings JWTSettings
+
+	jwksMu      sync.Mutex
+	jwksKeys    map[string]crypto.PublicKey
+	jwksFetched time.Time
+	jwksClient  = newOutboundClient(10 * time.Second)
+)
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// SetJWT configures the verification of /auth/jwt
+func SetJWT(s JWTSettings) error {
+	if s.JWKSURL != "" {
+		u, err := url.Parse(s.JWKSURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid jwks url %q", s.JWKSURL)
+		}
+	}
+	if s.SigningKey != "" {
+		if err := loadSigningKey(s.SigningKey); err != nil {
+			return fmt.Errorf("invalid jwt signing key: %w", err)
+		}
+	}
+	jwtSettings = s
+	jwksMu.Lock()
+	jwksKeys, jwksFetched = nil, time.Time{}
+	jwksMu.Unlock()
+	return nil
+}
+
+// split and decode a compact JWS, claims are decoded even when the signature
+// is not verified yet
+func decodeJWT(token string) (header, claims map[string]any, signingInput string, signature []byte, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, "", nil, errors.New("malformed token, expected 3 parts")
+	}
+	for i, v := range []*map[string]any{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, nil, "", nil, fmt.Errorf("malformed token part %d: %w", i+1, err)
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			return nil, nil, "", nil, fmt.Errorf("malformed token part %d: %w", i+1, err)
+		}
+	}
+	signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header, claims, "", nil, fmt.Errorf("malformed signature: %w", err)
+	}
+	return header, claims, parts[0] + "." + parts[1], signature, nil
+}
+
+func bigFromBase64(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// public key of the JWK, RSA or EC
+func (k JWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := bigFromBase64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := bigFromBase64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := bigFromBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := bigFromBase64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// key of the JWKS URL with the id, fetching the set when it is old or misses
+// the id. The lock is not held during the fetch, a slow JWKS URL does not
+// hold back the tokens of the cached keys
+func jwksKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	jwksMu.Lock()
+	key, ok := jwksKeys[kid]
+	age := time.Since(jwksFetched)
+	jwksMu.Unlock()
+	if (ok && age < jwksTTL) || (!ok && age < jwksMinInterval) {
+		if !ok {
+			return nil, fmt.Errorf("no key %q in the JWKS", kid)
+		}
+		return key, nil
+	}
+
+	keys, err := fetchJWKS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jwksMu.Lock()
+	jwksKeys, jwksFetched = keys, time.Now()
+	jwksMu.Unlock()
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("no key %q in the JWKS", kid)
+	}
+	return key, nil
+}
+
+// the signing keys of the JWKS URL by id
+func fetchJWKS(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", jwtSettings.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the JWKS: status %d", resp.StatusCode)
+	}
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	return keys, nil
+}
+
+// verify the signature of the token with the algorithm of its header
+func verifyJWTSignature(ctx context.Context, header map[string]any, signingInput string, signature []byte) error {
+	alg, _ := header["alg"].(string)
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	family, size := alg[:2], alg[2:]
+	hashFunc, ok := jwtHashes[size]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	if family == "HS" {
+		if jwtSettings.Secret == "" {
+			return errors.New("HMAC tokens need a secret, none is configured")
+		}
+		mac := hmac.New(hashFunc.New, []byte(jwtSettings.Secret))
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	// the tokens of /token are verified without the JWKS URL
+	kid, _ := header["kid"].(string)
+	key, ok := ownSigningKey(kid)
+	if !ok {
+		if jwtSettings.JWKSURL == "" {
+			return fmt.Errorf("%s tokens need a JWKS URL, none is configured", alg)
+		}
+		var err error
+		if key, err = jwksKey(ctx, kid); err != nil {
+			return err
+		}
+	}
+	h := hashFunc.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+	var err error
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch family {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(pub, hashFunc, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(pub, hashFunc, digest, signature, nil)
+		default:
+			return fmt.Errorf("algorithm %s does not match the RSA key %q", alg, kid)
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		// the signature is r and s, each the size of the curve
+		n := (pub.Curve.Params().BitSize + 7) / 8
+		if family != "ES" || len(signature) != 2*n {
+			return fmt.Errorf("algorithm %s does not match the EC key %q", alg, kid)
+		}
+		r, s := new(big.Int).SetBytes(signature[:n]), new(big.Int).SetBytes(signature[n:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
+
+// check the time, issuer and audience claims, the time is the clock of the process
+func checkJWTClaims(claims map[string]any) error {
+	now := Now()
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+		return fmt.Errorf("token expired at %s", time.Unix(int64(exp), 0).UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token not valid before %s", time.Unix(int64(nbf), 0).UTC().Format(time.RFC3339))
+	}
+	if jwtSettings.Issuer != "" && claims["iss"] != jwtSettings.Issuer {
+		return fmt.Errorf("issuer %v, expected %s", claims["iss"], jwtSettings.Issuer)
+	}
+	if jwtSettings.Audience != "" {
+		found := claims["aud"] == jwtSettings.Audience
+		if list, ok := claims["aud"].([]any); ok {
+			for _, aud := range list {
+				found = found || aud == jwtSettings.Audience
+			}
+		}
+		if !found {
+			return fmt.Errorf("audience %v, expected %s", claims["aud"], jwtSettings.Audience)
+		}
+	}
+	return nil
+}
+
+// JWTAuthHandler verifies the Bearer token of the request: its signature
+// against the HMAC secret or the JWKS URL, its expiry and not-before times,
+// and the issuer and audience when configured. It answers with the verdict,
+// 401 for an invalid token, and the header and claims of the token
+func JWTAuthHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+		writeJSON(w, http.StatusUnauthorized, JWTResponse{Error: "missing Bearer token"})
+		return
+	}
+
+	header, claims, signingInput, signature, err := decodeJWT(strings.TrimSpace(token))
+	resp := JWTResponse{Header: header, Claims: claims}
+	if err == nil {
+		err = verifyJWTSignature(r.Context(), header, signingInput, signature)
+	}
+	if err == nil {
+		err = checkJWTClaims(claims)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\", error_description=%q", authRealm, resp.Error))
+		writeJSON(w, http.StatusUnauthorized, resp)
+		return
+	}
+	resp.Valid = true
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWKSKeyFetchesOutsideTheLock(t *testing.T) {
+	fetching, release := make(chan struct{}), make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		<-release
+		w.Write([]byte(`{"keys": []}`))
+	}))
+	defer jwks.Close()
+	defer SetJWT(JWTSettings{})
+	if err := SetJWT(JWTSettings{JWKSURL: jwks.URL}); err != nil {
+		t.Fatal(err)
+	}
+	jwksMu.Lock()
+	jwksKeys = map[string]crypto.PublicKey{"cached": "key"}
+	jwksFetched = time.Now().Add(-jwksMinInterval)
+	jwksMu.Unlock()
+
+	done := make(chan error)
+	go func() {
+		_, err := jwksKey(context.Background(), "unknown")
+		done <- err
+	}()
+	<-fetching
+	if key, err := jwksKey(context.Background(), "cached"); err != nil || key != "key" {
+		t.Errorf("got %v, %v for the cached key during the fetch", key, err)
+	}
+	close(release)
+	if err := <-done; err == nil {
+		t.Error("got a key missing from the JWKS")
+	}
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// files mounted in every pod with automountServiceAccountToken
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient calls the Kubernetes API with the service account of the pod
+type kubeClient struct {
+	baseURL   string
+	namespace string
+	pod       string
+	http      *http.Client
+}
+
+var (
+	kubeMu sync.Mutex
+	// in-cluster client shared by the Kubernetes features, created by the first one
+	kubeShared *kubeClient
+	// kube is the client of --kube-introspect, nil when it is not set
+	kube *kubeClient
+)
+
+// inClusterClient loads the in-cluster configuration once, the pod name is
+// the POD_NAME variable (downward API) or the host name
+func inClusterClient() (*kubeClient, error) {
+	kubeMu.Lock()
+	defer kubeMu.Unlock()
+	if kubeShared != nil {
+		return kubeShared, nil
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST is not set")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate in the service account ca.crt")
+	}
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, err
+	}
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		pod, _ = os.Hostname()
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	kubeShared = &kubeClient{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		namespace: strings.TrimSpace(string(namespace)),
+		pod:       pod,
+		http:      &http.Client{Timeout: 5 * time.Second, Transport: transport},
+	}
+	return kubeShared, nil
+}
+
+// SetKubeIntrospect enables the report of the pod in /info
+func SetKubeIntrospect(enabled bool) error {
+	if !enabled {
+		kube = nil
+		return nil
+	}
+	k, err := inClusterClient()
+	if err != nil {
+		return fmt.Errorf("kube introspect: %w", err)
+	}
+	kube = k
+	return nil
+}
+
+// do sends a request to the API and decodes the JSON answer into v
+func (k *kubeClient) do(ctx context.Context, method, path string, body, v any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	// projected tokens are rotated, read the current one for every call
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		// the API explains the failure, RBAC denials included, in a Status object
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&status)
+		return &kubeError{Code: resp.StatusCode, Message: status.Message}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type kubeError struct {
+	Code    int
+	Message string
+}
+
+func (e *kubeError) Error() string {
+	return fmt.Sprintf("kubernetes API %d: %s", e.Code, e.Message)
+}
+
+// the parts of the Pod object reported by /info
+type kubePod struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		OwnerReferences []struct {
+			Kind       string `json:"kind"`
+			Name       string `json:"name"`
+			UID        string `json:"uid"`
+			Controller bool   `json:"controller"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName           string `json:"nodeName"`
+		ServiceAccountName string `json:"serviceAccountName"`
+		Containers         []struct {
+			Name      string `json:"name"`
+			Image     string `json:"image"`
+			Resources struct {
+				Requests map[string]string `json:"requests"`
+				Limits   map[string]string `json:"limits"`
+			} `json:"resources"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase      string `json:"phase"`
+		PodIP      string `json:"podIP"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (p kubePod) controllerUID() string {
+	for _, o := range p.Metadata.OwnerReferences {
+		if o.Controller {
+			return o.UID
+		}
+	}
+	return ""
+}
+
+func (p kubePod) ready() bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+type KubeOwner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type KubeContainer struct {
+	Name     string            `json:"name"`
+	Image    string            `json:"image"`
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+type KubeReplica struct {
+	Name  string `json:"name"`
+	IP    string `json:"ip"`
+	Node  string `json:"node"`
+	Phase string `json:"phase"`
+	Ready bool   `json:"ready"`
+}
+
+// KubeInfo is the position of the pod in the cluster, as the API sees it
+type KubeInfo struct {
+	Namespace      string          `json:"namespace"`
+	Pod            string          `json:"pod"`
+	Node           string          `json:"node,omitempty"`
+	IP             string          `json:"ip,omitempty"`
+	ServiceAccount string          `json:"service_account,omitempty"`
+	Owners         []KubeOwner     `json:"owners,omitempty"`
+	Containers     []KubeContainer `json:"containers,omitempty"`
+	// the other pods of the same controller
+	Siblings []KubeReplica `json:"siblings,omitempty"`
+	// what the service account was not allowed or able to read
+	Errors []string `json:"errors,omitempty"`
+}
+
+// the /info requests share the introspection for this long instead of
+// calling the API each
+const kubeInfoTTL = 10 * time.Second
+
+var (
+	kubeInfoMu      sync.Mutex
+	kubeInfo        *KubeInfo
+	kubeInfoFetched time.Time
+)
+
+// cachedIntrospect returns the introspection of the last kubeInfoTTL, the
+// requests arriving during a fetch wait for it
+func (k *kubeClient) cachedIntrospect(ctx context.Context) *KubeInfo {
+	kubeInfoMu.Lock()
+	defer kubeInfoMu.Unlock()
+	if kubeInfo == nil || time.Since(kubeInfoFetched) >= kubeInfoTTL {
+		// a client going away does not fail the fetch of the ones waiting
+		kubeInfo = k.introspect(context.WithoutCancel(ctx))
+		kubeInfoFetched = time.Now()
+	}
+	return kubeInfo
+}
+
+// introspect fetches the own Pod object and the pods sharing its controller,
+// the failures are reported in the result rather than failing it
+func (k *kubeClient) introspect(ctx context.Context) *KubeInfo {
+	info := &KubeInfo{Namespace: k.namespace, Pod: k.pod}
+	var pod kubePod
+	if err := k.do(ctx, "GET", "/api/v1/namespaces/"+k.namespace+"/pods/"+k.pod, nil, &pod); err != nil {
+		info.Errors = append(info.Errors, "get pod: "+err.Error())
+		return info
+	}
+	info.Node = pod.Spec.NodeName
+	info.IP = pod.Status.PodIP
+	info.ServiceAccount = pod.Spec.ServiceAccountName
+	for _, o := range pod.Metadata.OwnerReferences {
+		info.Owners = append(info.Owners, KubeOwner{Kind: o.Kind, Name: o.Name})
+	}
+	for _, c := range pod.Spec.Containers {
+		info.Containers = append(info.Containers, KubeContainer{Name: c.Name, Image: c.Image, Requests: c.Resources.Requests, Limits: c.Resources.Limits})
+	}
+
+	owner := pod.controllerUID()
+	if owner == "" {
+		return info
+	}
+	var pods struct {
+		Items []kubePod `json:"items"`
+	}
+	if err := k.do(ctx, "GET", "/api/v1/namespaces/"+k.namespace+"/pods", nil, &pods); err != nil {
+		info.Errors = append(info.Errors, "list pods: "+err.Error())
+		return info
+	}
+	for _, p := range pods.Items {
+		if p.controllerUID() == owner && p.Metadata.Name != k.pod {
+			info.Siblings = append(info.Siblings, KubeReplica{Name: p.Metadata.Name, IP: p.Status.PodIP, Node: p.Spec.NodeName, Phase: p.Status.Phase, Ready: p.ready()})
+		}
+	}
+	return info
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedIntrospect(t *testing.T) {
+	defer func() { kubeInfo = nil }()
+	k := &kubeClient{baseURL: "https://127.0.0.1:1", namespace: "default", pod: "test"}
+	first := k.cachedIntrospect(context.Background())
+	if again := k.cachedIntrospect(context.Background()); again != first {
+		t.Error("the introspection was fetched again within the TTL")
+	}
+	kubeInfoFetched = time.Now().Add(-kubeInfoTTL)
+	if again := k.cachedIntrospect(context.Background()); again == first {
+		t.Error("the introspection was not fetched again after the TTL")
+	}
+}
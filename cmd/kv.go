@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// KVSettings limits the size of the values of /kv and of the whole store
+type KVSettings struct {
+	MaxValueBytes int64 `json:"max_value_bytes"`
+	MaxBytes      int64 `json:"max_bytes"`
+}
+
+// KVEntry describes a value of the store, without the value itself
+type KVEntry struct {
+	Key         string     `json:"key"`
+	Size        int        `json:"size"`
+	ContentType string     `json:"content_type,omitempty"`
+	Updated     time.Time  `json:"updated"`
+	Expires     *time.Time `json:"expires,omitempty"`
+
+	value []byte
+}
+
+// keys the store holds at most, the empty values take no bytes but a key
+const maxKVKeys = 100000
+
+var (
+	kvMu     sync.Mutex
+	kv       = make(map[string]*KVEntry)
+	kvBytes  int64
+	kvLimits KVSettings
+
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "kv_items",
+		Help:      "Number of values held by the /kv store.",
+	}, func() float64 {
+		kvMu.Lock()
+		defer kvMu.Unlock()
+		return float64(len(kv))
+	})
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "kv_bytes",
+		Help:      "Bytes of the values held by the /kv store.",
+	}, func() float64 {
+		kvMu.Lock()
+		defer kvMu.Unlock()
+		return float64(kvBytes)
+	})
+)
+
+// SetKV sets the size limits of the /kv store
+func SetKV(s KVSettings) {
+	kvMu.Lock()
+	defer kvMu.Unlock()
+	kvLimits = s
+}
+
+// snapshot of the entry, the lock must be held
+func (e *KVEntry) snapshot() KVEntry {
+	s := *e
+	s.value = nil
+	s.Updated = Skew(e.Updated)
+	if e.Expires != nil {
+		expires := Skew(*e.Expires)
+		s.Expires = &expires
+	}
+	return s
+}
+
+// remove the entry, the lock must be held
+func deleteKV(key string) bool {
+	e, ok := kv[key]
+	if ok {
+		kvBytes -= int64(len(e.value))
+		delete(kv, key)
+	}
+	return ok
+}
+
+// forget the expired entries, the lock must be held
+func pruneKV(now time.Time) {
+	for key, e := range kv {
+		if e.Expires != nil && !now.Before(*e.Expires) {
+			deleteKV(key)
+		}
+	}
+}
+
+// KVHandler stores (PUT) the request body under /kv/{key} with its content
+// type and an optional ttl, returns it (GET) or removes it (DELETE).
+// GET /kv lists the keys. The values are lost when the instance restarts
+func KVHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/kv"), "/")
+	now := time.Now()
+	// which replica holds the value matters for sticky sessions
+	w.Header().Set("X-Dummybox-Instance", Instance.Name)
+
+	if key == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+			return
+		}
+		kvMu.Lock()
+		pruneKV(now)
+		list := []KVEntry{}
+		for _, e := range kv {
+			list = append(list, e.snapshot())
+		}
+		kvMu.Unlock()
+		sort.Slice(list, func(i, k int) bool { return list[i].Key < list[k].Key })
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		kvMu.Lock()
+		pruneKV(now)
+		e, ok := kv[key]
+		var value []byte
+		var contentType string
+		if ok {
+			value, contentType = e.value, e.ContentType
+		}
+		kvMu.Unlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("Key %s not found.", key), http.StatusNotFound)
+			return
+		}
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		w.Write(value)
+	case "PUT":
+		ttl, err := queryDuration(r, "ttl", 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ttl < 0 {
+			http.Error(w, "ttl must not be negative.", http.StatusBadRequest)
+			return
+		}
+		kvMu.Lock()
+		limits := kvLimits
+		kvMu.Unlock()
+		value, err := io.ReadAll(io.LimitReader(r.Body, limits.MaxValueBytes+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(value)) > limits.MaxValueBytes {
+			http.Error(w, fmt.Sprintf("Value larger than %d bytes.", limits.MaxValueBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		e := &KVEntry{Key: key, Size: len(value), ContentType: r.Header.Get("Content-Type"), Updated: now, value: value}
+		if ttl > 0 {
+			expires := now.Add(ttl)
+			e.Expires = &expires
+		}
+		kvMu.Lock()
+		defer kvMu.Unlock()
+		pruneKV(now)
+		var previous int64
+		old, exists := kv[key]
+		if exists {
+			previous = int64(len(old.value))
+		}
+		if !exists && len(kv) >= maxKVKeys {
+			http.Error(w, fmt.Sprintf("Store full, it may hold at most %d keys.", maxKVKeys), http.StatusInsufficientStorage)
+			return
+		}
+		if kvBytes-previous+int64(len(value)) > kvLimits.MaxBytes {
+			http.Error(w, fmt.Sprintf("Store full, the values may hold at most %d bytes.", kvLimits.MaxBytes), http.StatusInsufficientStorage)
+			return
+		}
+		deleteKV(key)
+		kv[key] = e
+		kvBytes += int64(len(value))
+		writeJSON(w, http.StatusOK, e.snapshot())
+	case "DELETE":
+		kvMu.Lock()
+		ok := deleteKV(key)
+		kvMu.Unlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("Key %s not found.", key), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
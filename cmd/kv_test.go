@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestKVHandlerCapsKeys(t *testing.T) {
+	SetKV(KVSettings{MaxValueBytes: 1 << 10, MaxBytes: 1 << 20})
+	defer func() {
+		kvMu.Lock()
+		kv, kvBytes = make(map[string]*KVEntry), 0
+		kvMu.Unlock()
+	}()
+	kvMu.Lock()
+	for i := 0; i < maxKVKeys; i++ {
+		kv[strconv.Itoa(i)] = &KVEntry{Key: strconv.Itoa(i)}
+	}
+	kvMu.Unlock()
+
+	rec := httptest.NewRecorder()
+	KVHandler(rec, httptest.NewRequest("PUT", "/kv/one-more", nil))
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("new key: got status %d, want 507", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	KVHandler(rec, httptest.NewRequest("PUT", "/kv/0", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("existing key: got status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyProfile is an empirical latency distribution, given either as
+// percentile/value pairs or as raw samples
+type LatencyProfile struct {
+	Percentiles []LatencyPercentile `json:"percentiles,omitempty"`
+	Samples     []Duration          `json:"samples,omitempty"`
+}
+
+type LatencyPercentile struct {
+	P     float64  `json:"p"`
+	Value Duration `json:"value"`
+}
+
+var (
+	latencyMu      sync.RWMutex
+	latencyProfile *LatencyProfile
+)
+
+// SetLatencyProfile validates and replaces the profile /respond draws its delay from, nil removes it
+func SetLatencyProfile(p *LatencyProfile) error {
+	if p != nil {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	latencyProfile = p
+	return nil
+}
+
+// validate the profile and sort its percentiles
+func (p *LatencyProfile) validate() error {
+	if len(p.Percentiles) == 0 && len(p.Samples) == 0 {
+		return errors.New("the latency profile needs percentiles or samples")
+	}
+	if len(p.Percentiles) > 0 && len(p.Samples) > 0 {
+		return errors.New("the latency profile needs either percentiles or samples, not both")
+	}
+	for _, pv := range p.Percentiles {
+		if pv.P < 0 || pv.P > 100 {
+			return errors.New("percentiles must be between 0 and 100")
+		}
+	}
+	sort.Slice(p.Percentiles, func(i, j int) bool { return p.Percentiles[i].P < p.Percentiles[j].P })
+	return nil
+}
+
+// profileDelay draws a delay from the latency profile, false when there is none
+func profileDelay(rng *rand.Rand) (time.Duration, bool) {
+	latencyMu.RLock()
+	defer latencyMu.RUnlock()
+	if latencyProfile == nil {
+		return 0, false
+	}
+	return latencyProfile.sample(rng), true
+}
+
+// sample a value, picking a raw sample or interpolating between the percentiles
+func (p *LatencyProfile) sample(rng *rand.Rand) time.Duration {
+	if len(p.Samples) > 0 {
+		return time.Duration(p.Samples[rng.Intn(len(p.Samples))])
+	}
+
+	u := rng.Float64() * 100
+	points := p.Percentiles
+	if u <= points[0].P {
+		return time.Duration(points[0].Value)
+	}
+	for i := 1; i < len(points); i++ {
+		if u <= points[i].P {
+			lo, hi := points[i-1], points[i]
+			ratio := (u - lo.P) / (hi.P - lo.P)
+			return time.Duration(float64(lo.Value) + ratio*float64(hi.Value-lo.Value))
+		}
+	}
+	return time.Duration(points[len(points)-1].Value)
+}
+
+// LatencyProfileHandler shows (GET), uploads (POST) or removes (DELETE) the
+// latency profile used by /respond when no delay is requested
+func LatencyProfileHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var p LatencyProfile
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := SetLatencyProfile(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		SetLatencyProfile(nil)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	latencyMu.RLock()
+	defer latencyMu.RUnlock()
+	writeJSON(w, http.StatusOK, latencyProfile)
+}
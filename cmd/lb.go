@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+type LBResponse struct {
+	Instance InstanceInfo `json:"instance"`
+	Hostname string       `json:"hostname"`
+	Version  string       `json:"version"`
+	Requests int64        `json:"requests"`
+	Refresh  int          `json:"-"`
+}
+
+var (
+	lbPage     = parsePage("lb")
+	lbRequests atomic.Int64
+)
+
+// LBHandler shows which backend served the request, refreshing the page in a
+// browser makes the load balancing visible
+func LBHandler(w http.ResponseWriter, r *http.Request) {
+	hostname, _ := os.Hostname()
+	resp := LBResponse{
+		Instance: Instance,
+		Hostname: hostname,
+		Version:  requestVersion(r),
+		Requests: lbRequests.Add(1),
+	}
+
+	// optionally reload the page every n seconds
+	if refresh := r.URL.Query().Get("refresh"); refresh != "" {
+		n, err := strconv.Atoi(refresh)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid refresh value.", http.StatusBadRequest)
+			return
+		}
+		resp.Refresh = n
+	}
+
+	if wantsHTML(r) {
+		writeHTML(w, r, http.StatusOK, lbPage, "lb", resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// LeaderSettings configures the leader election on a Kubernetes Lease
+type LeaderSettings struct {
+	// name of the Lease in the namespace of the pod, empty disables the election
+	Lease string `json:"lease"`
+	// time the lease stays valid without renewal, the renewals are three times faster
+	Duration Duration `json:"duration"`
+}
+
+// the parts of the coordination.k8s.io/v1 Lease object used by the election
+type kubeLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace,omitempty"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// MicroTime format of the Kubernetes API
+const kubeMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+type LeaderResponse struct {
+	Lease       string     `json:"lease"`
+	Namespace   string     `json:"namespace"`
+	Identity    string     `json:"identity"`
+	Holder      string     `json:"holder"`
+	IsLeader    bool       `json:"is_leader"`
+	Acquired    *time.Time `json:"acquired,omitempty"`
+	Renewed     *time.Time `json:"renewed,omitempty"`
+	Transitions int        `json:"transitions"`
+	Error       string     `json:"error,omitempty"`
+}
+
+var (
+	leaderMu       sync.Mutex
+	leaderState    *LeaderResponse
+	leaderDuration time.Duration
+
+	leaderGauge = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "leader",
+		Help:      "Whether this instance holds the leader election lease.",
+	})
+	leaderChanges = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "leader_changes_total",
+		Help:      "Changes of the lease holder seen by this instance.",
+	})
+)
+
+// StartLeaderElection competes for the lease with the other replicas, the
+// identity is the pod name
+func StartLeaderElection(s LeaderSettings) error {
+	if s.Duration < Duration(3*time.Second) {
+		return fmt.Errorf("invalid leader election duration %v, it must be at least 3s", s.Duration)
+	}
+	k, err := inClusterClient()
+	if err != nil {
+		return fmt.Errorf("leader election: %w", err)
+	}
+	leaderState = &LeaderResponse{Lease: s.Lease, Namespace: k.namespace, Identity: k.pod}
+	leaderDuration = time.Duration(s.Duration)
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.Duration)/3)
+			lease, err := k.tryAcquireLease(ctx, s)
+			cancel()
+			recordLease(lease, err)
+			time.Sleep(time.Duration(s.Duration) / 3)
+		}
+	}()
+	return nil
+}
+
+// the version of the lease last seen and when this replica saw it change. The
+// renew time written by the holder is on the clock of the holder, the lease
+// expires when it did not change for its duration on the local clock instead
+var leaseSeen struct {
+	version string
+	at      time.Time
+}
+
+// whether the holder of the lease stopped renewing it, the lease is noted as seen
+func leaseExpired(lease *kubeLease, now time.Time) bool {
+	if lease.Metadata.ResourceVersion != leaseSeen.version {
+		leaseSeen.version, leaseSeen.at = lease.Metadata.ResourceVersion, now
+	}
+	return now.After(leaseSeen.at.Add(time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// tryAcquireLease creates, renews or takes over the lease, and returns it as
+// last seen
+func (k *kubeClient) tryAcquireLease(ctx context.Context, s LeaderSettings) (*kubeLease, error) {
+	path := "/apis/coordination.k8s.io/v1/namespaces/" + k.namespace + "/leases"
+	now := time.Now()
+	var lease kubeLease
+	err := k.do(ctx, "GET", path+"/"+s.Lease, nil, &lease)
+	var kerr *kubeError
+	if errors.As(err, &kerr) && kerr.Code == http.StatusNotFound {
+		lease = kubeLease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		lease.Metadata.Name = s.Lease
+		lease.Spec.HolderIdentity = k.pod
+		lease.Spec.LeaseDurationSeconds = int(time.Duration(s.Duration).Seconds())
+		lease.Spec.AcquireTime = now.UTC().Format(kubeMicroTime)
+		lease.Spec.RenewTime = lease.Spec.AcquireTime
+		var created kubeLease
+		if err := k.do(ctx, "POST", path, lease, &created); err != nil {
+			return nil, err
+		}
+		leaseExpired(&created, now)
+		return &created, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expired := leaseExpired(&lease, now)
+	if lease.Spec.HolderIdentity != k.pod && !expired && lease.Spec.HolderIdentity != "" {
+		return &lease, nil
+	}
+	if lease.Spec.HolderIdentity != k.pod {
+		lease.Spec.HolderIdentity = k.pod
+		lease.Spec.AcquireTime = now.UTC().Format(kubeMicroTime)
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = int(time.Duration(s.Duration).Seconds())
+	lease.Spec.RenewTime = now.UTC().Format(kubeMicroTime)
+	// the resource version makes the update fail when another replica wrote first
+	var updated kubeLease
+	if err := k.do(ctx, "PUT", path+"/"+s.Lease, lease, &updated); err != nil {
+		return nil, err
+	}
+	leaseExpired(&updated, now)
+	return &updated, nil
+}
+
+// recordLease updates the state reported by /leader, logging the changes of holder
+func recordLease(lease *kubeLease, err error) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	if err != nil {
+		leaderState.Error = err.Error()
+		if leaderState.IsLeader {
+			slog.Warn("leader election: lease renewal failed", "lease", leaderState.Lease, "error", err)
+			// without renewal the lease expires and another replica may take it
+			if leaderState.Renewed != nil && time.Since(*leaderState.Renewed) > leaderDuration {
+				leaderState.IsLeader = false
+				leaderGauge.Set(0)
+			}
+		}
+		return
+	}
+	leaderState.Error = ""
+	if lease.Spec.HolderIdentity != leaderState.Holder {
+		leaderChanges.Inc()
+		slog.Info("leader election: new leader", "lease", leaderState.Lease, "leader", lease.Spec.HolderIdentity, "previous", leaderState.Holder)
+	}
+	leaderState.Holder = lease.Spec.HolderIdentity
+	leaderState.IsLeader = leaderState.Holder == leaderState.Identity
+	leaderState.Acquired = parseKubeTime(lease.Spec.AcquireTime)
+	leaderState.Renewed = parseKubeTime(lease.Spec.RenewTime)
+	leaderState.Transitions = lease.Spec.LeaseTransitions
+	if leaderState.IsLeader {
+		leaderGauge.Set(1)
+	} else {
+		leaderGauge.Set(0)
+	}
+}
+
+func parseKubeTime(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// LeaderHandler reports the current holder of the lease and whether it is
+// this instance
+func LeaderHandler(w http.ResponseWriter, r *http.Request) {
+	if leaderState == nil {
+		http.Error(w, "Leader election disabled, set --leader-elect-lease.", http.StatusNotFound)
+		return
+	}
+	leaderMu.Lock()
+	resp := *leaderState
+	leaderMu.Unlock()
+	for _, t := range []**time.Time{&resp.Acquired, &resp.Renewed} {
+		if *t != nil {
+			skewed := Skew(**t)
+			*t = &skewed
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseExpired(t *testing.T) {
+	lease := &kubeLease{}
+	lease.Metadata.ResourceVersion = "1"
+	lease.Spec.LeaseDurationSeconds = 15
+	// a renew time far in the future on the clock of the holder
+	lease.Spec.RenewTime = time.Now().Add(time.Hour).UTC().Format(kubeMicroTime)
+	now := time.Now()
+	if leaseExpired(lease, now) {
+		t.Error("a lease seen for the first time expired")
+	}
+	if !leaseExpired(lease, now.Add(16*time.Second)) {
+		t.Error("a lease not renewed for its duration did not expire")
+	}
+	lease.Metadata.ResourceVersion = "2"
+	if leaseExpired(lease, now.Add(20*time.Second)) {
+		t.Error("a renewed lease expired")
+	}
+	if !leaseExpired(lease, now.Add(36*time.Second)) {
+		t.Error("the renewal did not restart the duration")
+	}
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+)
+
+// ListenSettings describes where the HTTP server accepts connections
+type ListenSettings struct {
+	// ipv4, ipv6 or dual
+	Family string `json:"family"`
+	// host:port addresses, the host is an IP address, a host name, a network
+	// interface name or empty for all the addresses
+	Addresses []string `json:"addresses"`
+}
+
+// addresses the HTTP server is actually bound to, reported in /info
+var listenAddresses []string
+
+// Listen opens a listener for every address of the settings, an interface name
+// opens one listener on each of its addresses of the IP family
+func Listen(s ListenSettings) ([]net.Listener, error) {
+	var network string
+	switch s.Family {
+	case "dual", "":
+		network = "tcp"
+	case "ipv4":
+		network = "tcp4"
+	case "ipv6":
+		network = "tcp6"
+	default:
+		return nil, fmt.Errorf("invalid ip family %q, expected ipv4, ipv6 or dual", s.Family)
+	}
+	if len(s.Addresses) == 0 {
+		return nil, fmt.Errorf("no listen address")
+	}
+
+	var listeners []net.Listener
+	for _, addr := range s.Addresses {
+		addrs, err := expandInterface(addr, network)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		for _, a := range addrs {
+			l, err := net.Listen(network, a)
+			if err != nil {
+				closeListeners(listeners)
+				return nil, err
+			}
+			listeners = append(listeners, l)
+		}
+	}
+
+	listenAddresses = nil
+	for _, l := range listeners {
+		listenAddresses = append(listenAddresses, l.Addr().String())
+	}
+	return listeners, nil
+}
+
+// replace a network interface name by its addresses of the network family,
+// any other address is returned unchanged
+func expandInterface(addr, network string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{addr}, nil
+	}
+	iface, err := net.InterfaceByName(host)
+	if err != nil {
+		// not an interface, a host name resolved by net.Listen
+		return []string{addr}, nil
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, a := range ifaceAddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP.String()
+		isIPv4 := ipnet.IP.To4() != nil
+		if (network == "tcp4" && !isIPv4) || (network == "tcp6" && isIPv4) {
+			continue
+		}
+		if ipnet.IP.IsLinkLocalUnicast() && !isIPv4 {
+			ip += "%" + iface.Name
+		}
+		addrs = append(addrs, net.JoinHostPort(ip, port))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("interface %s has no address for the %s network", iface.Name, network)
+	}
+	return addrs, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// latencies kept per load job to compute the percentiles, sampled beyond that
+	maxLoadSamples = 100000
+	// the oldest of the ended load jobs are forgotten beyond that
+	maxEndedLoadJobs = 100
+	// slowest and fastest load, in requests per second
+	minLoadRPS = 0.001
+	maxLoadRPS = 10000
+)
+
+type LoadLatencies struct {
+	P50 Duration `json:"p50"`
+	P90 Duration `json:"p90"`
+	P99 Duration `json:"p99"`
+	Max Duration `json:"max"`
+}
+
+type LoadJob struct {
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	URL         string    `json:"url"`
+	Method      string    `json:"method"`
+	RPS         float64   `json:"rps"`
+	Concurrency int       `json:"concurrency"`
+	Duration    Duration  `json:"duration"`
+	Started     time.Time `json:"started"`
+	Requests    int       `json:"requests"`
+	Errors      int       `json:"errors"`
+	// requests not sent because every worker was busy
+	Skipped   int            `json:"skipped"`
+	Statuses  map[string]int `json:"statuses"`
+	Latencies LoadLatencies  `json:"latencies"`
+
+	body    string
+	timeout time.Duration
+	samples []time.Duration
+	maxSeen time.Duration
+	rng     *rand.Rand
+	cancel  context.CancelFunc
+}
+
+const (
+	loadRunning  = "running"
+	loadFinished = "finished"
+	loadStopped  = "stopped"
+)
+
+var (
+	loadMu   sync.Mutex
+	loadJobs = make(map[string]*LoadJob)
+)
+
+// record the outcome of a request, the lock must be held
+func (j *LoadJob) record(status int, latency time.Duration, err error) {
+	j.Requests++
+	if err != nil {
+		j.Errors++
+		return
+	}
+	j.Statuses[strconv.Itoa(status)]++
+	j.maxSeen = max(j.maxSeen, latency)
+	// reservoir sampling keeps a uniform sample of the latencies
+	if len(j.samples) < maxLoadSamples {
+		j.samples = append(j.samples, latency)
+	} else if i := j.rng.Intn(j.Requests); i < maxLoadSamples {
+		j.samples[i] = latency
+	}
+}
+
+// snapshot of the job, the lock must be held. The percentiles are computed
+// by summarize, without the lock
+func (j *LoadJob) snapshot() LoadJob {
+	s := *j
+	s.Started = Skew(j.Started)
+	s.Statuses = make(map[string]int, len(j.Statuses))
+	for k, v := range j.Statuses {
+		s.Statuses[k] = v
+	}
+	s.samples = append([]time.Duration(nil), j.samples...)
+	return s
+}
+
+// compute the latency percentiles of a snapshot from its samples
+func (s *LoadJob) summarize() {
+	sorted := s.samples
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	percentile := func(p float64) Duration {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return Duration(sorted[min(len(sorted)-1, int(p*float64(len(sorted))))])
+	}
+	s.Latencies = LoadLatencies{P50: percentile(0.5), P90: percentile(0.9), P99: percentile(0.99), Max: Duration(s.maxSeen)}
+	s.samples = nil
+}
+
+// forget the oldest of the ended jobs beyond maxEndedLoadJobs, the lock must
+// be held
+func pruneLoadJobs() {
+	var ended []*LoadJob
+	for _, j := range loadJobs {
+		if j.Status != loadRunning {
+			ended = append(ended, j)
+		}
+	}
+	if len(ended) <= maxEndedLoadJobs {
+		return
+	}
+	sort.Slice(ended, func(i, k int) bool { return ended[i].Started.Before(ended[k].Started) })
+	for _, j := range ended[:len(ended)-maxEndedLoadJobs] {
+		delete(loadJobs, j.ID)
+	}
+}
+
+// send requests at the rate of the job from its workers until the context is done
+func runLoadJob(ctx context.Context, j *LoadJob) {
+	client := newOutboundClient(j.timeout)
+	client.Transport.(*http.Transport).MaxIdleConnsPerHost = j.Concurrency
+
+	tokens := make(chan struct{}, j.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < j.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range tokens {
+				start := time.Now()
+				status, err := loadRequest(ctx, client, j)
+				latency := time.Since(start)
+				if ctx.Err() != nil {
+					// requests cut by the end of the job are not counted
+					continue
+				}
+				loadMu.Lock()
+				j.record(status, latency, err)
+				loadMu.Unlock()
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / j.RPS))
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+			select {
+			case tokens <- struct{}{}:
+			default:
+				loadMu.Lock()
+				j.Skipped++
+				loadMu.Unlock()
+			}
+		}
+	}
+	close(tokens)
+	wg.Wait()
+
+	loadMu.Lock()
+	if j.Status == loadRunning {
+		j.Status = loadFinished
+	}
+	loadMu.Unlock()
+}
+
+func loadRequest(ctx context.Context, client *http.Client, j *LoadJob) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, j.Method, j.URL, strings.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, err
+}
+
+// LoadgenHandler starts a load job (POST) sending rps requests per second
+// (default 10, from 0.001 to 10000) from concurrency workers (default 10) to url for duration
+// (default 30s), with method (default GET), body and a timeout per request
+// (default 5s), or lists all the jobs (GET)
+func LoadgenHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		loadMu.Lock()
+		jobs := []LoadJob{}
+		for _, j := range loadJobs {
+			jobs = append(jobs, j.snapshot())
+		}
+		loadMu.Unlock()
+		for i := range jobs {
+			jobs[i].summarize()
+		}
+		sort.Slice(jobs, func(i, k int) bool { return jobs[i].Started.Before(jobs[k].Started) })
+		writeJSON(w, http.StatusOK, jobs)
+		return
+	case "POST":
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	url := q.Get("url")
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		http.Error(w, "url must be an http or https URL.", http.StatusBadRequest)
+		return
+	}
+	method := strings.ToUpper(q.Get("method"))
+	if method == "" {
+		method = "GET"
+	}
+	rps, err := queryFloat(r, "rps", 10)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	concurrency, err := queryInt(r, "concurrency", 10)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	duration, err := queryDuration(r, "duration", 30*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout, err := queryDuration(r, "timeout", 5*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rps < minLoadRPS || rps > maxLoadRPS || concurrency < 1 || concurrency > 1000 || duration <= 0 || timeout <= 0 {
+		http.Error(w, "rps must be between 0.001 and 10000, concurrency between 1 and 1000, duration and timeout greater than 0.", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	j := &LoadJob{
+		ID:          newID(),
+		Status:      loadRunning,
+		URL:         url,
+		Method:      method,
+		RPS:         rps,
+		Concurrency: concurrency,
+		Duration:    Duration(duration),
+		Started:     time.Now(),
+		Statuses:    map[string]int{},
+		body:        q.Get("body"),
+		timeout:     timeout,
+		rng:         newRand(requestRand(r).Int63()),
+		cancel:      cancel,
+	}
+	loadMu.Lock()
+	pruneLoadJobs()
+	loadJobs[j.ID] = j
+	resp := j.snapshot()
+	loadMu.Unlock()
+	resp.summarize()
+	go func() {
+		runLoadJob(ctx, j)
+		cancel()
+	}()
+
+	w.Header().Set("Location", "/loadgen/"+j.ID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// LoadJobHandler reports the results of the job /loadgen/{id} (GET), or
+// stops it (DELETE)
+func LoadJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/loadgen/")
+
+	loadMu.Lock()
+	j, ok := loadJobs[id]
+	var resp LoadJob
+	if ok {
+		if r.Method == "DELETE" && j.Status == loadRunning {
+			j.Status = loadStopped
+			j.cancel()
+		}
+		resp = j.snapshot()
+	}
+	loadMu.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("Load job %s not found.", id), http.StatusNotFound)
+		return
+	}
+	resp.summarize()
+	switch r.Method {
+	case "GET", "DELETE":
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
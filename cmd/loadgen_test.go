@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoadgenHandlerRejectsInvalidRPS(t *testing.T) {
+	for _, rps := range []string{"NaN", "Inf", "1e-11", "0", "10001"} {
+		w := httptest.NewRecorder()
+		LoadgenHandler(w, httptest.NewRequest("POST", "/loadgen?url=http://127.0.0.1:1/&rps="+rps, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("rps=%s: got status %d, want 400", rps, w.Code)
+		}
+	}
+}
+
+func TestPruneLoadJobs(t *testing.T) {
+	defer func() { loadJobs = make(map[string]*LoadJob) }()
+	start := time.Now()
+	loadJobs["running"] = &LoadJob{ID: "running", Status: loadRunning, Started: start}
+	for i := 0; i < maxEndedLoadJobs+5; i++ {
+		id := strconv.Itoa(i)
+		loadJobs[id] = &LoadJob{ID: id, Status: loadFinished, Started: start.Add(time.Duration(i) * time.Second)}
+	}
+	pruneLoadJobs()
+	if len(loadJobs) != maxEndedLoadJobs+1 {
+		t.Errorf("got %d jobs, want %d", len(loadJobs), maxEndedLoadJobs+1)
+	}
+	if _, ok := loadJobs["running"]; !ok {
+		t.Error("the running job was pruned")
+	}
+	if _, ok := loadJobs["4"]; ok {
+		t.Error("an old ended job was kept")
+	}
+}
+
+func TestLoadJobSummarize(t *testing.T) {
+	j := &LoadJob{Statuses: map[string]int{}}
+	for i := 100; i > 0; i-- {
+		j.samples = append(j.samples, time.Duration(i)*time.Millisecond)
+	}
+	j.maxSeen = 100 * time.Millisecond
+	s := j.snapshot()
+	s.summarize()
+	if s.Latencies.P50 != Duration(51*time.Millisecond) || s.Latencies.P99 != Duration(100*time.Millisecond) || s.samples != nil {
+		t.Errorf("got %+v", s.Latencies)
+	}
+	if j.samples[0] != 100*time.Millisecond {
+		t.Error("summarize sorted the samples of the job")
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// a deliberately broken response, written raw on the hijacked connection
+type malformedKind struct {
+	description string
+	build       func(r *http.Request) ([]byte, error)
+}
+
+type MalformedKind struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+}
+
+var (
+	malformedResponses = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "malformed_responses_total",
+		Help:      "Deliberately malformed responses sent, by kind.",
+	}, []string{"kind"})
+
+	malformedKinds = map[string]malformedKind{
+		"oversized_header": {
+			description: "a single header of size bytes (default 65536), larger than most clients and proxies accept",
+			build:       malformedOversizedHeader,
+		},
+		"duplicate_headers": {
+			description: "the same header repeated count times (default 100) and two conflicting Content-Length headers",
+			build:       malformedDuplicateHeaders,
+		},
+		"invalid_header": {
+			description: "header names with spaces and colons, and values with NUL, DEL and bare LF characters",
+			build:       malformedInvalidHeader,
+		},
+		"bad_status_line": {
+			description: "a status line with a four digit code, or the raw line given in the line parameter",
+			build:       malformedStatusLine,
+		},
+		"truncated_chunked": {
+			description: "a chunked body whose last chunk is cut in the middle and never terminated",
+			build:       malformedTruncatedChunked,
+		},
+		"mixed_encoding": {
+			description: "a gzip encoded body followed by plain text, declared as UTF-8 but containing Latin-1 bytes",
+			build:       malformedMixedEncoding,
+		},
+	}
+)
+
+// MalformedHandler lists the malformed responses, or sends the one named by kind
+// and closes the connection
+func MalformedHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("kind")
+	if name == "" {
+		kinds := make([]MalformedKind, 0, len(malformedKinds))
+		for k, v := range malformedKinds {
+			kinds = append(kinds, MalformedKind{Kind: k, Description: v.description})
+		}
+		sort.Slice(kinds, func(i, j int) bool { return kinds[i].Kind < kinds[j].Kind })
+		writeJSON(w, http.StatusOK, kinds)
+		return
+	}
+	kind, ok := malformedKinds[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown kind %q.", name), http.StatusBadRequest)
+		return
+	}
+	raw, err := kind.build(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "Hijacking not supported.", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	malformedResponses.WithLabelValues(name).Inc()
+	conn.Write(raw)
+}
+
+func malformedOversizedHeader(r *http.Request) ([]byte, error) {
+	size, err := queryInt(r, "size", 64<<10)
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 || size > 16<<20 {
+		return nil, errors.New("size must be between 1 and 16777216 bytes")
+	}
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nX-Oversized: ")
+	b.WriteString(strings.Repeat("a", size))
+	b.WriteString("\r\nContent-Length: 3\r\nConnection: close\r\n\r\nok\n")
+	return b.Bytes(), nil
+}
+
+func malformedDuplicateHeaders(r *http.Request) ([]byte, error) {
+	count, err := queryInt(r, "count", 100)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 || count > 10000 {
+		return nil, errors.New("count must be between 1 and 10000")
+	}
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&b, "X-Duplicate: %d\r\n", i)
+	}
+	b.WriteString("Content-Length: 3\r\nContent-Length: 30\r\nConnection: close\r\n\r\nok\n")
+	return b.Bytes(), nil
+}
+
+func malformedInvalidHeader(r *http.Request) ([]byte, error) {
+	return []byte("HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"X-Space In-Name: value\r\n" +
+		"X-Colon:In-Name: value\r\n" +
+		"X-Nul: a\x00b\r\n" +
+		"X-Del: a\x7fb\r\n" +
+		"X-Bare-Lf: a\nX-Injected: b\r\n" +
+		"Content-Length: 3\r\nConnection: close\r\n\r\nok\n"), nil
+}
+
+func malformedStatusLine(r *http.Request) ([]byte, error) {
+	line := r.URL.Query().Get("line")
+	if line == "" {
+		line = "HTTP/1.1 2000 OK"
+	}
+	return []byte(line + "\r\nContent-Type: text/plain\r\nContent-Length: 3\r\nConnection: close\r\n\r\nok\n"), nil
+}
+
+func malformedTruncatedChunked(r *http.Request) ([]byte, error) {
+	// the chunk announces 1024 bytes but only half of them are sent
+	return []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n" +
+		"3\r\nok\n\r\n" +
+		"400\r\n" + strings.Repeat(".", 512)), nil
+}
+
+func malformedMixedEncoding(r *http.Request) ([]byte, error) {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write([]byte("compressed part\n"))
+	gz.Close()
+	body.WriteString("plain part\n")
+	// "café" in Latin-1, invalid as UTF-8
+	body.Write([]byte{'c', 'a', 'f', 0xe9, '\n'})
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", body.Len())
+	b.Write(body.Bytes())
+	return b.Bytes(), nil
+}
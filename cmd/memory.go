@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type MemoryAllocation struct {
+	Key       string    `json:"key"`
+	Mode      string    `json:"mode"`
+	SizeMB    int       `json:"size_mb"`
+	RateMB    int       `json:"rate_mb,omitempty"`
+	Interval  Duration  `json:"interval,omitempty"`
+	CapMB     int       `json:"cap_mb,omitempty"`
+	Duration  Duration  `json:"duration,omitempty"`
+	Allocated time.Time `json:"allocated"`
+	Remaining Duration  `json:"remaining,omitempty"`
+
+	blocks [][]byte
+	timer  *time.Timer
+	stop   chan struct{}
+}
+
+var (
+	memoryMu     sync.Mutex
+	memoryBlocks = make(map[string]*MemoryAllocation)
+
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "memory_allocated_megabytes",
+		Help:      "Memory held by the /memory allocations and leaks.",
+	}, func() float64 {
+		memoryMu.Lock()
+		defer memoryMu.Unlock()
+		total := 0
+		for _, a := range memoryBlocks {
+			total += a.SizeMB
+		}
+		return float64(total)
+	})
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "memory_allocations_active",
+		Help:      "Number of /memory allocations and leaks held.",
+	}, func() float64 {
+		memoryMu.Lock()
+		defer memoryMu.Unlock()
+		return float64(len(memoryBlocks))
+	})
+)
+
+// snapshot of the allocation with the remaining duration computed, the lock must be held
+func (a *MemoryAllocation) snapshot() MemoryAllocation {
+	s := *a
+	s.blocks = nil
+	s.Allocated = Skew(a.Allocated)
+	if a.Duration > 0 {
+		s.Remaining = Duration(max(0, time.Duration(a.Duration)-time.Since(a.Allocated)))
+	}
+	return s
+}
+
+// allocate a block of sizeMB and write every page, so it counts in the resident memory
+func allocateMemory(sizeMB int) []byte {
+	block := make([]byte, sizeMB<<20)
+	for i := 0; i < len(block); i += 4096 {
+		block[i] = 1
+	}
+	return block
+}
+
+// deallocateMemory releases the allocation, false when it does not exist
+func deallocateMemory(key string) bool {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	a, ok := memoryBlocks[key]
+	if !ok {
+		return false
+	}
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	if a.stop != nil {
+		close(a.stop)
+	}
+	delete(memoryBlocks, key)
+	return true
+}
+
+// grow the leak by its rate every interval until its cap, or until it is released
+func leakMemory(a *MemoryAllocation) {
+	ticker := time.NewTicker(time.Duration(a.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+		// the last step only grows up to the cap, never past it
+		memoryMu.Lock()
+		grow := a.RateMB
+		if a.CapMB > 0 {
+			grow = min(grow, a.CapMB-a.SizeMB)
+		}
+		memoryMu.Unlock()
+		if grow <= 0 {
+			return
+		}
+		block := allocateMemory(grow)
+
+		memoryMu.Lock()
+		select {
+		case <-a.stop:
+			memoryMu.Unlock()
+			return
+		default:
+		}
+		a.blocks = append(a.blocks, block)
+		a.SizeMB += grow
+		full := a.CapMB > 0 && a.SizeMB >= a.CapMB
+		memoryMu.Unlock()
+		if full {
+			return
+		}
+	}
+}
+
+// MemoryHandler allocates size_mb megabytes (default 100) and keeps them for
+// duration (default 1m), or with mode=leak grows by rate_mb megabytes (default 10)
+// every interval (default 5s) until cap_mb, the OOM killer or the end of the
+// optional duration
+func MemoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	a := &MemoryAllocation{
+		Key:       newID(),
+		Mode:      r.URL.Query().Get("mode"),
+		Allocated: time.Now(),
+	}
+	var err error
+	switch a.Mode {
+	case "", "fixed":
+		a.Mode = "fixed"
+		err = parseFixedMemory(r, a)
+	case "leak":
+		err = parseLeakMemory(r, a)
+	default:
+		err = errors.New("mode must be fixed or leak")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := holdMemory(a)
+	w.Header().Set("Location", "/memory/allocations/"+a.Key)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// holdMemory allocates or starts leaking the memory of the allocation and
+// registers it, it is released at the end of its optional duration
+func holdMemory(a *MemoryAllocation) MemoryAllocation {
+	if a.Mode == "fixed" {
+		a.blocks = [][]byte{allocateMemory(a.SizeMB)}
+	} else {
+		a.stop = make(chan struct{})
+		go leakMemory(a)
+	}
+
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	if a.Duration > 0 {
+		a.timer = time.AfterFunc(time.Duration(a.Duration), func() { deallocateMemory(a.Key) })
+	}
+	memoryBlocks[a.Key] = a
+	return a.snapshot()
+}
+
+func parseFixedMemory(r *http.Request, a *MemoryAllocation) error {
+	sizeMB, err := queryInt(r, "size_mb", 100)
+	if err != nil {
+		return err
+	}
+	duration, err := queryDuration(r, "duration", time.Minute)
+	if err != nil {
+		return err
+	}
+	if sizeMB < 1 || sizeMB > 64<<10 || duration <= 0 {
+		return errors.New("size_mb must be between 1 and 65536 and duration greater than 0")
+	}
+	a.SizeMB = sizeMB
+	a.Duration = Duration(duration)
+	return nil
+}
+
+func parseLeakMemory(r *http.Request, a *MemoryAllocation) error {
+	rateMB, err := queryInt(r, "rate_mb", 10)
+	if err != nil {
+		return err
+	}
+	interval, err := queryDuration(r, "interval", 5*time.Second)
+	if err != nil {
+		return err
+	}
+	capMB, err := queryInt(r, "cap_mb", 0)
+	if err != nil {
+		return err
+	}
+	duration, err := queryDuration(r, "duration", 0)
+	if err != nil {
+		return err
+	}
+	if rateMB < 1 || rateMB > 64<<10 || interval < 10*time.Millisecond || capMB < 0 || duration < 0 {
+		return errors.New("rate_mb must be between 1 and 65536, interval at least 10ms, cap_mb and duration not negative")
+	}
+	a.RateMB = rateMB
+	a.Interval = Duration(interval)
+	a.CapMB = capMB
+	a.Duration = Duration(duration)
+	return nil
+}
+
+// MemoryAllocationsHandler lists the active allocations (GET /memory/allocations),
+// or releases one of them (DELETE /memory/allocations/{key})
+func MemoryAllocationsHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/memory/allocations"), "/")
+	if key == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+			return
+		}
+		memoryMu.Lock()
+		allocations := []MemoryAllocation{}
+		for _, a := range memoryBlocks {
+			allocations = append(allocations, a.snapshot())
+		}
+		memoryMu.Unlock()
+		sort.Slice(allocations, func(i, k int) bool { return allocations[i].Allocated.Before(allocations[k].Allocated) })
+		writeJSON(w, http.StatusOK, allocations)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		memoryMu.Lock()
+		a, ok := memoryBlocks[key]
+		var resp MemoryAllocation
+		if ok {
+			resp = a.snapshot()
+		}
+		memoryMu.Unlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("Memory allocation %s not found.", key), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case "DELETE":
+		if !deallocateMemory(key) {
+			http.Error(w, fmt.Sprintf("Memory allocation %s not found.", key), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
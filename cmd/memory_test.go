@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeakMemoryStopsAtCap(t *testing.T) {
+	for _, tc := range []struct{ rate, cap int }{{10, 5}, {10, 25}, {4, 8}} {
+		a := &MemoryAllocation{RateMB: tc.rate, CapMB: tc.cap, Interval: Duration(time.Millisecond), stop: make(chan struct{})}
+		leakMemory(a)
+		allocated := 0
+		for _, b := range a.blocks {
+			allocated += len(b)
+		}
+		if a.SizeMB != tc.cap || allocated != tc.cap<<20 {
+			t.Errorf("rate %d cap %d: grew to %dMB with %d bytes allocated, want %dMB", tc.rate, tc.cap, a.SizeMB, allocated, tc.cap)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registry holds every collector exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+// StatusRecorder remembers the status written to the response, 0 until the
+// response starts, and whether the connection was hijacked. It keeps the
+// flushing and hijacking of the wrapped writer available
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status   int
+	Hijacked bool
+}
+
+func (rec *StatusRecorder) WriteHeader(code int) {
+	if rec.Status == 0 {
+		rec.Status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *StatusRecorder) Write(b []byte) (int, error) {
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *StatusRecorder) Flush() {
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.Hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap gives http.NewResponseController access to the wrapped writer
+func (rec *StatusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// largest number of series of all the synthetic metric sets together
+const maxSyntheticSeries = 200000
+
+var metricSetName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// MetricSet is a group of synthetic metrics registered by /metrics-gen, every
+// metric has Labels labels of Cardinality values each, and gets a new random
+// value for every series each Interval
+type MetricSet struct {
+	Name        string    `json:"name"`
+	Counters    int       `json:"counters"`
+	Gauges      int       `json:"gauges"`
+	Histograms  int       `json:"histograms"`
+	Labels      int       `json:"labels"`
+	Cardinality int       `json:"cardinality"`
+	Interval    Duration  `json:"interval"`
+	Series      int       `json:"series"`
+	Started     time.Time `json:"started"`
+
+	collectors []prometheus.Collector
+	stop       chan struct{}
+}
+
+var (
+	metricSetsMu sync.Mutex
+	metricSets   = make(map[string]*MetricSet)
+)
+
+// snapshot of the set, the lock must be held
+func (s *MetricSet) snapshot() MetricSet {
+	c := *s
+	c.Started = Skew(s.Started)
+	return c
+}
+
+// number of series of every metric of the set
+func (s *MetricSet) combinations() int {
+	n := 1
+	for i := 0; i < s.Labels; i++ {
+		n *= s.Cardinality
+	}
+	return n
+}
+
+// label values of the combination i, the digits of i in base Cardinality
+func (s *MetricSet) labelValues(i int) []string {
+	values := make([]string, s.Labels)
+	for k := range values {
+		values[k] = "value_" + strconv.Itoa(i%s.Cardinality)
+		i /= s.Cardinality
+	}
+	return values
+}
+
+// register the metrics of the set with every series created
+func (s *MetricSet) register() error {
+	labels := make([]string, s.Labels)
+	for i := range labels {
+		labels[i] = "label_" + strconv.Itoa(i)
+	}
+	prefix := "synthetic_" + s.Name
+	for i := 0; i < s.Counters; i++ {
+		s.collectors = append(s.collectors, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "samplebox",
+			Name:      fmt.Sprintf("%s_counter_%d_total", prefix, i),
+			Help:      "Synthetic counter generated by /metrics-gen.",
+		}, labels))
+	}
+	for i := 0; i < s.Gauges; i++ {
+		s.collectors = append(s.collectors, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "samplebox",
+			Name:      fmt.Sprintf("%s_gauge_%d", prefix, i),
+			Help:      "Synthetic gauge generated by /metrics-gen.",
+		}, labels))
+	}
+	for i := 0; i < s.Histograms; i++ {
+		s.collectors = append(s.collectors, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "samplebox",
+			Name:      fmt.Sprintf("%s_histogram_%d_seconds", prefix, i),
+			Help:      "Synthetic histogram generated by /metrics-gen.",
+		}, labels))
+	}
+	for i, c := range s.collectors {
+		if err := Registry.Register(c); err != nil {
+			for _, registered := range s.collectors[:i] {
+				Registry.Unregister(registered)
+			}
+			return err
+		}
+	}
+	s.update()
+	return nil
+}
+
+// give every series a new random value
+func (s *MetricSet) update() {
+	n := s.combinations()
+	for _, c := range s.collectors {
+		for i := 0; i < n; i++ {
+			values := s.labelValues(i)
+			switch c := c.(type) {
+			case *prometheus.CounterVec:
+				c.WithLabelValues(values...).Add(random.Float64() * 10)
+			case *prometheus.GaugeVec:
+				c.WithLabelValues(values...).Set(random.Float64() * 100)
+			case *prometheus.HistogramVec:
+				c.WithLabelValues(values...).Observe(random.ExpFloat64() / 10)
+			}
+		}
+	}
+}
+
+func (s *MetricSet) run() {
+	ticker := time.NewTicker(time.Duration(s.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			for _, c := range s.collectors {
+				Registry.Unregister(c)
+			}
+			return
+		case <-ticker.C:
+			s.update()
+		}
+	}
+}
+
+// MetricsGenHandler registers a set of synthetic metrics (POST) with counters,
+// gauges and histograms metrics, labels labels of cardinality values each,
+// updated every interval (default 15s), or lists the sets (GET). The metrics
+// are named samplebox_synthetic_{name}_{type}_{n}
+func MetricsGenHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		metricSetsMu.Lock()
+		sets := []MetricSet{}
+		for _, s := range metricSets {
+			sets = append(sets, s.snapshot())
+		}
+		metricSetsMu.Unlock()
+		sort.Slice(sets, func(i, k int) bool { return sets[i].Started.Before(sets[k].Started) })
+		writeJSON(w, http.StatusOK, sets)
+		return
+	case "POST":
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := &MetricSet{Name: r.URL.Query().Get("name"), Started: time.Now(), stop: make(chan struct{})}
+	if s.Name == "" {
+		s.Name = "set_" + newID()[:8]
+	}
+	if !metricSetName.MatchString(s.Name) {
+		http.Error(w, "name must be lowercase letters, digits and underscores, starting with a letter.", http.StatusBadRequest)
+		return
+	}
+	var err error
+	for _, p := range []struct {
+		name string
+		def  int
+		v    *int
+	}{{"counters", 1, &s.Counters}, {"gauges", 1, &s.Gauges}, {"histograms", 1, &s.Histograms}, {"labels", 1, &s.Labels}, {"cardinality", 10, &s.Cardinality}} {
+		if *p.v, err = queryInt(r, p.name, p.def); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// bounded before the sums and products of the counts can overflow
+		if *p.v < 0 || *p.v > maxSyntheticSeries {
+			http.Error(w, fmt.Sprintf("%s must be between 0 and %d.", p.name, maxSyntheticSeries), http.StatusBadRequest)
+			return
+		}
+	}
+	interval, err := queryDuration(r, "interval", 15*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if interval < 100*time.Millisecond {
+		http.Error(w, "interval must be at least 100ms.", http.StatusBadRequest)
+		return
+	}
+	s.Interval = Duration(interval)
+	if s.Cardinality < 1 || s.Labels > 10 || s.Counters+s.Gauges+s.Histograms == 0 {
+		http.Error(w, "cardinality must be at least 1, labels at most 10 and at least one metric requested.", http.StatusBadRequest)
+		return
+	}
+	// stop counting as soon as the limit is exceeded, the powers overflow quickly
+	combinations := 1
+	for i := 0; i < s.Labels && combinations <= maxSyntheticSeries; i++ {
+		combinations *= s.Cardinality
+	}
+	s.Series = (s.Counters + s.Gauges + s.Histograms) * combinations
+
+	metricSetsMu.Lock()
+	defer metricSetsMu.Unlock()
+	total := s.Series
+	for _, other := range metricSets {
+		total += other.Series
+	}
+	if combinations > maxSyntheticSeries || total > maxSyntheticSeries {
+		http.Error(w, fmt.Sprintf("The synthetic metrics would exceed %d series.", maxSyntheticSeries), http.StatusBadRequest)
+		return
+	}
+	if _, ok := metricSets[s.Name]; ok {
+		http.Error(w, fmt.Sprintf("Metric set %s already exists.", s.Name), http.StatusConflict)
+		return
+	}
+	if err := s.register(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	metricSets[s.Name] = s
+	go s.run()
+
+	w.Header().Set("Location", "/metrics-gen/"+s.Name)
+	writeJSON(w, http.StatusCreated, s.snapshot())
+}
+
+// MetricSetHandler reports the synthetic metric set /metrics-gen/{name}
+// (GET), or unregisters its metrics (DELETE)
+func MetricSetHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/metrics-gen/"), "/")
+
+	metricSetsMu.Lock()
+	defer metricSetsMu.Unlock()
+	s, ok := metricSets[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Metric set %s not found.", name), http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, s.snapshot())
+	case "DELETE":
+		close(s.stop)
+		delete(metricSets, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
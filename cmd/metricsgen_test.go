@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsGenHandlerRejectsHugeCounts(t *testing.T) {
+	for _, query := range []string{
+		"counters=9223372036854775807&gauges=1&histograms=0",
+		"counters=-1",
+		"counters=4611686018427387904&gauges=4611686018427387904&histograms=0&labels=0",
+	} {
+		rec := httptest.NewRecorder()
+		MetricsGenHandler(rec, httptest.NewRequest("POST", "/metrics-gen?name=huge&"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", query, rec.Code)
+		}
+	}
+	if _, ok := metricSets["huge"]; ok {
+		t.Error("a set was registered")
+	}
+}
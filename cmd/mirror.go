@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MirrorSettings configures the shadowing of incoming requests to another backend
+type MirrorSettings struct {
+	URL     string  `json:"url"`
+	Percent float64 `json:"percent"`
+}
+
+const (
+	mirroredHeader = "X-Dummybox-Mirrored"
+	// largest request body copied to the mirror
+	maxMirroredBody = 1 << 20
+)
+
+var (
+	mirrorTarget  *url.URL
+	mirrorPercent float64
+	mirrorClient  = newOutboundClient(5 * time.Second)
+
+	mirrorRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "mirror_requests_total",
+		Help:      "Requests mirrored to the secondary backend by result: status class (2xx, 5xx...) or error.",
+	}, []string{"result"})
+	mirrorDuration = promauto.With(Registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "mirror_request_duration_seconds",
+		Help:      "Duration of the mirrored requests.",
+	})
+)
+
+// SetMirror configures the mirroring, an empty URL disables it
+func SetMirror(s MirrorSettings) error {
+	if s.URL == "" {
+		mirrorTarget = nil
+		return nil
+	}
+	target, err := url.Parse(s.URL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("invalid mirror url %q", s.URL)
+	}
+	if s.Percent < 0 || s.Percent > 100 {
+		return fmt.Errorf("invalid mirror percent %v, it must be between 0 and 100", s.Percent)
+	}
+	mirrorTarget = target
+	mirrorPercent = s.Percent
+	return nil
+}
+
+// MirrorMiddleware sends a copy of a share of the requests to the mirror in
+// the background, the response to the client never depends on the mirror
+func MirrorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// never mirror a mirrored request, the mirror may be another dummybox
+		if mirrorTarget == nil || r.Header.Get(mirroredHeader) != "" || requestRand(r).Float64()*100 >= mirrorPercent {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxMirroredBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+		mirror, err := http.NewRequest(r.Method, mirrorTarget.JoinPath(r.URL.Path).String(), bytes.NewReader(body))
+		if err == nil {
+			mirror.URL.RawQuery = r.URL.RawQuery
+			mirror.Header = r.Header.Clone()
+			mirror.Header.Set(mirroredHeader, "true")
+			go sendMirror(mirror)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sendMirror(req *http.Request) {
+	start := time.Now()
+	resp, err := mirrorClient.Do(req)
+	mirrorDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		mirrorRequests.WithLabelValues("error").Inc()
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	mirrorRequests.WithLabelValues(fmt.Sprintf("%dxx", resp.StatusCode/100)).Inc()
+}
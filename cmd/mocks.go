@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MockRequest selects the requests a mock answers, every condition set must match
+type MockRequest struct {
+	// exact path, or a prefix when it ends with *
+	Path string `json:"path"`
+	// any method when empty
+	Method string `json:"method,omitempty"`
+	// request headers with their exact value
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// MockResponse is the canned response of a mock
+type MockResponse struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// body sent as application/json, instead of Body
+	JSON  json.RawMessage `json:"json,omitempty"`
+	Delay Duration        `json:"delay,omitempty"`
+}
+
+// Mock maps the matching requests to a canned response, standing in for an
+// upstream service
+type Mock struct {
+	Name     string       `json:"name"`
+	Request  MockRequest  `json:"request"`
+	Response MockResponse `json:"response"`
+	// requests answered by the mock
+	Hits int64 `json:"hits"`
+}
+
+var (
+	mocksMu sync.Mutex
+	mocks   []*Mock
+
+	mockRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "mock_requests_total",
+		Help:      "Requests answered by a mock, by mock name.",
+	}, []string{"mock"})
+)
+
+func (m *Mock) validate() error {
+	if m.Name == "" {
+		return errors.New("a mock needs a name")
+	}
+	if !strings.HasPrefix(m.Request.Path, "/") {
+		return fmt.Errorf("invalid mock %q: path must start with /", m.Name)
+	}
+	if strings.HasPrefix(m.Request.Path, "/mocks") {
+		return fmt.Errorf("invalid mock %q: /mocks is reserved for the admin API", m.Name)
+	}
+	if s := m.Response.Status; s != 0 && (s < 100 || s > 599) {
+		return fmt.Errorf("invalid mock %q: %d is not an HTTP status code", m.Name, s)
+	}
+	if len(m.Response.JSON) > 0 && !json.Valid(m.Response.JSON) {
+		return fmt.Errorf("invalid mock %q: json is not valid JSON", m.Name)
+	}
+	return nil
+}
+
+// SetMocks validates and replaces the mocks
+func SetMocks(list []Mock) error {
+	added := make([]*Mock, 0, len(list))
+	for i := range list {
+		m := list[i]
+		if err := m.validate(); err != nil {
+			return err
+		}
+		m.Hits = 0
+		added = append(added, &m)
+	}
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	mocks = added
+	return nil
+}
+
+// add the mock, replacing the one with the same name
+func putMock(m Mock) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	m.Hits = 0
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	for i := range mocks {
+		if mocks[i].Name == m.Name {
+			mocks[i] = &m
+			return nil
+		}
+	}
+	mocks = append(mocks, &m)
+	return nil
+}
+
+// copy of the mocks, in matching order
+func listMocks() []Mock {
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	list := make([]Mock, 0, len(mocks))
+	for _, m := range mocks {
+		list = append(list, *m)
+	}
+	return list
+}
+
+// matches reports whether the request fulfils every condition of the mock
+func (m MockRequest) matches(r *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(m.Path, "*"); ok {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	} else if r.URL.Path != m.Path {
+		return false
+	}
+	for key, value := range m.Headers {
+		if r.Header.Get(key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// find the first mock matching the request and count the hit
+func matchMock(r *http.Request) (Mock, bool) {
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	for _, m := range mocks {
+		if m.Request.matches(r) {
+			m.Hits++
+			return *m, true
+		}
+	}
+	return Mock{}, false
+}
+
+// MockMiddleware answers the requests matching a mock with its canned
+// response, the other ones reach the regular endpoints. The admin API under
+// /mocks is never mocked, a catch-all mock cannot lock it out
+func MockMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pathWithin(r.URL.Path, "/mocks") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m, ok := matchMock(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mockRequests.WithLabelValues(m.Name).Inc()
+
+		select {
+		case <-time.After(time.Duration(m.Response.Delay)):
+		case <-r.Context().Done():
+			return
+		}
+
+		status := m.Response.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if len(m.Response.JSON) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		for key, value := range m.Response.Headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(status)
+		if len(m.Response.JSON) > 0 {
+			w.Write(m.Response.JSON)
+			return
+		}
+		io.WriteString(w, m.Response.Body)
+	})
+}
+
+// MocksHandler lists (GET), adds or replaces by name (POST) or removes (DELETE)
+// the mocks. POST takes a single mock or an array of them
+func MocksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var list []Mock
+		if err := json.Unmarshal(body, &list); err != nil {
+			var m Mock
+			if err := json.Unmarshal(body, &m); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			list = []Mock{m}
+		}
+		for _, m := range list {
+			if err := m.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, m := range list {
+			putMock(m)
+		}
+	case "DELETE":
+		SetMocks(nil)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, listMocks())
+}
+
+// MockHandler shows (GET) or removes (DELETE) the mock /mocks/{name}
+func MockHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/mocks/")
+	mocksMu.Lock()
+	index := -1
+	for i, m := range mocks {
+		if m.Name == name {
+			index = i
+		}
+	}
+	if index < 0 {
+		mocksMu.Unlock()
+		http.Error(w, "Mock not found.", http.StatusNotFound)
+		return
+	}
+	m := *mocks[index]
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		mocks = append(mocks[:index:index], mocks[index+1:]...)
+	default:
+		mocksMu.Unlock()
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	mocksMu.Unlock()
+	writeJSON(w, http.StatusOK, m)
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMockMiddlewareSkipsAdminAPI(t *testing.T) {
+	defer SetMocks(nil)
+	if err := SetMocks([]Mock{{Name: "all", Request: MockRequest{Path: "/*"}, Response: MockResponse{Status: http.StatusTeapot}}}); err != nil {
+		t.Fatal(err)
+	}
+	h := MockMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for path, want := range map[string]int{"/anything": http.StatusTeapot, "/mocks": http.StatusOK, "/mocks/all": http.StatusOK} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: got status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
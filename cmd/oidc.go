@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OIDCClient is a client of the fake OpenID Connect provider. A client
+// without secret is public, without redirect URIs it may redirect anywhere
+type OIDCClient struct {
+	ID           string   `json:"id"`
+	Secret       string   `json:"secret,omitempty"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+}
+
+// OIDCConfiguration is the discovery document of the provider
+type OIDCConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// authorization code waiting to be exchanged at the token endpoint
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	subject       string
+	nonce         string
+	scope         string
+	challenge     string
+	method        string
+	authenticated time.Time
+	expires       time.Time
+}
+
+const (
+	authCodeTTL  = time.Minute
+	oidcTokenTTL = time.Hour
+)
+
+var (
+	oidcMu      sync.Mutex
+	oidcClients []OIDCClient
+	authCodes   = make(map[string]*authCode)
+
+	oidcTokens = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "oidc_tokens_total",
+		Help:      "Tokens issued by the OIDC token endpoint by grant type.",
+	}, []string{"grant_type"})
+)
+
+// SetOIDCClients registers the clients of the provider, any client is
+// accepted when there are none
+func SetOIDCClients(list []OIDCClient) error {
+	for _, c := range list {
+		if c.ID == "" {
+			return errors.New("oidc client without id")
+		}
+	}
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	oidcClients = list
+	return nil
+}
+
+// the client with the id, a public one when no client is registered
+func oidcClient(id string) (OIDCClient, bool) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if len(oidcClients) == 0 {
+		return OIDCClient{ID: id}, id != ""
+	}
+	for _, c := range oidcClients {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return OIDCClient{}, false
+}
+
+// issuer of the tokens, the configured one or the URL the provider is reached at
+func oidcIssuer(r *http.Request) string {
+	if jwtSettings.Issuer != "" {
+		return jwtSettings.Issuer
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// OIDCConfigurationHandler serves the discovery document of the provider
+func OIDCConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := oidcIssuer(r)
+	base := strings.TrimSuffix(issuer, "/")
+	writeJSON(w, http.StatusOK, OIDCConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             base + "/authorize",
+		TokenEndpoint:                     base + "/token",
+		JWKSURI:                           base + "/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ScopesSupported:                   []string{"openid", "profile", "email"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "name", "email"},
+		CodeChallengeMethodsSupported:     []string{"S256", "plain"},
+	})
+}
+
+// AuthorizeHandler approves every authorization request without a login
+// page: it redirects to the redirect_uri with a code for the user of
+// login_hint (dummybox by default) and the state
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	client, ok := oidcClient(q.Get("client_id"))
+	if !ok {
+		http.Error(w, "Unknown client_id.", http.StatusBadRequest)
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if err != nil || !target.IsAbs() {
+		http.Error(w, "Expected an absolute redirect_uri.", http.StatusBadRequest)
+		return
+	}
+	if len(client.RedirectURIs) > 0 && !slices.Contains(client.RedirectURIs, redirectURI) {
+		http.Error(w, "redirect_uri is not registered for the client.", http.StatusBadRequest)
+		return
+	}
+
+	// the other errors are reported to the client through the redirect
+	params := target.Query()
+	if state := q.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	method := q.Get("code_challenge_method")
+	if q.Get("code_challenge") != "" && method == "" {
+		method = "plain"
+	}
+	switch {
+	case q.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+		params.Set("error_description", "only the code response type is supported")
+	case method != "" && method != "S256" && method != "plain":
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "code_challenge_method must be S256 or plain")
+	default:
+		subject := q.Get("login_hint")
+		if subject == "" {
+			subject = "dummybox"
+		}
+		code := newID()
+		now := time.Now()
+		oidcMu.Lock()
+		for k, c := range authCodes {
+			if now.After(c.expires) {
+				delete(authCodes, k)
+			}
+		}
+		authCodes[code] = &authCode{
+			clientID:      client.ID,
+			redirectURI:   redirectURI,
+			subject:       subject,
+			nonce:         q.Get("nonce"),
+			scope:         q.Get("scope"),
+			challenge:     q.Get("code_challenge"),
+			method:        method,
+			authenticated: Now(),
+			expires:       now.Add(authCodeTTL),
+		}
+		oidcMu.Unlock()
+		params.Set("code", code)
+	}
+	target.RawQuery = params.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// take the authorization code, it can be exchanged only once
+func takeAuthCode(code string) (*authCode, bool) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	c, ok := authCodes[code]
+	delete(authCodes, code)
+	if !ok || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return c, true
+}
+
+// check the code verifier against the challenge of the authorization request
+func verifyCodeChallenge(c *authCode, verifier string) bool {
+	switch c.method {
+	case "":
+		return true
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		return verifier != "" && base64.RawURLEncoding.EncodeToString(sum[:]) == c.challenge
+	}
+	return verifier != "" && verifier == c.challenge
+}
+
+// oauthTokenHandler is the token endpoint of the provider, for the
+// client_credentials and authorization_code grants of the form
+func oauthTokenHandler(w http.ResponseWriter, r *http.Request, form url.Values) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = form.Get("client_id"), form.Get("client_secret")
+	}
+	client, ok := oidcClient(id)
+	if !ok || subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) != 1 {
+		if basic {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", authRealm))
+		}
+		writeJSON(w, http.StatusUnauthorized, oauthError{Error: "invalid_client", Description: "unknown client or wrong secret"})
+		return
+	}
+
+	grantType := form.Get("grant_type")
+	claims := defaultClaims(oidcTokenTTL)
+	claims["iss"] = oidcIssuer(r)
+	claims["client_id"] = client.ID
+	if _, ok := claims["aud"]; !ok {
+		claims["aud"] = client.ID
+	}
+	var code *authCode
+	switch grantType {
+	case "client_credentials":
+		claims["sub"] = client.ID
+		if scope := form.Get("scope"); scope != "" {
+			claims["scope"] = scope
+		}
+	case "authorization_code":
+		code, ok = takeAuthCode(form.Get("code"))
+		if !ok || code.clientID != client.ID || code.redirectURI != form.Get("redirect_uri") {
+			writeJSON(w, http.StatusBadRequest, oauthError{Error: "invalid_grant", Description: "unknown, expired or used code, or another client or redirect_uri"})
+			return
+		}
+		if !verifyCodeChallenge(code, form.Get("code_verifier")) {
+			writeJSON(w, http.StatusBadRequest, oauthError{Error: "invalid_grant", Description: "code_verifier does not match the code_challenge"})
+			return
+		}
+		claims["sub"] = code.subject
+		if code.scope != "" {
+			claims["scope"] = code.scope
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, oauthError{Error: "unsupported_grant_type", Description: "grant_type must be authorization_code or client_credentials"})
+		return
+	}
+
+	resp := TokenResponse{TokenType: "Bearer", ExpiresIn: int64(oidcTokenTTL.Seconds())}
+	resp.Scope, _ = claims["scope"].(string)
+	var err error
+	if resp.AccessToken, err = mintJWT("RS256", claims); err != nil {
+		writeJSON(w, http.StatusInternalServerError, oauthError{Error: "server_error", Description: err.Error()})
+		return
+	}
+	if code != nil && slices.Contains(strings.Fields(code.scope), "openid") {
+		idClaims := map[string]any{
+			"iss":       claims["iss"],
+			"sub":       code.subject,
+			"aud":       client.ID,
+			"iat":       claims["iat"],
+			"exp":       claims["exp"],
+			"auth_time": code.authenticated.Unix(),
+			"name":      code.subject,
+			"email":     code.subject + "@dummybox.local",
+		}
+		if code.nonce != "" {
+			idClaims["nonce"] = code.nonce
+		}
+		if resp.IDToken, err = mintJWT("RS256", idClaims); err != nil {
+			writeJSON(w, http.StatusInternalServerError, oauthError{Error: "server_error", Description: err.Error()})
+			return
+		}
+	}
+	oidcTokens.WithLabelValues(grantType).Inc()
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// OutboundSettings changes how the outbound client features (probers, mirror,
+// self test) resolve host names, without touching the container resolver
+type OutboundSettings struct {
+	// host name to IP address, like an /etc/hosts file
+	HostOverrides map[string]string `json:"host_overrides,omitempty"`
+	// DNS servers (host:port) queried instead of the system ones
+	DNSServers []string `json:"dns_servers,omitempty"`
+}
+
+var (
+	hostOverrides    map[string]string
+	outboundResolver = net.DefaultResolver
+	outboundDialer   = &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+)
+
+// SetOutbound validates and applies the host overrides and DNS servers
+func SetOutbound(s OutboundSettings) error {
+	overrides := make(map[string]string)
+	for host, ip := range s.HostOverrides {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid host override %s=%s: not an IP address", host, ip)
+		}
+		overrides[strings.ToLower(host)] = ip
+	}
+	hostOverrides = overrides
+
+	if len(s.DNSServers) == 0 {
+		outboundResolver = net.DefaultResolver
+		outboundDialer.Resolver = nil
+		return nil
+	}
+	servers := make([]string, len(s.DNSServers))
+	for i, server := range s.DNSServers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		servers[i] = server
+	}
+	var next atomic.Uint64
+	outboundResolver = &net.Resolver{
+		PreferGo: true,
+		// query the configured servers in turn
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := servers[next.Add(1)%uint64(len(servers))]
+			return (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, network, server)
+		},
+	}
+	outboundDialer.Resolver = outboundResolver
+	return nil
+}
+
+// outboundLookup resolves the host through the overrides first, then the outbound resolver
+func outboundLookup(ctx context.Context, host string) ([]string, error) {
+	if ip, ok := hostOverrides[strings.ToLower(host)]; ok {
+		return []string{ip}, nil
+	}
+	return outboundResolver.LookupHost(ctx, host)
+}
+
+// outboundDial connects to addr, replacing overridden host names by their IP address
+func outboundDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip, ok := hostOverrides[strings.ToLower(host)]; ok {
+			addr = net.JoinHostPort(ip, port)
+		}
+	}
+	return outboundDialer.DialContext(ctx, network, addr)
+}
+
+// outboundClient is shared by the handlers calling other services, reusing
+// its connections. The timeout of a call is on the context of its request
+var outboundClient = newOutboundClient(0)
+
+// newOutboundClient returns an HTTP client resolving host names like the
+// outbound settings say, TLS still verifies the original host name
+func newOutboundClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = outboundDial
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var panicsRecovered = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+	Namespace: "samplebox",
+	Name:      "panics_recovered_total",
+	Help:      "Panics in request handlers recovered into a 500 response.",
+})
+
+// RecoverMiddleware turns a panic in a handler into a 500 response and an
+// error log with the stack, instead of an aborted connection. A response
+// already started cannot become a 500, it is aborted after the log
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &StatusRecorder{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// the server aborts the response silently on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			panicsRecovered.Inc()
+			attrs := append(logAttrs(w.Header()), "panic", fmt.Sprint(err), "path", r.URL.Path, "stack", string(debug.Stack()))
+			slog.Error("panic recovered", attrs...)
+			if rec.Status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// PanicHandler panics in the request goroutine, recovered into a 500, or with
+// background=true in a new goroutine after delay, crashing the whole process
+func PanicHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	message := r.URL.Query().Get("message")
+	if message == "" {
+		message = "panic requested on /panic"
+	}
+	if r.URL.Query().Get("background") != "true" {
+		panic(message)
+	}
+
+	delay, err := queryDuration(r, "delay", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	go func() {
+		time.Sleep(delay)
+		panic(message)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "The process panics in %s.\n", delay)
+}
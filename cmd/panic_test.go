@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	h := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("panic before the response: got status %d, want 500", rec.Code)
+	}
+}
+
+func TestRecoverMiddlewareStartedResponse(t *testing.T) {
+	h := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("panic after the response started: got %v, want http.ErrAbortHandler", err)
+		}
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("got status %d rewritten, want 202", rec.Code)
+		}
+	}()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// get an integer query parameter, or the default when it is not set
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q is not an integer", name, v)
+	}
+	return n, nil
+}
+
+// get a duration query parameter such as "500ms", or the default when it is not set
+func queryDuration(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q is not a duration", name, v)
+	}
+	return d, nil
+}
+
+// get a finite float query parameter, or the default when it is not set
+func queryFloat(r *http.Request, name string, def float64) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid %s: %q is not a number", name, v)
+	}
+	return f, nil
+}
+
+// SplitList splits a comma separated list, ignoring empty items
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// get the repeated "Name: value" query parameters as headers
+func queryHeaders(r *http.Request, name string) (http.Header, error) {
+	h := http.Header{}
+	for _, v := range r.URL.Query()[name] {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s: %q is not written as Name: value", name, v)
+		}
+		h.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	return h, nil
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryDuration(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  time.Duration
+		valid bool
+	}{
+		{"", time.Second, true},
+		{"d=500ms", 500 * time.Millisecond, true},
+		{"d=1h30m", 90 * time.Minute, true},
+		{"d=-2s", -2 * time.Second, true},
+		{"d=5", 0, false},
+		{"d=soon", 0, false},
+	} {
+		got, err := queryDuration(httptest.NewRequest("GET", "/?"+tc.query, nil), "d", time.Second)
+		if (err == nil) != tc.valid || got != tc.want {
+			t.Errorf("queryDuration(%q) = %v, %v", tc.query, got, err)
+		}
+	}
+}
+
+func TestQueryIntAndFloat(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?n=42&f=0.5&bad=x", nil)
+	if n, err := queryInt(r, "n", 1); n != 42 || err != nil {
+		t.Errorf("queryInt(n) = %d, %v, want 42", n, err)
+	}
+	if n, err := queryInt(r, "missing", 7); n != 7 || err != nil {
+		t.Errorf("queryInt(missing) = %d, %v, want the default 7", n, err)
+	}
+	if _, err := queryInt(r, "f", 1); err == nil {
+		t.Error("queryInt of a float succeeded")
+	}
+	if f, err := queryFloat(r, "f", 1); f != 0.5 || err != nil {
+		t.Errorf("queryFloat(f) = %v, %v, want 0.5", f, err)
+	}
+	if _, err := queryFloat(r, "bad", 1); err == nil {
+		t.Error("queryFloat of a word succeeded")
+	}
+	for _, v := range []string{"NaN", "nan", "Inf", "-Inf", "1e400"} {
+		if f, err := queryFloat(httptest.NewRequest("GET", "/?f="+v, nil), "f", 1); err == nil {
+			t.Errorf("queryFloat(%s) = %v, want an error", v, f)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{" a , b ,,c, ", []string{"a", "b", "c"}},
+	} {
+		if got := SplitList(tc.in); !slices.Equal(got, tc.want) {
+			t.Errorf("SplitList(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestQueryHeaders(t *testing.T) {
+	h, err := queryHeaders(httptest.NewRequest("GET", "/?header=X-A:+1&header=X-A:2&header=X-B:+b", nil), "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Values("X-A"); !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("X-A = %q, want 1 and 2", got)
+	}
+	if got := h.Get("X-B"); got != "b" {
+		t.Errorf("X-B = %q, want b", got)
+	}
+	if _, err := queryHeaders(httptest.NewRequest("GET", "/?header=novalue", nil), "header"); err == nil {
+		t.Error("header without a colon accepted")
+	}
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxPayloadSize   = 1 << 30
+	payloadChunkSize = 32 << 10
+	lorem            = "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. "
+)
+
+// most ranges served from a payload, a request with more is answered with
+// the whole body
+const maxPayloadRanges = 16
+
+// Last-Modified of the payloads, a new instance serves them as modified
+var payloadModified = time.Now().Truncate(time.Second)
+
+var payloadContentTypes = map[string]string{
+	"zeros":  "application/octet-stream",
+	"random": "application/octet-stream",
+	"lorem":  "text/plain; charset=utf-8",
+	"json":   "application/json",
+}
+
+// parse a size such as 512, 10KB or 1.5MB, the units are multiples of 1024 bytes
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		bytes  float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, multiplier = strings.TrimSuffix(upper, u.suffix), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || math.IsNaN(n) || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected bytes or a number with a B, KB, MB or GB unit", s)
+	}
+	// an infinite size is caught here too
+	if n*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q, it is too large", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// repeat reads the pattern over and over
+type repeatReader struct {
+	pattern []byte
+	offset  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.pattern[r.offset:])
+		n += c
+		r.offset = (r.offset + c) % len(r.pattern)
+	}
+	return n, nil
+}
+
+// jsonArrayReader reads a JSON array of exactly size bytes, padded with spaces
+// before the closing bracket
+type jsonArrayReader struct {
+	size    int64
+	read    int64
+	next    int
+	pending []byte
+}
+
+func (r *jsonArrayReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && r.read < r.size {
+		if len(r.pending) == 0 {
+			r.pending = r.item()
+		}
+		c := copy(p[n:], r.pending)
+		r.pending = r.pending[c:]
+		n += c
+		r.read += int64(c)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// a JSON array of size bytes read from the offset, the items before it are
+// counted instead of written
+func newJSONArrayReader(size, offset int64) *jsonArrayReader {
+	r := &jsonArrayReader{size: size, read: offset}
+	if offset == 0 {
+		return r
+	}
+	// after the opening bracket, skip the items ending before the offset: the
+	// first one, then the ones of each number of digits, have the same length
+	pos, next := int64(1), 0
+	for end := 1; ; end = max(10, end*10) {
+		length := int64(len(jsonArrayItem(next)))
+		count := int64(end - next)
+		skip := min(count, (offset-pos)/length, (size-1-pos)/length)
+		pos, next = pos+skip*length, next+int(skip)
+		if skip < count {
+			break
+		}
+	}
+	if length := int64(len(jsonArrayItem(next))); pos+length <= size-1 {
+		r.pending, r.next = jsonArrayItem(next)[offset-pos:], next+1
+	} else if offset < size-1 {
+		r.pending = bytes.Repeat([]byte(" "), int(size-1-offset))
+	}
+	return r
+}
+
+// the item of the index with its leading comma
+func jsonArrayItem(i int) []byte {
+	item := fmt.Sprintf(`{"id":%d,"text":"%s"}`, i, strings.TrimSpace(lorem))
+	if i > 0 {
+		item = "," + item
+	}
+	return []byte(item)
+}
+
+// the next piece of the array, given the bytes still to be written
+func (r *jsonArrayReader) item() []byte {
+	left := r.size - r.read
+	if r.read == 0 {
+		return []byte("[")
+	}
+	if left == 1 {
+		return []byte("]")
+	}
+	item := jsonArrayItem(r.next)
+	// keep room for the closing bracket, pad when the next item does not fit
+	if int64(len(item)) > left-1 {
+		return bytes.Repeat([]byte(" "), int(left-1))
+	}
+	r.next++
+	return item
+}
+
+// payloadSeeker reads a payload from any offset, opening it again at the
+// offset of a seek
+type payloadSeeker struct {
+	open   func(offset int64) io.Reader
+	size   int64
+	offset int64
+	r      io.Reader
+	read   int64
+}
+
+func (s *payloadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative payload offset")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+func (s *payloadSeeker) Read(p []byte) (int, error) {
+	if s.r == nil || s.read != s.offset {
+		s.r, s.read = s.open(s.offset), s.offset
+	}
+	n, err := s.r.Read(p)
+	s.read += int64(n)
+	s.offset += int64(n)
+	return n, err
+}
+
+// reader of the size bytes of the content from the offset. The random bytes
+// of the seed before the offset are generated and skipped, the other contents
+// start at the offset directly
+func payloadReader(content string, size, offset, seed int64) io.Reader {
+	left := max(0, size-offset)
+	switch content {
+	case "random":
+		r := io.LimitReader(rand.New(rand.NewSource(seed)), size)
+		io.CopyN(io.Discard, r, offset)
+		return r
+	case "lorem":
+		return io.LimitReader(&repeatReader{pattern: []byte(lorem), offset: int(offset % int64(len(lorem)))}, left)
+	case "json":
+		return newJSONArrayReader(size, offset)
+	default:
+		return io.LimitReader(&repeatReader{pattern: make([]byte, payloadChunkSize)}, left)
+	}
+}
+
+// drop the Range header of a request with more than the ranges allowed, it is
+// answered with the whole body
+func limitRanges(r *http.Request, allowed int) {
+	if v := r.Header.Get("Range"); v != "" && strings.Count(v, ",") >= allowed {
+		r.Header.Del("Range")
+	}
+}
+
+// parse the size (default 1KB) and content (default zeros) parameters of a
+// payload
+func payloadParams(r *http.Request) (int64, string, error) {
+	size := int64(1 << 10)
+	if v := r.URL.Query().Get("size"); v != "" {
+		var err error
+		if size, err = parseSize(v); err != nil {
+			return 0, "", err
+		}
+	}
+	if size > maxPayloadSize {
+		return 0, "", errors.New("size must be at most 1GB")
+	}
+	content := r.URL.Query().Get("content")
+	if content == "" {
+		content = "zeros"
+	}
+	if _, ok := payloadContentTypes[content]; !ok {
+		return 0, "", errors.New("content must be zeros, random, lorem or json")
+	}
+	if content == "json" && size < 2 {
+		return 0, "", errors.New("a json payload needs a size of at least 2 bytes")
+	}
+	return size, content, nil
+}
+
+// PayloadHandler answers with a body of exactly size bytes (default 1KB) of
+// content: zeros (default), random, lorem or json. It serves the Range,
+// If-Range and conditional requests with its ETag and Last-Modified, unless
+// stream=true sends the body chunked and flushed every 32KB instead. rate caps
+// the bytes written per second
+func PayloadHandler(w http.ResponseWriter, r *http.Request) {
+	size, content, err := payloadParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := payloadContentTypes[content]
+	rate, err := queryRate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w = throttle(w, r, rate)
+
+	// a source of its own, reading is not safe on the shared one
+	seed := requestRand(r).Int63()
+	open := func(offset int64) io.Reader { return payloadReader(content, size, offset, seed) }
+	w.Header().Set("Content-Type", contentType)
+	if r.URL.Query().Get("stream") != "true" {
+		// the same payload has the same ETag, a random one only with its seed
+		etag := fmt.Sprintf(`"%s-%d"`, content, size)
+		if content == "random" {
+			etag = fmt.Sprintf(`"%s-%d-%x"`, content, size, seed)
+		}
+		w.Header().Set("ETag", etag)
+		// every range of random bytes generates them again from the start
+		if content == "random" {
+			limitRanges(r, 1)
+		} else {
+			limitRanges(r, maxPayloadRanges)
+		}
+		http.ServeContent(w, r, "", payloadModified, &payloadSeeker{open: open, size: size})
+		return
+	}
+	body := open(0)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported.", http.StatusInternalServerError)
+		return
+	}
+	buf := make([]byte, payloadChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
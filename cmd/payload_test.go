@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"10KB", 10 << 10},
+		{"10kb", 10 << 10},
+		{"1.5MB", 3 << 19},
+		{" 2 GB ", 2 << 30},
+	} {
+		got, err := parseSize(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", "abc", "-1", "10XB", "KB", "NaN", "Inf", "+InfKB", "1e19", "9e9GB"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestPayloadParams(t *testing.T) {
+	for _, tc := range []struct {
+		query   string
+		size    int64
+		content string
+		valid   bool
+	}{
+		{"", 1 << 10, "zeros", true},
+		{"size=10KB&content=lorem", 10 << 10, "lorem", true},
+		{"size=2GB", 0, "", false},
+		{"size=NaN", 0, "", false},
+		{"size=1e19", 0, "", false},
+		{"content=pdf", 0, "", false},
+		{"size=1&content=json", 0, "", false},
+	} {
+		size, content, err := payloadParams(httptest.NewRequest("GET", "/payload?"+tc.query, nil))
+		if (err == nil) != tc.valid || size != tc.size || content != tc.content {
+			t.Errorf("payloadParams(%q) = %d, %q, %v", tc.query, size, content, err)
+		}
+	}
+}
+
+func TestPayloadReaderOffset(t *testing.T) {
+	for _, content := range []string{"zeros", "random", "lorem", "json"} {
+		for _, size := range []int64{2, 100, 1000, 5000, 200000} {
+			whole, _ := io.ReadAll(payloadReader(content, size, 0, 1))
+			if int64(len(whole)) != size {
+				t.Fatalf("%s of %d bytes: read %d bytes", content, size, len(whole))
+			}
+			for offset := int64(0); offset <= size; offset += max(1, size/1000) {
+				got, _ := io.ReadAll(payloadReader(content, size, offset, 1))
+				if !bytes.Equal(got, whole[offset:]) {
+					t.Fatalf("%s of %d bytes from %d: got %q, want %q", content, size, offset, got, whole[offset:])
+				}
+			}
+		}
+	}
+}
+
+func TestPayloadHandlerRanges(t *testing.T) {
+	for _, tc := range []struct {
+		query, ranges string
+		want          int
+	}{
+		{"content=lorem", "bytes=0-9", http.StatusPartialContent},
+		{"content=lorem", "bytes=0-1,4-5,8-9", http.StatusPartialContent},
+		{"content=lorem", "bytes=" + strings.Repeat("0-1,", maxPayloadRanges) + "2-3", http.StatusOK},
+		{"content=random", "bytes=0-9", http.StatusPartialContent},
+		{"content=random", "bytes=0-1,4-5", http.StatusOK},
+		{"content=json", "bytes=2000-", http.StatusRequestedRangeNotSatisfiable},
+	} {
+		req := httptest.NewRequest("GET", "/payload?"+tc.query, nil)
+		req.Header.Set("Range", tc.ranges)
+		rec := httptest.NewRecorder()
+		PayloadHandler(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s with %s: got status %d, want %d", tc.query, tc.ranges, rec.Code, tc.want)
+		}
+	}
+}
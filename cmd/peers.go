@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// PeerSettings tells how the replicas of a cluster of dummybox find each other
+type PeerSettings struct {
+	// host:port of the peers
+	Static []string `json:"static,omitempty"`
+	// host:port where the host resolves to every replica, such as a headless Service
+	DNS string `json:"dns,omitempty"`
+	// time between two background latency measurements, 0 disables them
+	Interval Duration `json:"interval,omitempty"`
+}
+
+type Peer struct {
+	Address  string   `json:"address"`
+	Version  string   `json:"version,omitempty"`
+	Instance string   `json:"instance,omitempty"`
+	Node     string   `json:"node,omitempty"`
+	Zone     string   `json:"zone,omitempty"`
+	Latency  Duration `json:"latency"`
+	Error    string   `json:"error,omitempty"`
+}
+
+var (
+	peerSettings PeerSettings
+	peerClient   = newOutboundClient(5 * time.Second)
+
+	peerUp = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "peer_up",
+		Help:      "Whether the peer answered the last latency measurement.",
+	}, []string{"peer"})
+	peerLatency = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "peer_latency_seconds",
+		Help:      "Round trip time of the requests to the peers.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+	}, []string{"peer"})
+)
+
+// SetPeers validates the peer settings and starts the background latency
+// measurements when an interval is set
+func SetPeers(s PeerSettings) error {
+	for _, addr := range append(s.Static, s.DNS) {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid peer %q: %w", addr, err)
+		}
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("invalid peers interval %v, it must not be negative", s.Interval)
+	}
+	peerSettings = s
+	if s.Interval > 0 && (len(s.Static) > 0 || s.DNS != "") {
+		go func() {
+			var known map[string]bool
+			for range time.Tick(time.Duration(s.Interval)) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.Interval))
+				peers, err := discoverPeers(ctx)
+				if err != nil {
+					log.Default().Printf("Peer discovery: %v", err)
+				}
+				known = recordPeers(measurePeers(ctx, peers), known)
+				cancel()
+			}
+		}()
+	}
+	return nil
+}
+
+// recordPeers exports the measurements of the peers and drops the series of
+// the known peers gone since, it returns the peers now known
+func recordPeers(peers []Peer, known map[string]bool) map[string]bool {
+	current := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		current[p.Address] = true
+		up := 0.0
+		if p.Error == "" {
+			up = 1
+			peerLatency.WithLabelValues(p.Address).Observe(time.Duration(p.Latency).Seconds())
+		}
+		peerUp.WithLabelValues(p.Address).Set(up)
+	}
+	for addr := range known {
+		if !current[addr] {
+			peerUp.DeleteLabelValues(addr)
+			peerLatency.DeleteLabelValues(addr)
+		}
+	}
+	return current
+}
+
+// discoverPeers lists the static peers and the addresses the DNS name resolves to
+func discoverPeers(ctx context.Context) ([]string, error) {
+	peers := append([]string(nil), peerSettings.Static...)
+	if peerSettings.DNS == "" {
+		return peers, nil
+	}
+	host, port, _ := net.SplitHostPort(peerSettings.DNS)
+	addrs, err := outboundLookup(ctx, host)
+	if err != nil {
+		return peers, err
+	}
+	for _, addr := range addrs {
+		peers = append(peers, net.JoinHostPort(addr, port))
+	}
+	return peers, nil
+}
+
+// measurePeers asks every peer for its /version in parallel, leaving out this
+// instance when it is among them
+func measurePeers(ctx context.Context, addrs []string) []Peer {
+	peers := make([]Peer, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		i, addr := i, addr
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			peers[i] = measurePeer(ctx, addr)
+		}()
+	}
+	wg.Wait()
+
+	others := []Peer{}
+	for _, p := range peers {
+		if p.Instance != Instance.Name || p.Error != "" {
+			others = append(others, p)
+		}
+	}
+	sort.Slice(others, func(i, k int) bool { return others[i].Address < others[k].Address })
+	return others
+}
+
+func measurePeer(ctx context.Context, addr string) Peer {
+	p := Peer{Address: addr}
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+"/version", nil)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	start := time.Now()
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	defer resp.Body.Close()
+	var v VersionResponse
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	p.Latency = Duration(time.Since(start))
+	if err != nil {
+		p.Error = "not a dummybox: " + err.Error()
+		return p
+	}
+	p.Version, p.Instance, p.Node, p.Zone = v.Version, v.Instance.Name, v.Instance.Node, v.Instance.Zone
+	return p
+}
+
+// PeersHandler discovers the other replicas and reports their version, node
+// and latency, measured now
+func PeersHandler(w http.ResponseWriter, r *http.Request) {
+	if len(peerSettings.Static) == 0 && peerSettings.DNS == "" {
+		http.Error(w, "No peers configured, set --peers or --peers-dns.", http.StatusNotFound)
+		return
+	}
+	addrs, err := discoverPeers(r.Context())
+	if err != nil && len(addrs) == 0 {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, measurePeers(r.Context(), addrs))
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordPeersDropsGonePeers(t *testing.T) {
+	defer peerUp.Reset()
+	defer peerLatency.Reset()
+	known := recordPeers([]Peer{{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080", Error: "refused"}}, nil)
+	if n := testutil.CollectAndCount(peerUp); n != 2 {
+		t.Fatalf("got %d peer_up series, want 2", n)
+	}
+	recordPeers([]Peer{{Address: "10.0.0.1:8080"}}, known)
+	if n := testutil.CollectAndCount(peerUp); n != 1 {
+		t.Errorf("got %d peer_up series, want the gone peer dropped", n)
+	}
+	if n := testutil.CollectAndCount(peerLatency); n != 1 {
+		t.Errorf("got %d peer_latency series, want 1", n)
+	}
+}
@@ -2,7 +2,13 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type Position struct {
@@ -14,17 +20,48 @@ type Request struct {
 	Positions []Position `json:"positions"`
 }
 
+const (
+	maxPositionsBody = 1 << 20
+	maxPositionId    = 64
+)
+
+var (
+	positionsPage = parsePage("positions")
+
+	positionsRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "positions_requests_total",
+		Help:      "Requests to the positions sample business API by result.",
+	}, []string{"result"})
+	positionsReceived = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "positions_received_total",
+		Help:      "Positions received by the positions sample business API.",
+	})
+)
+
+// PositionsHandler is the sample business API: it merges the posted positions
+// with the same id and returns the totals as JSON, HTML or text
 func PositionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// only accept POST requests
 	if r.Method != "POST" {
+		positionsRequests.WithLabelValues("invalid").Inc()
 		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// decode the request JSON body into Positions struct and fail if any error occur
 	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPositionsBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		positionsRequests.WithLabelValues("invalid").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePositions(req.Positions); err != nil {
+		positionsRequests.WithLabelValues("invalid").Inc()
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -34,10 +71,45 @@ func PositionsHandler(w http.ResponseWriter, r *http.Request) {
 	for _, position := range req.Positions {
 		positions[position.Id] += position.Value
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	positionsRequests.WithLabelValues("ok").Inc()
+	positionsReceived.Add(float64(len(req.Positions)))
+
+	// return the positions in the requested format
+	switch responseFormat(r) {
+	case "html":
+		writeHTML(w, r, http.StatusOK, positionsPage, "positions", sortedPositions(positions))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		for _, position := range sortedPositions(positions) {
+			fmt.Fprintf(w, "%s %d\n", position.Id, position.Value)
+		}
+	default:
+		writeJSON(w, http.StatusOK, positions)
+	}
+}
 
-	// return the positions in JSON format
-	json.NewEncoder(w).Encode(positions)
+func validatePositions(positions []Position) error {
+	if len(positions) == 0 {
+		return errors.New("positions must not be empty")
+	}
+	for i, position := range positions {
+		if position.Id == "" {
+			return fmt.Errorf("position %d: id must not be empty", i)
+		}
+		if len(position.Id) > maxPositionId {
+			return fmt.Errorf("position %d: id must not be longer than %d characters", i, maxPositionId)
+		}
+	}
+	return nil
+}
 
+// merged positions sorted by id
+func sortedPositions(positions map[string]int) []Position {
+	sorted := make([]Position, 0, len(positions))
+	for id, value := range positions {
+		sorted = append(sorted, Position{Id: id, Value: value})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	return sorted
 }
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+)
+
+// ProfileSettings enables the block and mutex profiles, which cost too much
+// to be always on
+type ProfileSettings struct {
+	// one blocking event sampled per BlockRate nanoseconds spent blocked, 0 disables the profile
+	BlockRate int `json:"block_rate"`
+	// one mutex contention event sampled out of MutexFraction, 0 disables the profile
+	MutexFraction int `json:"mutex_fraction"`
+}
+
+// SetProfiling applies the sampling rates of the block and mutex profiles
+func SetProfiling(s ProfileSettings) {
+	runtime.SetBlockProfileRate(s.BlockRate)
+	runtime.SetMutexProfileFraction(s.MutexFraction)
+}
+
+// PprofHandler serves the runtime profiles under /debug/pprof/: the index,
+// profile (CPU), heap, goroutine, block, mutex, allocs, threadcreate, trace,
+// cmdline and symbol
+func PprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// HeapDumpHandler downloads the heap profile, after a garbage collection with
+// gc=true, to open with go tool pprof
+func HeapDumpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("gc") == "true" {
+		runtime.GC()
+	}
+	name := fmt.Sprintf("heap-%s-%s.pprof", Instance.Name, Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if err := rpprof.Lookup("heap").WriteTo(w, 0); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GoroutinesHandler writes the stack of every goroutine, in the format of an
+// unrecovered panic
+func GoroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := rpprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPTimings breaks the duration of an outbound request down, every phase is
+// measured from the start of the request
+type HTTPTimings struct {
+	DNS     Duration `json:"dns,omitempty"`
+	Connect Duration `json:"connect,omitempty"`
+	TLS     Duration `json:"tls,omitempty"`
+	TTFB    Duration `json:"ttfb,omitempty"`
+	Total   Duration `json:"total"`
+}
+
+type HTTPProbeResult struct {
+	URL        string      `json:"url"`
+	Method     string      `json:"method"`
+	Status     int         `json:"status,omitempty"`
+	Proto      string      `json:"proto,omitempty"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	TLSVersion string      `json:"tls_version,omitempty"`
+	BodySize   int64       `json:"body_size"`
+	Timings    HTTPTimings `json:"timings"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// HTTPProbeOptions describes an outbound HTTP request checked by a probe
+type HTTPProbeOptions struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"`
+	// skip the verification of the server certificate
+	Insecure bool `json:"insecure,omitempty"`
+	// name sent in the TLS handshake and verified, instead of the URL host
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// the client of the probes with the default TLS settings, it keeps no
+// connection open to trace every phase of the next ones
+var probeHTTPClient = newProbeHTTPClient(nil)
+
+func newProbeHTTPClient(config *tls.Config) *http.Client {
+	client := newOutboundClient(0)
+	transport := client.Transport.(*http.Transport)
+	transport.DisableKeepAlives = true
+	if config != nil {
+		transport.TLSClientConfig = config
+	}
+	return client
+}
+
+// probeHTTP sends the request on a new connection, tracing every phase of it
+func probeHTTP(ctx context.Context, o HTTPProbeOptions) HTTPProbeResult {
+	if o.Method == "" {
+		o.Method = "GET"
+	}
+	if o.Timeout == 0 {
+		o.Timeout = Duration(10 * time.Second)
+	}
+	result := HTTPProbeResult{URL: o.URL, Method: o.Method}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(o.Timeout))
+	defer cancel()
+	// the callbacks may still run in the transport after a failed request
+	var mu sync.Mutex
+	start := time.Now()
+	since := func() Duration { return Duration(time.Since(start)) }
+	record := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSDone:     func(httptrace.DNSDoneInfo) { record(func() { result.Timings.DNS = since() }) },
+		ConnectDone: func(_, _ string, _ error) { record(func() { result.Timings.Connect = since() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { result.Timings.TLS = since() })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { result.RemoteAddr = info.Conn.RemoteAddr().String() })
+		},
+		GotFirstResponseByte: func() { record(func() { result.Timings.TTFB = since() }) },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), o.Method, o.URL, strings.NewReader(o.Body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for key, value := range o.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := probeHTTPClient
+	if o.Insecure || o.ServerName != "" {
+		client = newProbeHTTPClient(&tls.Config{InsecureSkipVerify: o.Insecure, ServerName: o.ServerName})
+	}
+
+	resp, err := client.Do(req)
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		result.Timings.Total = since()
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.Status = resp.StatusCode
+	result.Proto = resp.Proto
+	if resp.TLS != nil {
+		result.TLSVersion = tls.VersionName(resp.TLS.Version)
+	}
+	result.BodySize, err = io.Copy(io.Discard, resp.Body)
+	result.Timings.Total = since()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HTTPProbeHandler sends a request to url with method (default GET), the
+// "Name: value" header parameters and body, within timeout (default 10s).
+// insecure=true skips the certificate verification and server_name replaces
+// the host name of the TLS handshake. It answers 502 when the request fails
+func HTTPProbeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	o := HTTPProbeOptions{
+		URL:        q.Get("url"),
+		Method:     strings.ToUpper(q.Get("method")),
+		Body:       q.Get("body"),
+		Insecure:   q.Get("insecure") == "true",
+		ServerName: q.Get("server_name"),
+		Headers:    map[string]string{},
+	}
+	if !strings.HasPrefix(o.URL, "http://") && !strings.HasPrefix(o.URL, "https://") {
+		http.Error(w, "url must be an http or https URL.", http.StatusBadRequest)
+		return
+	}
+	timeout, err := queryDuration(r, "timeout", 10*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o.Timeout = Duration(timeout)
+	for _, header := range q["header"] {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			http.Error(w, "header must be written as Name: value.", http.StatusBadRequest)
+			return
+		}
+		o.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	result := probeHTTP(r.Context(), o)
+	status := http.StatusOK
+	if result.Error != "" {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, result)
+}
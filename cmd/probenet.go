@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+type NetProbeResult struct {
+	Network    string   `json:"network"`
+	Address    string   `json:"address"`
+	Success    bool     `json:"success"`
+	RemoteAddr string   `json:"remote_addr,omitempty"`
+	Latency    Duration `json:"latency"`
+	// refused, timeout, unreachable, dns or other
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// for udp, the size of the reply
+	ReplySize int `json:"reply_size,omitempty"`
+}
+
+// classify a dial or read error by its probable cause
+func classifyNetError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "other"
+}
+
+func (res *NetProbeResult) fail(err error, start time.Time) {
+	res.Latency = Duration(time.Since(start))
+	res.ErrorClass = classifyNetError(err)
+	res.Error = err.Error()
+}
+
+// probeTCP opens a TCP connection to address
+func probeTCP(ctx context.Context, address string, timeout time.Duration) NetProbeResult {
+	res := NetProbeResult{Network: "tcp", Address: address}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := outboundDial(ctx, "tcp", address)
+	if err != nil {
+		res.fail(err, start)
+		return res
+	}
+	defer conn.Close()
+	res.Latency = Duration(time.Since(start))
+	res.Success = true
+	res.RemoteAddr = conn.RemoteAddr().String()
+	return res
+}
+
+// probeUDP sends the payload to address and waits for a reply, a closed port
+// usually answers with an ICMP error reported as refused, while no reply at
+// all is a timeout: the port is open without answering, or filtered
+func probeUDP(ctx context.Context, address string, payload []byte, timeout time.Duration) NetProbeResult {
+	res := NetProbeResult{Network: "udp", Address: address}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := outboundDial(ctx, "udp", address)
+	if err != nil {
+		res.fail(err, start)
+		return res
+	}
+	defer conn.Close()
+	res.RemoteAddr = conn.RemoteAddr().String()
+	conn.SetDeadline(start.Add(timeout))
+	if _, err := conn.Write(payload); err != nil {
+		res.fail(err, start)
+		return res
+	}
+	buf := make([]byte, 64<<10)
+	n, err := conn.Read(buf)
+	if err != nil {
+		res.fail(err, start)
+		return res
+	}
+	res.Latency = Duration(time.Since(start))
+	res.Success = true
+	res.ReplySize = n
+	return res
+}
+
+func parseNetProbe(w http.ResponseWriter, r *http.Request) (string, time.Duration, bool) {
+	address := r.URL.Query().Get("address")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		http.Error(w, "address must be written as host:port.", http.StatusBadRequest)
+		return "", 0, false
+	}
+	timeout, err := queryDuration(r, "timeout", 5*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", 0, false
+	}
+	return address, timeout, true
+}
+
+func writeNetProbe(w http.ResponseWriter, res NetProbeResult) {
+	status := http.StatusOK
+	if !res.Success {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, res)
+}
+
+// TCPProbeHandler connects to address (host:port) within timeout (default 5s),
+// it answers 502 when the connection fails
+func TCPProbeHandler(w http.ResponseWriter, r *http.Request) {
+	address, timeout, ok := parseNetProbe(w, r)
+	if !ok {
+		return
+	}
+	writeNetProbe(w, probeTCP(r.Context(), address, timeout))
+}
+
+// UDPProbeHandler sends payload (default "ping") to address (host:port) and
+// waits for a reply within timeout (default 5s), it answers 502 without reply
+func UDPProbeHandler(w http.ResponseWriter, r *http.Request) {
+	address, timeout, ok := parseNetProbe(w, r)
+	if !ok {
+		return
+	}
+	payload := r.URL.Query().Get("payload")
+	if payload == "" {
+		payload = "ping"
+	}
+	writeNetProbe(w, probeUDP(r.Context(), address, []byte(payload), timeout))
+}
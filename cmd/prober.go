@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Probe is a URL called periodically in the background
+type Probe struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+}
+
+type ProbeResult struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Success  bool      `json:"success"`
+	Status   int       `json:"status,omitempty"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+var (
+	probeResults sync.Map
+
+	probeSuccess = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "probe_success",
+		Help:      "Whether the last probe succeeded (2xx or 3xx status).",
+	}, []string{"probe"})
+	probeDuration = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "probe_duration_seconds",
+		Help:      "Duration of the last probe.",
+	}, []string{"probe"})
+	probeStatus = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "probe_status_total",
+		Help:      "Probes by status class (2xx, 3xx, 4xx, 5xx) or error when no response was received.",
+	}, []string{"probe", "class"})
+)
+
+// StartProbers validates the probes and calls each of them in the background
+func StartProbers(probes []Probe) error {
+	for _, p := range probes {
+		if p.Name == "" || p.URL == "" {
+			return fmt.Errorf("invalid probe %q: name and url are required", p.Name)
+		}
+		if p.Interval <= 0 {
+			p.Interval = Duration(15 * time.Second)
+		}
+		if p.Timeout <= 0 {
+			p.Timeout = Duration(5 * time.Second)
+		}
+		go runProbe(p)
+	}
+	return nil
+}
+
+func runProbe(p Probe) {
+	client := newOutboundClient(time.Duration(p.Timeout))
+	ticker := time.NewTicker(time.Duration(p.Interval))
+	defer ticker.Stop()
+	for {
+		probeOnce(client, p)
+		<-ticker.C
+	}
+}
+
+func probeOnce(client *http.Client, p Probe) {
+	result := ProbeResult{Name: p.Name, URL: p.URL, Time: time.Now()}
+	class := "error"
+
+	resp, err := client.Get(p.URL)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		result.Status = resp.StatusCode
+		result.Success = resp.StatusCode < 400
+		class = fmt.Sprintf("%dxx", resp.StatusCode/100)
+	} else {
+		result.Error = err.Error()
+	}
+	elapsed := time.Since(result.Time)
+	result.Duration = elapsed.String()
+	result.Time = Skew(result.Time)
+
+	probeResults.Store(p.Name, result)
+	probeDuration.WithLabelValues(p.Name).Set(elapsed.Seconds())
+	probeStatus.WithLabelValues(p.Name, class).Inc()
+	if result.Success {
+		probeSuccess.WithLabelValues(p.Name).Set(1)
+	} else {
+		probeSuccess.WithLabelValues(p.Name).Set(0)
+	}
+}
+
+// ProbesHandler lists the last result of every background probe
+func ProbesHandler(w http.ResponseWriter, r *http.Request) {
+	results := []ProbeResult{}
+	probeResults.Range(func(_, v any) bool {
+		results = append(results, v.(ProbeResult))
+		return true
+	})
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	writeJSON(w, http.StatusOK, results)
+}
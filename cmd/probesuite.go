@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EgressCheck is one check of the egress suite, exactly one of DNS, TCP and
+// HTTP is set
+type EgressCheck struct {
+	Name string `json:"name"`
+	// host name that must resolve
+	DNS string `json:"dns,omitempty"`
+	// host:port that must accept a connection
+	TCP string `json:"tcp,omitempty"`
+	// request that must succeed with a status below 400, or ExpectStatus
+	HTTP         *HTTPProbeOptions `json:"http,omitempty"`
+	ExpectStatus int               `json:"expect_status,omitempty"`
+	Timeout      Duration          `json:"timeout,omitempty"`
+}
+
+type EgressCheckResult struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Target   string   `json:"target"`
+	Passed   bool     `json:"passed"`
+	Duration Duration `json:"duration"`
+	Detail   string   `json:"detail,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type EgressSuiteResponse struct {
+	Passed   bool                `json:"passed"`
+	Duration Duration            `json:"duration"`
+	Checks   []EgressCheckResult `json:"checks"`
+}
+
+var egressSuite []EgressCheck
+
+// SetEgressSuite validates and replaces the checks run by /probe/suite
+func SetEgressSuite(checks []EgressCheck) error {
+	for _, c := range checks {
+		set := 0
+		for _, ok := range []bool{c.DNS != "", c.TCP != "", c.HTTP != nil} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("invalid egress check %q: exactly one of dns, tcp and http must be set", c.Name)
+		}
+		if c.TCP != "" {
+			if _, _, err := net.SplitHostPort(c.TCP); err != nil {
+				return fmt.Errorf("invalid egress check %q: %w", c.Name, err)
+			}
+		}
+	}
+	egressSuite = checks
+	return nil
+}
+
+func runEgressCheck(ctx context.Context, c EgressCheck) EgressCheckResult {
+	timeout := time.Duration(c.Timeout)
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	res := EgressCheckResult{Name: c.Name}
+	start := time.Now()
+	switch {
+	case c.DNS != "":
+		res.Type, res.Target = "dns", c.DNS
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		addrs, err := outboundLookup(ctx, c.DNS)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Passed = true
+			res.Detail = strings.Join(addrs, ", ")
+		}
+	case c.TCP != "":
+		res.Type, res.Target = "tcp", c.TCP
+		probe := probeTCP(ctx, c.TCP, timeout)
+		res.Passed = probe.Success
+		res.Detail = probe.RemoteAddr
+		if probe.Error != "" {
+			res.Error = probe.ErrorClass + ": " + probe.Error
+		}
+	default:
+		res.Type, res.Target = "http", c.HTTP.URL
+		options := *c.HTTP
+		if options.Timeout == 0 {
+			options.Timeout = Duration(timeout)
+		}
+		probe := probeHTTP(ctx, options)
+		res.Error = probe.Error
+		if probe.Error == "" {
+			res.Detail = fmt.Sprintf("status %d", probe.Status)
+			if c.ExpectStatus != 0 {
+				res.Passed = probe.Status == c.ExpectStatus
+			} else {
+				res.Passed = probe.Status < 400
+			}
+		}
+	}
+	res.Duration = Duration(time.Since(start))
+	return res
+}
+
+// EgressSuiteHandler runs all the checks of the egress suite of the config
+// file in parallel, it answers 503 when any of them fails
+func EgressSuiteHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	resp := EgressSuiteResponse{Passed: true, Checks: make([]EgressCheckResult, len(egressSuite))}
+	var wg sync.WaitGroup
+	for i, c := range egressSuite {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp.Checks[i] = runEgressCheck(r.Context(), c)
+		}()
+	}
+	wg.Wait()
+	for _, c := range resp.Checks {
+		resp.Passed = resp.Passed && c.Passed
+	}
+	resp.Duration = Duration(time.Since(start))
+
+	status := http.StatusOK
+	if !resp.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
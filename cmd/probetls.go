@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+)
+
+type CertificateInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	IPAddresses []string  `json:"ip_addresses,omitempty"`
+	Serial      string    `json:"serial"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	DaysLeft    int       `json:"days_left"`
+	SHA256      string    `json:"sha256"`
+}
+
+type TLSProbeResult struct {
+	Address    string `json:"address"`
+	ServerName string `json:"server_name"`
+	Success    bool   `json:"success"`
+	Version    string `json:"version,omitempty"`
+	Cipher     string `json:"cipher,omitempty"`
+	ALPN       string `json:"alpn,omitempty"`
+	// whether the chain is trusted by the system roots and valid for the server name
+	Verified          bool              `json:"verified"`
+	VerificationError string            `json:"verification_error,omitempty"`
+	Handshake         Duration          `json:"handshake"`
+	Certificates      []CertificateInfo `json:"certificates,omitempty"`
+	Error             string            `json:"error,omitempty"`
+}
+
+func certificateInfo(c *x509.Certificate) CertificateInfo {
+	sum := sha256.Sum256(c.Raw)
+	info := CertificateInfo{
+		Subject:   c.Subject.String(),
+		Issuer:    c.Issuer.String(),
+		DNSNames:  c.DNSNames,
+		Serial:    c.SerialNumber.Text(16),
+		NotBefore: c.NotBefore,
+		NotAfter:  c.NotAfter,
+		DaysLeft:  int(time.Until(c.NotAfter).Hours() / 24),
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+	for _, ip := range c.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// probeTLS performs a handshake with address, accepting any certificate so
+// that an invalid chain is still reported, and verifies the chain afterwards
+func probeTLS(ctx context.Context, address, serverName string, alpn []string, timeout time.Duration) TLSProbeResult {
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(address)
+	}
+	res := TLSProbeResult{Address: address, ServerName: serverName}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := outboundDial(ctx, "tcp", address)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer conn.Close()
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, NextProtos: alpn, InsecureSkipVerify: true})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Handshake = Duration(time.Since(start))
+	res.Success = true
+
+	state := tlsConn.ConnectionState()
+	res.Version = tls.VersionName(state.Version)
+	res.Cipher = tls.CipherSuiteName(state.CipherSuite)
+	res.ALPN = state.NegotiatedProtocol
+	for _, c := range state.PeerCertificates {
+		res.Certificates = append(res.Certificates, certificateInfo(c))
+	}
+	if len(state.PeerCertificates) > 0 {
+		intermediates := x509.NewCertPool()
+		for _, c := range state.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates})
+		res.Verified = err == nil
+		if err != nil {
+			res.VerificationError = err.Error()
+		}
+	}
+	return res
+}
+
+// TLSProbeHandler performs a TLS handshake with address (host:port) within
+// timeout (default 5s), sending server_name (default the host) and offering
+// the comma separated alpn protocols (default h2,http/1.1). It reports the
+// negotiated version, cipher and protocol with the certificate chain, and
+// answers 502 when the handshake fails
+func TLSProbeHandler(w http.ResponseWriter, r *http.Request) {
+	address, timeout, ok := parseNetProbe(w, r)
+	if !ok {
+		return
+	}
+	alpn := SplitList(r.URL.Query().Get("alpn"))
+	if len(alpn) == 0 {
+		alpn = []string{"h2", "http/1.1"}
+	}
+	res := probeTLS(r.Context(), address, r.URL.Query().Get("server_name"), alpn, timeout)
+	status := http.StatusOK
+	if !res.Success {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, res)
+}
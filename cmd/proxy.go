@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	proxyRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "proxy_requests_total",
+		Help:      "Requests forwarded by /proxy by result: status class (2xx, 5xx...) or error.",
+	}, []string{"result"})
+)
+
+// ProxyHandler forwards the request (method, headers and body) to url and
+// relays the response, after delay, within timeout (default 30s), on the
+// connections of the outbound client. The hop-by-hop and credential headers
+// of the client are not forwarded, the "Name: value" header parameters are
+// added to the forwarded request and the response_header ones to the relayed
+// response. The correlation ID and trace context travel with the request so
+// every hop of a chain logs the same ones
+func ProxyHandler(w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "url must be an http or https URL.", http.StatusBadRequest)
+		return
+	}
+	delay, err := queryDuration(r, "delay", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout, err := queryDuration(r, "timeout", 30*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if timeout <= 0 {
+		http.Error(w, "timeout must be greater than 0.", http.StatusBadRequest)
+		return
+	}
+	headers, err := queryHeaders(r, "header")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	responseHeaders, err := queryHeaders(r, "response_header")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Transport: outboundClient.Transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = target
+			pr.Out.Host = ""
+			pr.SetXForwarded()
+			// the proxy already drops the hop-by-hop headers
+			for _, key := range credentialHeaders {
+				pr.Out.Header.Del(key)
+			}
+			propagate(r, pr.Out.Header)
+			for key, values := range headers {
+				pr.Out.Header[key] = values
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// the headers of the target replace the ones set by the middlewares,
+			// except the ones identifying the request on this hop
+			resp.Header.Del(correlationIDHeader)
+			resp.Header.Del(traceresponseHeader)
+			for key := range resp.Header {
+				w.Header().Del(key)
+			}
+			for key, values := range responseHeaders {
+				resp.Header[key] = values
+			}
+			proxyRequests.WithLabelValues(fmt.Sprintf("%dxx", resp.StatusCode/100)).Inc()
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			proxyRequests.WithLabelValues("error").Inc()
+			slog.Warn("proxy request failed", append(logAttrs(w.Header()), "url", target.String(), "error", err)...)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+}
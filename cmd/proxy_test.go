@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxyStripsCredentials(t *testing.T) {
+	var got http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer target.Close()
+
+	req := httptest.NewRequest("GET", "/proxy?url="+url.QueryEscape(target.URL)+"&header=X-Extra:%20yes", nil)
+	req.Header.Set("X-Auth-Token", "secret")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "dummybox_session=secret")
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("X-Kept", "1")
+	rec := httptest.NewRecorder()
+	ProxyHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	for _, key := range []string{"X-Auth-Token", "Authorization", "Cookie", "X-Hop", "Keep-Alive"} {
+		if v := got.Get(key); v != "" {
+			t.Errorf("%s forwarded as %q", key, v)
+		}
+	}
+	if got.Get("X-Kept") != "1" || got.Get("X-Extra") != "yes" {
+		t.Errorf("got headers %v, want X-Kept and X-Extra forwarded", got)
+	}
+}
+
+func TestProxyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer target.Close()
+	defer close(release)
+
+	rec := httptest.NewRecorder()
+	ProxyHandler(rec, httptest.NewRequest("GET", "/proxy?timeout=50ms&url="+url.QueryEscape(target.URL), nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("got status %d, want 502 once the timeout is over", rec.Code)
+	}
+}
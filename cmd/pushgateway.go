@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushgatewaySettings configures the pushing of the metrics to a Prometheus
+// Pushgateway, for dummybox runs too short to be scraped
+type PushgatewaySettings struct {
+	// base URL of the Pushgateway, empty disables pushing
+	URL string `json:"url"`
+	Job string `json:"job"`
+	// time between two pushes, 0 only pushes on shutdown
+	Interval Duration `json:"interval"`
+}
+
+var pusher *push.Pusher
+
+// StartPushgateway validates the settings and pushes the metrics every
+// interval, grouped by job and instance name
+func StartPushgateway(s PushgatewaySettings) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid pushgateway url %q", s.URL)
+	}
+	if s.Job == "" {
+		return errors.New("invalid pushgateway job, it must not be empty")
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("invalid pushgateway interval %v, it must not be negative", s.Interval)
+	}
+	pusher = push.New(s.URL, s.Job).Gatherer(Registry).Grouping("instance", Instance.Name).Client(newOutboundClient(10 * time.Second))
+	log.Default().Printf("Pushing metrics to Pushgateway %s", s.URL)
+
+	if s.Interval > 0 {
+		go func() {
+			for range time.Tick(time.Duration(s.Interval)) {
+				PushMetrics()
+			}
+		}()
+	}
+	return nil
+}
+
+// PushMetrics replaces the metrics of the instance on the Pushgateway, it does
+// nothing when pushing is disabled
+func PushMetrics() {
+	if pusher == nil {
+		return
+	}
+	if err := pusher.Push(); err != nil {
+		log.Default().Printf("Pushgateway push: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type QueueResponse struct {
+	Wait       string `json:"wait"`
+	Processing string `json:"processing"`
+	Workers    int    `json:"workers"`
+	QueueSize  int    `json:"queue_size"`
+	QueueDepth int    `json:"queue_depth"`
+}
+
+type queueJob struct {
+	ctx      context.Context
+	work     time.Duration
+	enqueued time.Time
+	done     chan queueResult
+}
+
+type queueResult struct {
+	wait, processing time.Duration
+}
+
+var (
+	workQueue    chan *queueJob
+	queueWorkers int
+
+	queueWait = promauto.With(Registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "queue_wait_seconds",
+		Help:      "Time requests spent waiting in the queue for a free worker.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+	queueProcessing = promauto.With(Registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "samplebox",
+		Name:      "queue_processing_seconds",
+		Help:      "Time workers spent processing requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+	queueRejections = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "queue_rejections_total",
+		Help:      "Requests rejected because the queue was full.",
+	})
+	queueDepth = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "queue_depth",
+		Help:      "Number of requests waiting in the queue.",
+	}, func() float64 { return float64(len(workQueue)) })
+)
+
+// StartWorkerPool starts the fixed number of workers processing the bounded /queue
+func StartWorkerPool(workers, size int) error {
+	if workers < 1 || size < 0 {
+		return fmt.Errorf("invalid queue of %d workers and size %d, it needs at least one worker and a size of 0 or more", workers, size)
+	}
+	queueWorkers = workers
+	workQueue = make(chan *queueJob, size)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range workQueue {
+				// the clients gone while waiting free the worker at once
+				wait := time.Since(job.enqueued)
+				select {
+				case <-time.After(job.work):
+				case <-job.ctx.Done():
+				}
+				job.done <- queueResult{wait: wait, processing: time.Since(job.enqueued) - wait}
+			}
+		}()
+	}
+	return nil
+}
+
+// QueueHandler hands the request to the worker pool, which spends "work"
+// (default 100ms) on it, and rejects it with 503 when the queue is full
+func QueueHandler(w http.ResponseWriter, r *http.Request) {
+	work, err := queryDuration(r, "work", 100*time.Millisecond)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := &queueJob{ctx: r.Context(), work: work, enqueued: time.Now(), done: make(chan queueResult, 1)}
+	select {
+	case workQueue <- job:
+	default:
+		queueRejections.Inc()
+		http.Error(w, "Queue is full.", http.StatusServiceUnavailable)
+		return
+	}
+
+	var result queueResult
+	select {
+	case result = <-job.done:
+	case <-r.Context().Done():
+		// the client gave up, nobody reads the answer
+		return
+	}
+	queueWait.Observe(result.wait.Seconds())
+	queueProcessing.Observe(result.processing.Seconds())
+
+	writeJSON(w, http.StatusOK, QueueResponse{
+		Wait:       result.wait.String(),
+		Processing: result.processing.String(),
+		Workers:    queueWorkers,
+		QueueSize:  cap(workQueue),
+		QueueDepth: len(workQueue),
+	})
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStartWorkerPoolValidates(t *testing.T) {
+	for _, tc := range []struct{ workers, size int }{{0, 4}, {-1, 4}, {4, -1}} {
+		if err := StartWorkerPool(tc.workers, tc.size); err == nil {
+			t.Errorf("%d workers and size %d were accepted", tc.workers, tc.size)
+		}
+	}
+}
+
+func TestQueueHandlerFreesWorkerOfGoneClient(t *testing.T) {
+	if err := StartWorkerPool(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := httptest.NewRequest("GET", "/queue?work=1h", nil).WithContext(ctx)
+		QueueHandler(httptest.NewRecorder(), r)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the handler kept waiting after the client went away")
+	}
+
+	// the worker is free again for the next request
+	w := httptest.NewRecorder()
+	QueueHandler(w, httptest.NewRequest("GET", "/queue?work=1ms", nil))
+	if w.Code != 200 {
+		t.Errorf("got status %d, want 200", w.Code)
+	}
+}
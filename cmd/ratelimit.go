@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RateLimitSettings limits the requests to Rate per second with bursts of
+// Burst, per client IP, per auth token or globally. A zero rate disables it
+type RateLimitSettings struct {
+	Rate    float64  `json:"rate"`
+	Burst   float64  `json:"burst"`
+	Key     string   `json:"key"`
+	Exclude []string `json:"exclude"`
+}
+
+// the full buckets, then random ones, are forgotten beyond this number of keys
+const maxRateLimitBuckets = 10000
+
+var (
+	rateLimit        RateLimitSettings
+	rateLimitMu      sync.Mutex
+	rateLimitBuckets = make(map[string]*tokenBucket)
+
+	rateLimitRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "ratelimit_requests_total",
+		Help:      "Requests seen by the rate limiter by result: allowed or limited.",
+	}, []string{"result"})
+	_ = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "ratelimit_buckets",
+		Help:      "Token buckets of the rate limiter, one per client IP or auth token.",
+	}, func() float64 {
+		rateLimitMu.Lock()
+		defer rateLimitMu.Unlock()
+		return float64(len(rateLimitBuckets))
+	})
+)
+
+// SetRateLimit configures the rate limiter, dropping its buckets
+func SetRateLimit(s RateLimitSettings) error {
+	switch s.Key {
+	case "ip", "token", "global":
+	default:
+		return fmt.Errorf("invalid rate limit key %q, expected ip, token or global", s.Key)
+	}
+	if s.Rate < 0 {
+		return fmt.Errorf("invalid rate limit %v, it must not be negative", s.Rate)
+	}
+	if s.Burst < 1 {
+		s.Burst = max(1, s.Rate)
+	}
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateLimit = s
+	rateLimitBuckets = make(map[string]*tokenBucket)
+	return nil
+}
+
+// bucket of the request according to the key of the limiter. The token key
+// only counts the known auth tokens, any other request counts against its
+// client IP
+func rateLimitBucket(r *http.Request) *tokenBucket {
+	var key string
+	switch rateLimit.Key {
+	case "ip":
+		key = "ip:" + clientIP(r).String()
+	case "token":
+		if t, ok := findAuthToken(requestAuthToken(r)); ok {
+			key = "token:" + t.Token
+		} else {
+			key = "ip:" + clientIP(r).String()
+		}
+	}
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	b, ok := rateLimitBuckets[key]
+	if !ok {
+		if len(rateLimitBuckets) >= maxRateLimitBuckets {
+			for k, old := range rateLimitBuckets {
+				if old.full() {
+					delete(rateLimitBuckets, k)
+				}
+			}
+			for k := range rateLimitBuckets {
+				if len(rateLimitBuckets) < maxRateLimitBuckets*9/10 {
+					break
+				}
+				delete(rateLimitBuckets, k)
+			}
+		}
+		b = newTokenBucket(rateLimit.Burst, rateLimit.Rate)
+		rateLimitBuckets[key] = b
+	}
+	return b
+}
+
+// RateLimitMiddleware answers 429 with a Retry-After header to the requests
+// beyond the quota of their bucket, the excluded paths are never limited
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimit.Rate == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range rateLimit.Exclude {
+			if pathWithin(r.URL.Path, p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		b := rateLimitBucket(r)
+		ok, wait := b.take()
+		b.writeHeaders(w.Header(), RateLimitHeaders)
+		if !ok {
+			rateLimitRequests.WithLabelValues("limited").Inc()
+			w.Header().Set("Retry-After", retryAfter(wait, "seconds"))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		rateLimitRequests.WithLabelValues("allowed").Inc()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitTokenKey(t *testing.T) {
+	if err := SetAuthTokens([]AuthToken{{Name: "ci", Token: "secret", Scopes: []string{"*"}}}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetAuthTokens(nil)
+	if err := SetRateLimit(RateLimitSettings{Rate: 1, Burst: 1, Key: "token"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRateLimit(RateLimitSettings{Key: "ip"})
+	h := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(token string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Auth-Token", token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("secret"); code != http.StatusOK {
+		t.Errorf("known token: got status %d, want 200", code)
+	}
+	if code := serve("secret"); code != http.StatusTooManyRequests {
+		t.Errorf("known token again: got status %d, want 429", code)
+	}
+	// made up tokens do not get a bucket each, they share the one of the IP
+	if code := serve("made-up-1"); code != http.StatusOK {
+		t.Errorf("unknown token: got status %d, want 200", code)
+	}
+	if code := serve("made-up-2"); code != http.StatusTooManyRequests {
+		t.Errorf("other unknown token: got status %d, want 429", code)
+	}
+}
+
+func TestRateLimitBucketsBounded(t *testing.T) {
+	if err := SetRateLimit(RateLimitSettings{Rate: 1, Burst: 1, Key: "ip"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRateLimit(RateLimitSettings{Key: "ip"})
+
+	// every bucket is used, none of them is full
+	for i := 0; i < maxRateLimitBuckets+10; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10." + strconv.Itoa(i>>16&255) + "." + strconv.Itoa(i>>8&255) + "." + strconv.Itoa(i&255) + ":1234"
+		rateLimitBucket(req).take()
+	}
+	rateLimitMu.Lock()
+	n := len(rateLimitBuckets)
+	rateLimitMu.Unlock()
+	if n > maxRateLimitBuckets {
+		t.Errorf("got %d buckets, want at most %d", n, maxRateLimitBuckets)
+	}
+}
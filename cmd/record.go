@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordedRequest is a request received by the server, with the status and
+// duration of its response
+type RecordedRequest struct {
+	ID            uint64      `json:"id"`
+	Time          time.Time   `json:"time"`
+	Method        string      `json:"method"`
+	Path          string      `json:"path"`
+	Query         string      `json:"query,omitempty"`
+	Host          string      `json:"host"`
+	RemoteAddr    string      `json:"remote_addr"`
+	CorrelationID string      `json:"correlation_id,omitempty"`
+	Headers       http.Header `json:"headers"`
+	Body          string      `json:"body,omitempty"`
+	// base64 when the body is not UTF-8 text
+	BodyEncoding string `json:"body_encoding,omitempty"`
+	// bytes of the body read by the server, the whole body unless the handler stopped early
+	BodySize      int64    `json:"body_size"`
+	BodyTruncated bool     `json:"body_truncated,omitempty"`
+	Status        int      `json:"status"`
+	Duration      Duration `json:"duration"`
+}
+
+const (
+	recordedPath = "/recorded"
+	// largest request body kept by a record
+	maxRecordedBody = 64 << 10
+)
+
+var (
+	recordMu   sync.Mutex
+	recordRing []RecordedRequest
+	// position of the next record in the ring, and the records made so far
+	recordNext  int
+	recordCount uint64
+)
+
+// SetRecording keeps the last size requests received, 0 disables the recording
+func SetRecording(size int) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	recordRing = make([]RecordedRequest, 0, size)
+	recordNext = 0
+}
+
+func addRecord(rec RecordedRequest) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	recordCount++
+	rec.ID = recordCount
+	if len(recordRing) < cap(recordRing) {
+		recordRing = append(recordRing, rec)
+		return
+	}
+	recordRing[recordNext] = rec
+	recordNext = (recordNext + 1) % len(recordRing)
+}
+
+// the records, oldest first
+func records() []RecordedRequest {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	list := make([]RecordedRequest, 0, len(recordRing))
+	list = append(list, recordRing[recordNext:]...)
+	return append(list, recordRing[:recordNext]...)
+}
+
+// RecordMiddleware keeps the requests received in the ring buffer, with the
+// start of their body, once they are answered. The credential headers are
+// redacted
+func RecordMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordMu.Lock()
+		enabled := cap(recordRing) > 0
+		recordMu.Unlock()
+		if !enabled || strings.HasPrefix(r.URL.Path, recordedPath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := RecordedRequest{
+			Time:          start,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Query:         r.URL.RawQuery,
+			Host:          r.Host,
+			RemoteAddr:    r.RemoteAddr,
+			CorrelationID: correlationID(r),
+			Headers:       r.Header.Clone(),
+		}
+		for _, key := range credentialHeaders {
+			if _, ok := rec.Headers[key]; ok {
+				rec.Headers[key] = []string{"[redacted]"}
+			}
+		}
+		// the body is kept as the handler reads it, a streamed upload is not
+		// held back
+		body := &recordingBody{ReadCloser: r.Body}
+		r.Body = body
+
+		sw := &StatusRecorder{ResponseWriter: w}
+		defer func() {
+			// the start of the body the handler left unread, unless the
+			// connection was taken over
+			if sw.Status != 0 {
+				io.CopyN(io.Discard, body, int64(maxRecordedBody+1-body.buf.Len()))
+			}
+			rec.Status = sw.Status
+			rec.Duration = Duration(time.Since(start))
+			rec.BodySize = body.n
+			kept := body.buf.Bytes()
+			if len(kept) > maxRecordedBody {
+				kept, rec.BodyTruncated = kept[:maxRecordedBody], true
+			}
+			if utf8.Valid(kept) {
+				rec.Body = string(kept)
+			} else {
+				rec.Body, rec.BodyEncoding = base64.StdEncoding.EncodeToString(kept), "base64"
+			}
+			addRecord(rec)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// recordingBody counts the bytes read through it and keeps the first
+// maxRecordedBody of them, and one more to tell a truncated body
+type recordingBody struct {
+	io.ReadCloser
+	buf bytes.Buffer
+	n   int64
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := maxRecordedBody + 1 - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// RecordedHandler lists (GET) or clears (DELETE) the last requests received,
+// oldest first. The list is filtered by method, path prefix, status,
+// correlation_id and header ("Name: value", repeated), limit keeps the latest ones
+func RecordedHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		recordMu.Lock()
+		recordRing = recordRing[:0]
+		recordNext = 0
+		recordMu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	headers, err := queryHeaders(r, "header")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status, err := queryInt(r, "status", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := r.URL.Query().Get("method")
+	path := r.URL.Query().Get("path")
+	correlation := r.URL.Query().Get("correlation_id")
+
+	list := []RecordedRequest{}
+	for _, rec := range records() {
+		if method != "" && !strings.EqualFold(rec.Method, method) ||
+			!strings.HasPrefix(rec.Path, path) ||
+			status != 0 && rec.Status != status ||
+			correlation != "" && rec.CorrelationID != correlation ||
+			!headersMatch(rec.Headers, headers) {
+			continue
+		}
+		rec.Time = Skew(rec.Time)
+		list = append(list, rec)
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// every expected header is present with one of its values
+func headersMatch(h, expected http.Header) bool {
+	for key, values := range expected {
+		for _, v := range values {
+			found := false
+			for _, got := range h.Values(key) {
+				if got == v {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
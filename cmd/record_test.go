@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordMiddleware(t *testing.T) {
+	SetRecording(10)
+	defer SetRecording(0)
+	h := RecordMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler sees the body as it arrives
+		buf := make([]byte, 4)
+		io.ReadFull(r.Body, buf)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	req := httptest.NewRequest("POST", "/hook", strings.NewReader("payload"))
+	req.Header.Set("X-Auth-Token", "secret")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "dummybox_session=secret")
+	req.Header.Set("X-Kept", "yes")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	list := records()
+	if len(list) != 1 {
+		t.Fatalf("got %d records, want 1", len(list))
+	}
+	rec := list[0]
+	for _, key := range credentialHeaders {
+		if v := rec.Headers.Get(key); v != "[redacted]" {
+			t.Errorf("%s recorded as %q", key, v)
+		}
+	}
+	if rec.Headers.Get("X-Kept") != "yes" || rec.Body != "payload" || rec.BodySize != 7 || rec.Status != http.StatusAccepted {
+		t.Errorf("got %+v", rec)
+	}
+}
+
+func TestRecordMiddlewareTruncates(t *testing.T) {
+	SetRecording(10)
+	defer SetRecording(0)
+	h := RecordMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/kv/big", strings.NewReader(strings.Repeat("a", maxRecordedBody+10))))
+	rec := records()[0]
+	if len(rec.Body) != maxRecordedBody || !rec.BodyTruncated || rec.BodySize != maxRecordedBody+10 {
+		t.Errorf("got a body of %d bytes, truncated %v, size %d", len(rec.Body), rec.BodyTruncated, rec.BodySize)
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+// data passed to every HTML page, the page specific values are in Data
+type pageData struct {
+	Title    string
+	Instance InstanceInfo
+	Version  string
+	Data     any
+}
+
+// parse a page together with the shared layout
+func parsePage(name string) *template.Template {
+	return template.Must(template.ParseFS(templatesFS, "templates/layout.html", "templates/"+name+".html"))
+}
+
+// responseFormat is the format asked by the client: json, html or text,
+// either with ?format= or through the Accept header as browsers do
+func responseFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/html"):
+		return "html"
+	case strings.Contains(accept, "text/plain"):
+		return "text"
+	}
+	return "json"
+}
+
+// wantsHTML reports whether the client asked for an HTML page
+func wantsHTML(r *http.Request) bool {
+	return responseFormat(r) == "html"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHTML(w http.ResponseWriter, r *http.Request, status int, page *template.Template, title string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.ExecuteTemplate(w, "layout", pageData{
+		Title:    title,
+		Instance: Instance,
+		Version:  requestVersion(r),
+		Data:     data,
+	})
+}
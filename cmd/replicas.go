@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// largest body of a replica answer copied into the /replicas/call result
+const maxReplicaBody = 64 << 10
+
+type ReplicaCall struct {
+	Address string   `json:"address"`
+	Status  int      `json:"status,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Latency Duration `json:"latency"`
+	// the answer itself when it is JSON
+	Body  json.RawMessage `json:"body,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type ReplicasResponse struct {
+	Service   string `json:"service"`
+	Path      string `json:"path"`
+	Reachable int    `json:"reachable"`
+	// every replica answered with the same status and version
+	Consistent bool          `json:"consistent"`
+	Versions   []string      `json:"versions"`
+	Replicas   []ReplicaCall `json:"replicas"`
+}
+
+func callReplica(ctx context.Context, r *http.Request, addr, path string) (call ReplicaCall) {
+	call.Address = addr
+	start := time.Now()
+	defer func() { call.Latency = Duration(time.Since(start)) }()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+path, nil)
+	if err != nil {
+		call.Error = err.Error()
+		return call
+	}
+	propagate(r, req.Header)
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		call.Error = err.Error()
+		return call
+	}
+	defer resp.Body.Close()
+	call.Status = resp.StatusCode
+	call.Version = resp.Header.Get("X-Dummybox-Version")
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReplicaBody))
+	if err == nil && json.Valid(body) {
+		call.Body = body
+	}
+	return call
+}
+
+// ReplicasCallHandler resolves every address of service (host:port, default
+// --peers-dns), such as a headless Service, calls path (default /version) on
+// each of them in parallel within timeout (default 5s), and reports whether
+// they all answered alike
+func ReplicasCallHandler(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		service = peerSettings.DNS
+	}
+	host, port, err := net.SplitHostPort(service)
+	if err != nil {
+		http.Error(w, "service must be host:port, or --peers-dns set.", http.StatusBadRequest)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = "/version"
+	}
+	if !strings.HasPrefix(path, "/") {
+		http.Error(w, "path must start with /.", http.StatusBadRequest)
+		return
+	}
+	timeout, err := queryDuration(r, "timeout", 5*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	addrs, err := outboundLookup(r.Context(), host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	sort.Strings(addrs)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	resp := ReplicasResponse{Service: service, Path: path, Versions: []string{}, Replicas: make([]ReplicaCall, len(addrs))}
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		i, addr := i, net.JoinHostPort(addr, port)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp.Replicas[i] = callReplica(ctx, r, addr, path)
+		}()
+	}
+	wg.Wait()
+
+	versions := make(map[string]bool)
+	statuses := make(map[int]bool)
+	for _, c := range resp.Replicas {
+		if c.Error != "" {
+			continue
+		}
+		resp.Reachable++
+		statuses[c.Status] = true
+		if !versions[c.Version] {
+			versions[c.Version] = true
+			resp.Versions = append(resp.Versions, c.Version)
+		}
+	}
+	sort.Strings(resp.Versions)
+	resp.Consistent = resp.Reachable == len(resp.Replicas) && len(statuses) == 1 && len(versions) == 1
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RespondParams describes the response returned by /respond
+type RespondParams struct {
+	Code    int               `json:"code,omitempty"`
+	Delay   Duration          `json:"delay,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// percentage (0-100) of the calls failing with one of the failure codes
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// codes of the failed calls with their weights, 500 when empty
+	FailureCodes []WeightedCode `json:"failure_codes,omitempty"`
+	// number of calls of a sequence failing before the calls succeed
+	FailFirst int `json:"fail_first,omitempty"`
+	// quota of the calls, the ones beyond it are rejected
+	RateLimit *RespondRateLimit `json:"rate_limit,omitempty"`
+	// bytes per second the body is written at, unthrottled when 0
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// RespondMatch selects the requests a rule applies to, every condition set must match
+type RespondMatch struct {
+	// request headers with their exact value
+	Headers map[string]string `json:"headers,omitempty"`
+	// query parameters that must be present
+	Query []string `json:"query,omitempty"`
+	// text the request body must contain
+	BodyContains string `json:"body_contains,omitempty"`
+	// network the client IP must belong to
+	CIDR    string `json:"cidr,omitempty"`
+	network *net.IPNet
+}
+
+// RespondRule replaces the query parameters of /respond for the matching requests
+type RespondRule struct {
+	Name  string       `json:"name"`
+	Match RespondMatch `json:"match"`
+	RespondParams
+}
+
+type RespondResponse struct {
+	Code   int      `json:"code"`
+	Delay  Duration `json:"delay"`
+	Rule   string   `json:"rule,omitempty"`
+	Failed bool     `json:"failed,omitempty"`
+	// call number in the fail-first sequence
+	Call int `json:"call,omitempty"`
+}
+
+// largest request body inspected by the body_contains matcher
+const maxMatchedBody = 1 << 20
+
+var (
+	respondMu    sync.RWMutex
+	respondRules []RespondRule
+)
+
+// SetRespondRules validates and replaces the /respond matcher rules
+func SetRespondRules(rules []RespondRule) error {
+	for i := range rules {
+		if code := rules[i].Code; code != 0 && (code < 100 || code > 599) {
+			return fmt.Errorf("invalid rule %q: %d is not an HTTP status code", rules[i].Name, code)
+		}
+		if err := rules[i].validateFailures(); err != nil {
+			return fmt.Errorf("invalid rule %q: %w", rules[i].Name, err)
+		}
+		if rules[i].Match.CIDR == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(rules[i].Match.CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q: %w", rules[i].Name, err)
+		}
+		rules[i].Match.network = network
+	}
+	respondMu.Lock()
+	defer respondMu.Unlock()
+	respondRules = rules
+	return nil
+}
+
+// matches reports whether the request fulfils every condition of the matcher
+func (m RespondMatch) matches(r *http.Request, body []byte) bool {
+	for key, value := range m.Headers {
+		if r.Header.Get(key) != value {
+			return false
+		}
+	}
+	for _, name := range m.Query {
+		if !r.URL.Query().Has(name) {
+			return false
+		}
+	}
+	if m.BodyContains != "" && !bytes.Contains(body, []byte(m.BodyContains)) {
+		return false
+	}
+	if m.network != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !m.network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// find the first rule matching the request
+func matchRespondRule(r *http.Request, body []byte) (RespondRule, bool) {
+	respondMu.RLock()
+	defer respondMu.RUnlock()
+	for _, rule := range respondRules {
+		if rule.Match.matches(r, body) {
+			return rule, true
+		}
+	}
+	return RespondRule{}, false
+}
+
+func (p RespondParams) validateFailures() error {
+	if p.RateLimit != nil {
+		if err := p.RateLimit.validate(); err != nil {
+			return err
+		}
+	}
+	if p.FailFirst < 0 {
+		return fmt.Errorf("fail first %d must not be negative", p.FailFirst)
+	}
+	if p.ErrorRate < 0 || p.ErrorRate > 100 {
+		return fmt.Errorf("error rate %v must be between 0 and 100", p.ErrorRate)
+	}
+	for _, c := range p.FailureCodes {
+		if c.Code < 200 || c.Code > 599 || c.Weight < 1 || c.Weight > maxCodeWeight {
+			return fmt.Errorf("failure code %d must be between 200 and 599 with a weight between 1 and %d", c.Code, maxCodeWeight)
+		}
+	}
+	return nil
+}
+
+// draw whether the call fails and with which code
+func (p RespondParams) failure(rng *rand.Rand) (int, bool) {
+	if p.ErrorRate <= 0 || rng.Float64()*100 >= p.ErrorRate {
+		return 0, false
+	}
+	return p.failureCode(rng), true
+}
+
+func (p RespondParams) failureCode(rng *rand.Rand) int {
+	if len(p.FailureCodes) == 0 {
+		return http.StatusInternalServerError
+	}
+	return pickCode(rng, p.FailureCodes)
+}
+
+// parse the query parameters of /respond: code (default 200), delay, error_rate,
+// fail_first, failure_codes such as 500:3,503:1, the rate limit ones and rate,
+// the bytes per second of the body
+func parseRespondParams(r *http.Request) (RespondParams, error) {
+	code, err := queryInt(r, "code", http.StatusOK)
+	if err != nil {
+		return RespondParams{}, err
+	}
+	if code < 100 || code > 599 {
+		return RespondParams{}, fmt.Errorf("invalid code: %d is not an HTTP status code", code)
+	}
+	delay, err := queryDuration(r, "delay", 0)
+	if err != nil {
+		return RespondParams{}, err
+	}
+	// without an explicit delay, draw it from the latency profile when there is one
+	if !r.URL.Query().Has("delay") {
+		delay, _ = profileDelay(requestRand(r))
+	}
+	errorRate, err := queryFloat(r, "error_rate", 0)
+	if err != nil {
+		return RespondParams{}, err
+	}
+	failFirst, err := queryInt(r, "fail_first", 0)
+	if err != nil {
+		return RespondParams{}, err
+	}
+	params := RespondParams{Code: code, Delay: Duration(delay), ErrorRate: errorRate, FailFirst: failFirst}
+	if v := r.URL.Query().Get("failure_codes"); v != "" {
+		if params.FailureCodes, err = parseWeightedCodes(v); err != nil {
+			return RespondParams{}, err
+		}
+	}
+	if params.RateLimit, err = parseRespondRateLimit(r); err != nil {
+		return RespondParams{}, err
+	}
+	if params.Rate, err = queryRate(r); err != nil {
+		return RespondParams{}, err
+	}
+	if err := params.validateFailures(); err != nil {
+		return RespondParams{}, err
+	}
+	return params, nil
+}
+
+// RespondHandler answers with the requested code after the requested delay,
+// unless a matcher rule selects a different behavior for this caller
+func RespondHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseRespondParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMatchedBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := RespondResponse{}
+	if rule, ok := matchRespondRule(r, body); ok {
+		params = rule.RespondParams
+		if params.Code == 0 {
+			params.Code = http.StatusOK
+		}
+		resp.Rule = rule.Name
+	}
+	if params.RateLimit != nil && !params.RateLimit.allow(w) {
+		http.Error(w, http.StatusText(params.RateLimit.Status), params.RateLimit.Status)
+		return
+	}
+	if params.FailFirst > 0 {
+		key := sequenceKey(r)
+		if key == "" {
+			http.Error(w, "fail_first needs a sequence_key parameter or an X-Correlation-ID header.", http.StatusBadRequest)
+			return
+		}
+		resp.Call = nextSequenceCall(key)
+		if resp.Call <= params.FailFirst {
+			params.Code = params.failureCode(requestRand(r))
+			resp.Failed = true
+		}
+	}
+	if code, failed := params.failure(requestRand(r)); failed && !resp.Failed {
+		params.Code = code
+		resp.Failed = true
+	}
+	resp.Code = params.Code
+	resp.Delay = params.Delay
+
+	select {
+	case <-time.After(time.Duration(params.Delay)):
+	case <-r.Context().Done():
+		return
+	}
+
+	w = throttle(w, r, params.Rate)
+	for key, value := range params.Headers {
+		w.Header().Set(key, value)
+	}
+	if params.Body != "" {
+		w.WriteHeader(params.Code)
+		io.WriteString(w, params.Body)
+		return
+	}
+	writeJSON(w, params.Code, resp)
+}
+
+// RespondRulesHandler lists (GET), replaces (POST) or removes (DELETE) the /respond matcher rules
+func RespondRulesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var rules []RespondRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := SetRespondRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		SetRespondRules(nil)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	respondMu.RLock()
+	defer respondMu.RUnlock()
+	writeJSON(w, http.StatusOK, respondRules)
+}
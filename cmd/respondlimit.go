@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// RespondRateLimit answers the /respond calls beyond the quota of a token
+// bucket with Status and a Retry-After header
+type RespondRateLimit struct {
+	// calls accepted in a burst
+	Capacity float64 `json:"capacity"`
+	// calls accepted per second once the burst is used, default 1
+	Rate float64 `json:"rate,omitempty"`
+	// bucket shared by the calls with the same key, default "default"
+	Key string `json:"key,omitempty"`
+	// 429 (default) or 503
+	Status int `json:"status,omitempty"`
+	// style of the quota headers, default the --ratelimit-headers one
+	Headers string `json:"headers,omitempty"`
+}
+
+// a token bucket with the settings it was created with
+type respondBucket struct {
+	limit  RespondRateLimit
+	bucket *tokenBucket
+}
+
+// the full buckets, then random ones, are forgotten beyond this number of keys
+const maxRespondBuckets = 10000
+
+var (
+	respondBucketsMu sync.Mutex
+	respondBuckets   = make(map[string]respondBucket)
+)
+
+func (l *RespondRateLimit) validate() error {
+	if l.Rate == 0 {
+		l.Rate = 1
+	}
+	if l.Key == "" {
+		l.Key = "default"
+	}
+	if l.Status == 0 {
+		l.Status = http.StatusTooManyRequests
+	}
+	if l.Capacity < 1 || l.Rate < 0 {
+		return fmt.Errorf("rate limit capacity %v must be at least 1 and rate %v positive", l.Capacity, l.Rate)
+	}
+	if l.Status != http.StatusTooManyRequests && l.Status != http.StatusServiceUnavailable {
+		return fmt.Errorf("rate limit status %d must be 429 or 503", l.Status)
+	}
+	switch l.Headers {
+	case "", "draft", "structured", "legacy", "none":
+	default:
+		return fmt.Errorf("invalid rate limit headers %q, expected draft, structured, legacy or none", l.Headers)
+	}
+	return nil
+}
+
+// bucket of the key, a new full one when the key is new or its settings changed
+func (l RespondRateLimit) bucket() *tokenBucket {
+	respondBucketsMu.Lock()
+	defer respondBucketsMu.Unlock()
+	b, ok := respondBuckets[l.Key]
+	if !ok || b.limit.Capacity != l.Capacity || b.limit.Rate != l.Rate {
+		if !ok && len(respondBuckets) >= maxRespondBuckets {
+			for k, old := range respondBuckets {
+				if old.bucket.full() {
+					delete(respondBuckets, k)
+				}
+			}
+			for k := range respondBuckets {
+				if len(respondBuckets) < maxRespondBuckets*9/10 {
+					break
+				}
+				delete(respondBuckets, k)
+			}
+		}
+		b = respondBucket{limit: l, bucket: newTokenBucket(l.Capacity, l.Rate)}
+		respondBuckets[l.Key] = b
+	}
+	return b.bucket
+}
+
+// take a token, writing the quota headers, false when the call is over the quota
+func (l RespondRateLimit) allow(w http.ResponseWriter) bool {
+	b := l.bucket()
+	ok, wait := b.take()
+	style := l.Headers
+	if style == "" {
+		style = RateLimitHeaders
+	}
+	b.writeHeaders(w.Header(), style)
+	if !ok {
+		w.Header().Set("Retry-After", retryAfter(wait, "seconds"))
+	}
+	return ok
+}
+
+// parse the rate_limit (capacity), rate_limit_rate, rate_limit_key,
+// rate_limit_status and ratelimit_headers query parameters of /respond
+func parseRespondRateLimit(r *http.Request) (*RespondRateLimit, error) {
+	if !r.URL.Query().Has("rate_limit") {
+		return nil, nil
+	}
+	capacity, err := queryFloat(r, "rate_limit", 0)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := queryFloat(r, "rate_limit_rate", 1)
+	if err != nil {
+		return nil, err
+	}
+	status, err := queryInt(r, "rate_limit_status", http.StatusTooManyRequests)
+	if err != nil {
+		return nil, err
+	}
+	l := &RespondRateLimit{
+		Capacity: capacity,
+		Rate:     rate,
+		Key:      r.URL.Query().Get("rate_limit_key"),
+		Status:   status,
+		Headers:  r.URL.Query().Get("ratelimit_headers"),
+	}
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
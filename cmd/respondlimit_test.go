@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRespondRateLimitRejectsNaN(t *testing.T) {
+	for _, query := range []string{"rate_limit=NaN", "rate_limit=5&rate_limit_rate=NaN", "rate_limit=Inf"} {
+		if l, err := parseRespondRateLimit(httptest.NewRequest("GET", "/respond?"+query, nil)); err == nil {
+			t.Errorf("%s: got %+v, want an error", query, l)
+		}
+	}
+}
+
+func TestRespondBucketsBounded(t *testing.T) {
+	defer func() { respondBuckets = make(map[string]respondBucket) }()
+	busy := RespondRateLimit{Capacity: 2, Rate: 0, Key: "busy"}
+	busy.bucket().take()
+	for i := 0; i < maxRespondBuckets+10; i++ {
+		l := RespondRateLimit{Capacity: 1, Rate: 1, Key: strconv.Itoa(i)}
+		l.bucket()
+	}
+	if n := len(respondBuckets); n > maxRespondBuckets {
+		t.Errorf("got %d buckets, want at most %d", n, maxRespondBuckets)
+	}
+	if _, ok := respondBuckets["busy"]; !ok {
+		t.Error("the bucket in use was evicted before the full ones")
+	}
+}
+
+func TestRespondRateLimitSlowRate(t *testing.T) {
+	defer func() { respondBuckets = make(map[string]respondBucket) }()
+	l, err := parseRespondRateLimit(httptest.NewRequest("GET", "/respond?rate_limit=1&rate_limit_rate=1e-300&rate_limit_key=slow&ratelimit_headers=legacy", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.allow(httptest.NewRecorder())
+	rec := httptest.NewRecorder()
+	if l.allow(rec) {
+		t.Fatal("the second call was allowed")
+	}
+	if n, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || n <= 0 {
+		t.Errorf("got Retry-After %q, want a positive number of seconds", rec.Header().Get("Retry-After"))
+	}
+	if n, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64); err != nil || n < time.Now().Unix() {
+		t.Errorf("got X-RateLimit-Reset %q, want a time in the future", rec.Header().Get("X-RateLimit-Reset"))
+	}
+	if date, err := http.ParseTime(retryAfter(time.Duration(math.MaxInt64), "date")); err != nil || date.Before(time.Now()) {
+		t.Errorf("got Retry-After date %v, %v, want a date in the future", date, err)
+	}
+}
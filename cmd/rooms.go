@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RoomMessage is broadcast to the clients of a room, it names the replica
+// that delivered it to make visible that rooms are not shared across replicas
+type RoomMessage struct {
+	Room     string    `json:"room"`
+	Message  string    `json:"message"`
+	Hostname string    `json:"hostname"`
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+}
+
+type RoomPublishResponse struct {
+	Room      string `json:"room"`
+	Delivered int    `json:"delivered"`
+	Hostname  string `json:"hostname"`
+	Instance  string `json:"instance"`
+}
+
+// roomClient is a websocket connection joined to a room, messages are written
+// by its own goroutine through send
+type roomClient struct {
+	conn *websocket.Conn
+	send chan RoomMessage
+}
+
+const (
+	// largest message published to a room
+	maxRoomMessage = 64 << 10
+	// rooms with clients on this replica at most, each one a metric label
+	maxRooms = 100
+)
+
+var (
+	roomsMu sync.Mutex
+	rooms   = make(map[string]map[*roomClient]struct{})
+
+	roomUpgrader = websocket.Upgrader{
+		// the rooms are meant to be joined from any test page
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	roomClients = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "room_clients",
+		Help:      "WebSocket clients connected to this replica by room.",
+	}, []string{"room"})
+	roomMessages = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "room_messages_total",
+		Help:      "Messages broadcast by room.",
+	}, []string{"room"})
+)
+
+// broadcast the message to the clients of the room connected to this replica
+func broadcast(room, message string) int {
+	hostname, _ := os.Hostname()
+	msg := RoomMessage{Room: room, Message: message, Hostname: hostname, Instance: Instance.Name, Time: Now()}
+
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	clients, ok := rooms[room]
+	if !ok {
+		// nobody listens, and a room without clients has no metrics
+		return 0
+	}
+	delivered := 0
+	for c := range clients {
+		select {
+		case c.send <- msg:
+			delivered++
+		default:
+			// drop the message for clients not keeping up
+		}
+	}
+	roomMessages.WithLabelValues(room).Inc()
+	return delivered
+}
+
+// whether the room exists or a new one can be opened, the lock must be held
+func roomAvailable(room string) bool {
+	_, ok := rooms[room]
+	return ok || len(rooms) < maxRooms
+}
+
+// join the client to the room, false when the room cannot be opened
+func joinRoom(room string, c *roomClient) bool {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	if !roomAvailable(room) {
+		return false
+	}
+	if rooms[room] == nil {
+		rooms[room] = make(map[*roomClient]struct{})
+	}
+	rooms[room][c] = struct{}{}
+	roomClients.WithLabelValues(room).Inc()
+	return true
+}
+
+// remove the client from the room, and the room with its metrics once empty
+func leaveRoom(room string, c *roomClient) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	delete(rooms[room], c)
+	if len(rooms[room]) == 0 {
+		delete(rooms, room)
+		roomClients.DeleteLabelValues(room)
+		roomMessages.DeleteLabelValues(room)
+		return
+	}
+	roomClients.WithLabelValues(room).Dec()
+}
+
+// RoomHandler joins a WebSocket client to the room /ws/rooms/{name} (GET) or
+// broadcasts the request body to the room (POST). Rooms live in the memory of
+// each replica on purpose: a message only reaches the clients connected to
+// the replica that received it. A replica holds at most 100 rooms with
+// clients.
+func RoomHandler(w http.ResponseWriter, r *http.Request) {
+	room := strings.TrimPrefix(r.URL.Path, "/ws/rooms/")
+	if room == "" || strings.Contains(room, "/") {
+		http.Error(w, "Invalid room name.", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		serveRoomClient(w, r, room)
+	case "POST":
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRoomMessage))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hostname, _ := os.Hostname()
+		writeJSON(w, http.StatusOK, RoomPublishResponse{
+			Room:      room,
+			Delivered: broadcast(room, string(body)),
+			Hostname:  hostname,
+			Instance:  Instance.Name,
+		})
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveRoomClient upgrades the connection and relays messages until the client leaves,
+// messages sent by the client are broadcast to the room as well
+func serveRoomClient(w http.ResponseWriter, r *http.Request, room string) {
+	roomsMu.Lock()
+	available := roomAvailable(room)
+	roomsMu.Unlock()
+	if !available {
+		http.Error(w, "Too many rooms on this replica.", http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := roomUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already answered with an error
+		return
+	}
+	c := &roomClient{conn: conn, send: make(chan RoomMessage, 16)}
+	if !joinRoom(room, c) {
+		// another client opened the last room meanwhile
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many rooms"))
+		conn.Close()
+		return
+	}
+
+	// the writer stops when the reader sees the client leaving
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case msg := <-c.send:
+				if err := conn.WriteJSON(msg); err != nil {
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	conn.SetReadLimit(maxRoomMessage)
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		broadcast(room, string(message))
+	}
+
+	leaveRoom(room, c)
+	close(quit)
+	<-done
+	conn.Close()
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoomsAreBounded(t *testing.T) {
+	clients := make([]*roomClient, maxRooms)
+	for i := range clients {
+		clients[i] = &roomClient{send: make(chan RoomMessage, 1)}
+		if !joinRoom(fmt.Sprint("room-", i), clients[i]) {
+			t.Fatalf("room %d could not be opened", i)
+		}
+	}
+	defer func() {
+		for i, c := range clients {
+			leaveRoom(fmt.Sprint("room-", i), c)
+		}
+	}()
+
+	if joinRoom("one-too-many", &roomClient{}) {
+		t.Error("a room beyond the limit was opened")
+	}
+	extra := &roomClient{}
+	if !joinRoom("room-0", extra) {
+		t.Error("an existing room could not be joined")
+	}
+	defer leaveRoom("room-0", extra)
+
+	w := httptest.NewRecorder()
+	RoomHandler(w, httptest.NewRequest("GET", "/ws/rooms/one-too-many", nil))
+	if w.Code != 503 {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+}
+
+func TestBroadcastToMissingRoom(t *testing.T) {
+	if n := broadcast("nobody-here", "hello"); n != 0 {
+		t.Errorf("delivered %d messages, want 0", n)
+	}
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	if _, ok := rooms["nobody-here"]; ok {
+		t.Error("publishing opened the room")
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+)
+
+type RuntimeResponse struct {
+	GOMAXPROCS int `json:"gomaxprocs"`
+	NumCPU     int `json:"num_cpu"`
+	// -1 when the garbage collector is off
+	GOGC int `json:"gogc"`
+	// bytes, -1 when there is no limit
+	GOMEMLIMIT   int64  `json:"gomemlimit"`
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapSys      uint64 `json:"heap_sys"`
+	HeapReleased uint64 `json:"heap_released"`
+	NumGC        uint32 `json:"num_gc"`
+}
+
+// GOMAXPROCS is at most this multiple of the CPUs, beyond it only adds
+// scheduling overhead
+const maxProcsPerCPU = 4
+
+// serializes the read-modify-write of GOGC
+var gcPercentMu sync.Mutex
+
+func currentRuntime() RuntimeResponse {
+	gcPercentMu.Lock()
+	gogc := debug.SetGCPercent(100)
+	debug.SetGCPercent(gogc)
+	gcPercentMu.Unlock()
+	if gogc < 0 {
+		gogc = -1
+	}
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = -1
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return RuntimeResponse{
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		GOGC:         gogc,
+		GOMEMLIMIT:   limit,
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapSys:      m.HeapSys,
+		HeapReleased: m.HeapReleased,
+		NumGC:        m.NumGC,
+	}
+}
+
+// RuntimeHandler reports the Go runtime settings and memory (GET), or changes
+// them (POST): gomaxprocs (up to 4 per CPU), gogc (a percent or off), gomemlimit (a size such as
+// 512MB or off), and gc=true or free_os_memory=true to collect the garbage,
+// the latter also returning as much memory as possible to the system
+func RuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, currentRuntime())
+		return
+	case "POST":
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	procs, err := queryInt(r, "gomaxprocs", 0)
+	if maxProcs := maxProcsPerCPU * runtime.NumCPU(); err != nil || procs < 0 || procs > maxProcs {
+		http.Error(w, fmt.Sprintf("gomaxprocs must be a positive integer up to %d.", maxProcs), http.StatusBadRequest)
+		return
+	}
+	gogc := 0
+	if v := q.Get("gogc"); v == "off" {
+		gogc = -1
+	} else if v != "" {
+		if gogc, err = strconv.Atoi(v); err != nil || gogc < 0 {
+			http.Error(w, "gogc must be a positive percent or off.", http.StatusBadRequest)
+			return
+		}
+	}
+	var limit int64
+	if v := q.Get("gomemlimit"); v == "off" {
+		limit = math.MaxInt64
+	} else if v != "" {
+		if limit, err = parseSize(v); err != nil || limit == 0 {
+			http.Error(w, "gomemlimit must be a size such as 512MB or off.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if procs > 0 {
+		runtime.GOMAXPROCS(procs)
+	}
+	if q.Has("gogc") {
+		gcPercentMu.Lock()
+		debug.SetGCPercent(gogc)
+		gcPercentMu.Unlock()
+	}
+	if limit > 0 {
+		debug.SetMemoryLimit(limit)
+	}
+	if q.Get("free_os_memory") == "true" {
+		debug.FreeOSMemory()
+	} else if q.Get("gc") == "true" {
+		runtime.GC()
+	}
+	writeJSON(w, http.StatusOK, currentRuntime())
+}
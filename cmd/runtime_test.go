@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestRuntimeHandlerCapsProcs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, tc := range []struct {
+		procs int
+		code  int
+	}{
+		{1, http.StatusOK},
+		{maxProcsPerCPU * runtime.NumCPU(), http.StatusOK},
+		{maxProcsPerCPU*runtime.NumCPU() + 1, http.StatusBadRequest},
+		{1 << 30, http.StatusBadRequest},
+		{-1, http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		RuntimeHandler(rec, httptest.NewRequest("POST", fmt.Sprintf("/runtime?gomaxprocs=%d", tc.procs), nil))
+		if rec.Code != tc.code {
+			t.Errorf("gomaxprocs=%d: got status %d, want %d", tc.procs, rec.Code, tc.code)
+		}
+	}
+}
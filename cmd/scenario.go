@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ScenarioCPU is the CPU load held during a phase
+type ScenarioCPU struct {
+	// low, medium (default), high or max
+	Intensity string `json:"intensity,omitempty"`
+	// workers burning the CPU, default 1
+	Cores int `json:"cores,omitempty"`
+}
+
+// ScenarioPhase is a behavior held for its duration: the chaos faults injected
+// on every route, a CPU load and memory held, and a signal sent to the process
+// when the phase starts. A phase without any of them is healthy
+type ScenarioPhase struct {
+	Name     string       `json:"name"`
+	Duration Duration     `json:"duration,omitempty"`
+	Chaos    *Chaos       `json:"chaos,omitempty"`
+	CPU      *ScenarioCPU `json:"cpu,omitempty"`
+	MemoryMB int          `json:"memory_mb,omitempty"`
+	// such as SIGTERM or SIGKILL to crash, the phase may then have no duration
+	Signal string `json:"signal,omitempty"`
+}
+
+// Scenario plays its phases one after the other, over and over with Loop
+type Scenario struct {
+	Name   string          `json:"name"`
+	Phases []ScenarioPhase `json:"phases"`
+	Loop   bool            `json:"loop,omitempty"`
+}
+
+type ScenarioStatus struct {
+	Scenario
+	// running, finished or stopped
+	State   string    `json:"state"`
+	Started time.Time `json:"started"`
+	// phase being played and the time left in it
+	Phase          string   `json:"phase,omitempty"`
+	PhaseIndex     int      `json:"phase_index"`
+	PhaseRemaining Duration `json:"phase_remaining,omitempty"`
+	// complete plays of the phases
+	Loops int `json:"loops"`
+}
+
+type scenarioRun struct {
+	status       ScenarioStatus
+	phaseStarted time.Time
+	// the chaos settings before the scenario, restored when it is over
+	previous Chaos
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+const scenarioPath = "/scenario"
+
+var (
+	scenarioMu sync.Mutex
+	scenario   *scenarioRun
+	// held across the stop of a scenario and the start of the next one
+	scenarioControlMu sync.Mutex
+
+	scenarioPhase = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "scenario_phase",
+		Help:      "Phase of the scenario being played, 1 for the current one.",
+	}, []string{"scenario", "phase"})
+)
+
+func (s Scenario) validate() error {
+	if len(s.Phases) == 0 {
+		return errors.New("a scenario needs at least one phase")
+	}
+	var total Duration
+	for i, p := range s.Phases {
+		total += p.Duration
+		if p.Name == "" {
+			return fmt.Errorf("phase %d needs a name", i)
+		}
+		if p.Duration < 0 || (p.Duration == 0 && p.Signal == "") {
+			return fmt.Errorf("invalid phase %q: duration must be greater than 0, unless the phase sends a signal", p.Name)
+		}
+		if p.Chaos != nil {
+			if err := p.Chaos.validate(); err != nil {
+				return fmt.Errorf("invalid phase %q: %w", p.Name, err)
+			}
+		}
+		if err := validateLoad(p.CPU, p.MemoryMB, p.Signal); err != nil {
+			return fmt.Errorf("invalid phase %q: %w", p.Name, err)
+		}
+	}
+	if s.Loop && total == 0 {
+		return errors.New("a looping scenario needs phases lasting more than 0")
+	}
+	return nil
+}
+
+func validateLoad(cpu *ScenarioCPU, memoryMB int, signal string) error {
+	if cpu != nil {
+		if _, ok := intensityLevels[cpu.Intensity]; !ok && cpu.Intensity != "" {
+			return errors.New("intensity must be low, medium, high or max")
+		}
+		if cpu.Cores < 0 || cpu.Cores > 256 {
+			return errors.New("cores must be between 1 and 256")
+		}
+	}
+	if memoryMB < 0 || memoryMB > 64<<10 {
+		return errors.New("memory_mb must be between 0 and 65536")
+	}
+	if _, ok := signals[signal]; !ok && signal != "" {
+		return fmt.Errorf("unknown signal %q", signal)
+	}
+	return nil
+}
+
+// snapshot of the status with the phase remaining time computed, the lock must be held
+func (s *scenarioRun) snapshot() ScenarioStatus {
+	status := s.status
+	status.Started = Skew(s.status.Started)
+	if status.State == "running" {
+		phase := s.status.Phases[s.status.PhaseIndex]
+		status.PhaseRemaining = Duration(max(0, time.Duration(phase.Duration)-time.Since(s.phaseStarted)))
+	}
+	return status
+}
+
+func setChaos(c Chaos) {
+	chaosMu.Lock()
+	defer chaosMu.Unlock()
+	chaos = c
+}
+
+// StartScenario stops the scenario being played, if any, and plays this one
+func StartScenario(s Scenario) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	scenarioControlMu.Lock()
+	defer scenarioControlMu.Unlock()
+	stopScenario()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chaosMu.RLock()
+	previous := chaos
+	chaosMu.RUnlock()
+	run := &scenarioRun{
+		status:   ScenarioStatus{Scenario: s, State: "running", Started: time.Now()},
+		previous: previous,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	scenarioMu.Lock()
+	scenario = run
+	scenarioMu.Unlock()
+	go playScenario(ctx, run)
+	return nil
+}
+
+// StopScenario stops the scenario being played and waits for its faults to be removed
+func StopScenario() {
+	scenarioControlMu.Lock()
+	defer scenarioControlMu.Unlock()
+	stopScenario()
+}
+
+// the scenarioControlMu lock must be held
+func stopScenario() {
+	scenarioMu.Lock()
+	run := scenario
+	scenarioMu.Unlock()
+	if run == nil {
+		return
+	}
+	run.cancel()
+	<-run.done
+}
+
+func playScenario(ctx context.Context, run *scenarioRun) {
+	defer close(run.done)
+	s := run.status.Scenario
+	state := "finished"
+	defer func() {
+		setChaos(run.previous)
+		scenarioPhase.Reset()
+		scenarioMu.Lock()
+		run.status.State = state
+		run.status.Phase = ""
+		scenarioMu.Unlock()
+		slog.Info("scenario over", "scenario", s.Name, "state", state)
+	}()
+
+	for {
+		for i, p := range s.Phases {
+			if !playPhase(ctx, run, i, p) {
+				state = "stopped"
+				return
+			}
+		}
+		if !s.Loop {
+			return
+		}
+		scenarioMu.Lock()
+		run.status.Loops++
+		scenarioMu.Unlock()
+	}
+}
+
+// play the phase until its duration is over, false when the scenario is stopped before
+func playPhase(ctx context.Context, run *scenarioRun, index int, p ScenarioPhase) bool {
+	scenarioMu.Lock()
+	run.status.Phase = p.Name
+	run.status.PhaseIndex = index
+	run.phaseStarted = time.Now()
+	scenarioMu.Unlock()
+	slog.Info("scenario phase", "scenario", run.status.Name, "phase", p.Name, "duration", p.Duration)
+	scenarioPhase.Reset()
+	scenarioPhase.WithLabelValues(run.status.Name, p.Name).Set(1)
+
+	c := Chaos{}
+	if p.Chaos != nil {
+		c = *p.Chaos
+	}
+	setChaos(c)
+
+	cpu, memory := holdLoad(p.CPU, p.MemoryMB, p.Duration)
+	if p.Signal != "" {
+		signalSelf(p.Signal, signals[p.Signal])
+	}
+
+	select {
+	case <-time.After(time.Duration(p.Duration)):
+		return true
+	case <-ctx.Done():
+		if cpu != nil {
+			cpu.cancel()
+		}
+		if memory != nil {
+			deallocateMemory(memory.Key)
+		}
+		return false
+	}
+}
+
+// start the CPU load and allocate the memory held for the duration, they
+// show up in /cpu/jobs and /memory/allocations
+func holdLoad(c *ScenarioCPU, memoryMB int, duration Duration) (*CPUJob, *MemoryAllocation) {
+	var cpu *CPUJob
+	if c != nil && duration > 0 {
+		intensity := c.Intensity
+		if intensity == "" {
+			intensity = "medium"
+		}
+		cpu = &CPUJob{
+			JobKey:    newID(),
+			Intensity: intensity,
+			Pattern:   "steady",
+			Period:    Duration(time.Minute),
+			Cores:     max(1, c.Cores),
+			Duration:  duration,
+			Started:   time.Now(),
+		}
+		startCPUJob(cpu, patternShare(intensityLevels[intensity], cpuPatterns["steady"], time.Minute), nil)
+	}
+	var memory *MemoryAllocation
+	if memoryMB > 0 && duration > 0 {
+		memory = &MemoryAllocation{
+			Key:       newID(),
+			Mode:      "fixed",
+			SizeMB:    memoryMB,
+			Duration:  duration,
+			Allocated: time.Now(),
+		}
+		holdMemory(memory)
+	}
+	return cpu, memory
+}
+
+// ScenarioHandler shows (GET), starts (POST) or stops (DELETE) the scenario
+// playing timed behavior phases, such as healthy for 5m then 20% of 500s for
+// 2m then a crash
+func ScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var s Scenario
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := StartScenario(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		StopScenario()
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scenarioMu.Lock()
+	defer scenarioMu.Unlock()
+	if scenario == nil {
+		http.Error(w, "No scenario played.", http.StatusNotFound)
+		return
+	}
+	status := http.StatusOK
+	if r.Method == "POST" {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, scenario.snapshot())
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScenarioRestoresChaos(t *testing.T) {
+	defer setChaos(Chaos{})
+	before := Chaos{Percent: 10, Latency: Duration(time.Millisecond)}
+	setChaos(before)
+	err := StartScenario(Scenario{Name: "test", Phases: []ScenarioPhase{{Name: "errors", Duration: Duration(time.Hour), Chaos: &Chaos{Percent: 100, ErrorRate: 100}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	StopScenario()
+	chaosMu.RLock()
+	after := chaos
+	chaosMu.RUnlock()
+	if after.Percent != before.Percent || after.Latency != before.Latency || after.ErrorRate != 0 {
+		t.Errorf("got chaos %+v after the scenario, want %+v", after, before)
+	}
+}
+
+func TestScenarioRejectsInstantLoop(t *testing.T) {
+	s := Scenario{Name: "crash", Loop: true, Phases: []ScenarioPhase{{Name: "crash", Signal: "SIGTERM"}}}
+	if err := s.validate(); err == nil {
+		t.Error("a loop of phases without duration was accepted")
+	}
+	s.Loop = false
+	if err := s.validate(); err != nil {
+		t.Errorf("a single crash was rejected: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ScheduledTask runs its actions every time its cron expression fires: a burst
+// of log lines, a CPU load and memory held for the duration, and a signal sent
+// to the process
+type ScheduledTask struct {
+	Name     string       `json:"name"`
+	Cron     string       `json:"cron"`
+	Duration Duration     `json:"duration,omitempty"`
+	LogLines int          `json:"log_lines,omitempty"`
+	CPU      *ScenarioCPU `json:"cpu,omitempty"`
+	MemoryMB int          `json:"memory_mb,omitempty"`
+	Signal   string       `json:"signal,omitempty"`
+
+	// the schedule follows the clock of the process, skew included
+	Runs    int        `json:"runs"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+	NextRun *time.Time `json:"next_run,omitempty"`
+
+	next     time.Time
+	schedule *cronSchedule
+	cancel   context.CancelFunc
+}
+
+// largest log burst of a run
+const maxScheduledLogLines = 100000
+
+var (
+	scheduleMu sync.Mutex
+	schedule   = make(map[string]*ScheduledTask)
+
+	scheduledRuns = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "scheduled_runs_total",
+		Help:      "Runs of the scheduled tasks, by task name.",
+	}, []string{"task"})
+)
+
+func (t *ScheduledTask) validate() error {
+	if t.Name == "" {
+		return errors.New("a scheduled task needs a name")
+	}
+	var err error
+	if t.schedule, err = parseCron(t.Cron); err != nil {
+		return fmt.Errorf("invalid task %q: %w", t.Name, err)
+	}
+	if t.LogLines < 0 || t.LogLines > maxScheduledLogLines {
+		return fmt.Errorf("invalid task %q: log_lines must be between 0 and %d", t.Name, maxScheduledLogLines)
+	}
+	if err := validateLoad(t.CPU, t.MemoryMB, t.Signal); err != nil {
+		return fmt.Errorf("invalid task %q: %w", t.Name, err)
+	}
+	if (t.CPU != nil || t.MemoryMB > 0) && t.Duration <= 0 {
+		return fmt.Errorf("invalid task %q: the cpu and memory actions need a duration", t.Name)
+	}
+	if t.LogLines == 0 && t.CPU == nil && t.MemoryMB == 0 && t.Signal == "" {
+		return fmt.Errorf("invalid task %q: expected at least one of log_lines, cpu, memory_mb or signal", t.Name)
+	}
+	return nil
+}
+
+// snapshot of the task, the lock must be held
+func (t *ScheduledTask) snapshot() ScheduledTask {
+	s := *t
+	s.schedule = nil
+	s.cancel = nil
+	// none when the expression never fires
+	if !t.next.IsZero() {
+		next := t.next
+		s.NextRun = &next
+	}
+	return s
+}
+
+// AddScheduledTasks validates the tasks and starts them, replacing the tasks with the same names
+func AddScheduledTasks(tasks []ScheduledTask) error {
+	for i := range tasks {
+		if err := tasks[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range tasks {
+		t := tasks[i]
+		t.Runs, t.LastRun = 0, nil
+		ctx, cancel := context.WithCancel(context.Background())
+		t.cancel = cancel
+
+		scheduleMu.Lock()
+		if old, ok := schedule[t.Name]; ok {
+			old.cancel()
+		}
+		t.next = t.schedule.next(Now())
+		schedule[t.Name] = &t
+		scheduleMu.Unlock()
+		go runScheduledTask(ctx, &t)
+	}
+	return nil
+}
+
+// removeScheduledTask stops the task, false when it does not exist
+func removeScheduledTask(name string) bool {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	t, ok := schedule[name]
+	if !ok {
+		return false
+	}
+	t.cancel()
+	delete(schedule, name)
+	return true
+}
+
+// wait for every firing of the task schedule and run its actions, until the task is removed
+func runScheduledTask(ctx context.Context, t *ScheduledTask) {
+	for {
+		scheduleMu.Lock()
+		next := t.next
+		scheduleMu.Unlock()
+		if next.IsZero() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(Now())):
+		}
+
+		scheduleMu.Lock()
+		t.Runs++
+		last := Now()
+		t.LastRun = &last
+		t.next = t.schedule.next(last)
+		scheduleMu.Unlock()
+
+		scheduledRuns.WithLabelValues(t.Name).Inc()
+		slog.Info("scheduled task run", "task", t.Name, "cron", t.Cron)
+		for i := 0; i < t.LogLines; i++ {
+			slog.Info("scheduled log line", "task", t.Name, "line", i+1, "of", t.LogLines)
+		}
+		holdLoad(t.CPU, t.MemoryMB, t.Duration)
+		if t.Signal != "" {
+			signalSelf(t.Signal, signals[t.Signal])
+		}
+	}
+}
+
+// ScheduleHandler lists (GET), adds or replaces by name (POST) or removes (DELETE)
+// the scheduled tasks, DELETE /schedule/{name} removes one of them. POST takes
+// a single task or an array of them
+func ScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/schedule"), "/")
+	if name != "" {
+		if r.Method != "DELETE" {
+			http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+			return
+		}
+		if !removeScheduledTask(name) {
+			http.Error(w, fmt.Sprintf("Scheduled task %s not found.", name), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var tasks []ScheduledTask
+		if err := json.Unmarshal(raw, &tasks); err != nil {
+			var t ScheduledTask
+			if err := json.Unmarshal(raw, &t); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			tasks = []ScheduledTask{t}
+		}
+		if err := AddScheduledTasks(tasks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		scheduleMu.Lock()
+		for name, t := range schedule {
+			t.cancel()
+			delete(schedule, name)
+		}
+		scheduleMu.Unlock()
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scheduleMu.Lock()
+	tasks := []ScheduledTask{}
+	for _, t := range schedule {
+		tasks = append(tasks, t.snapshot())
+	}
+	scheduleMu.Unlock()
+	sort.Slice(tasks, func(i, k int) bool { return tasks[i].Name < tasks[k].Name })
+	writeJSON(w, http.StatusOK, tasks)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// SecurityHeaders are the values of the security headers added to every
+// response, an empty value leaves the header out
+type SecurityHeaders struct {
+	StrictTransportSecurity string `json:"strict_transport_security,omitempty"`
+	ContentSecurityPolicy   string `json:"content_security_policy,omitempty"`
+	FrameOptions            string `json:"x_frame_options,omitempty"`
+	ContentTypeOptions      string `json:"x_content_type_options,omitempty"`
+	ReferrerPolicy          string `json:"referrer_policy,omitempty"`
+}
+
+// recommended values, enabled with ?defaults=true
+var defaultSecurityHeaders = SecurityHeaders{
+	StrictTransportSecurity: "max-age=31536000; includeSubDomains",
+	ContentSecurityPolicy:   "default-src 'self'",
+	FrameOptions:            "DENY",
+	ContentTypeOptions:      "nosniff",
+	ReferrerPolicy:          "no-referrer",
+}
+
+var (
+	securityHeadersMu sync.RWMutex
+	securityHeaders   SecurityHeaders
+)
+
+// SetSecurityHeaders sets the security headers added to every response
+func SetSecurityHeaders(s SecurityHeaders) {
+	securityHeadersMu.Lock()
+	defer securityHeadersMu.Unlock()
+	securityHeaders = s
+}
+
+// set the headers with a value
+func (s SecurityHeaders) apply(h http.Header) {
+	for name, value := range map[string]string{
+		"Strict-Transport-Security": s.StrictTransportSecurity,
+		"Content-Security-Policy":   s.ContentSecurityPolicy,
+		"X-Frame-Options":           s.FrameOptions,
+		"X-Content-Type-Options":    s.ContentTypeOptions,
+		"Referrer-Policy":           s.ReferrerPolicy,
+	} {
+		if value != "" {
+			h.Set(name, value)
+		}
+	}
+}
+
+// SecurityHeadersMiddleware adds the security headers to every response, the
+// handlers may still override them
+func SecurityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		securityHeadersMu.RLock()
+		s := securityHeaders
+		securityHeadersMu.RUnlock()
+		s.apply(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SecurityHeadersHandler shows (GET), replaces (POST) or removes (DELETE) the
+// security headers of every response. POST takes the values as JSON, or
+// the recommended ones with defaults=true
+func SecurityHeadersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		s := defaultSecurityHeaders
+		if r.URL.Query().Get("defaults") != "true" {
+			s = SecurityHeaders{}
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		SetSecurityHeaders(s)
+	case "DELETE":
+		SetSecurityHeaders(SecurityHeaders{})
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	securityHeadersMu.RLock()
+	defer securityHeadersMu.RUnlock()
+	writeJSON(w, http.StatusOK, securityHeaders)
+}
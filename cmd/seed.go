@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const seedHeader = "X-Dummybox-Seed"
+
+// lockedSource makes a random source safe for concurrent use
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+type seedKey struct{}
+
+// random source of every randomized behavior, seeded from the clock unless a seed is set
+var random = newRand(time.Now().UnixNano())
+
+func newRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+}
+
+// SetSeed makes the randomized behaviors reproducible, 0 keeps them random
+func SetSeed(seed int64) {
+	if seed != 0 {
+		random = newRand(seed)
+	}
+}
+
+// SeedMiddleware gives the request its own random source when it has a seed
+// query parameter, so its randomized behavior can be replayed exactly
+func SeedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("seed")
+		if v == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid seed: %q is not an integer", v), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(seedHeader, v)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), seedKey{}, newRand(seed))))
+	})
+}
+
+// requestRand is the random source of the request, the global one when the
+// request has no seed
+func requestRand(r *http.Request) *rand.Rand {
+	if rng, ok := r.Context().Value(seedKey{}).(*rand.Rand); ok {
+		return rng
+	}
+	return random
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+type CheckResult struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Duration string `json:"duration"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type SelftestResponse struct {
+	Passed bool          `json:"passed"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type selftestCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// SelftestHandler runs a quick battery of internal checks and reports pass/fail per check
+func SelftestHandler(w http.ResponseWriter, r *http.Request) {
+
+	// the DNS lookup target can be overridden to match the cluster egress rules
+	dnsHost := r.URL.Query().Get("dns_host")
+	if dnsHost == "" {
+		dnsHost = "example.com"
+	}
+
+	checks := []selftestCheck{
+		{"template", checkTemplate},
+		{"metrics", checkMetrics},
+		{"cpu", checkCPU},
+		{"memory", checkMemory},
+		{"dns", func(ctx context.Context) (string, error) { return checkDNS(ctx, dnsHost) }},
+	}
+
+	resp := SelftestResponse{Passed: true}
+	for _, check := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		start := time.Now()
+		detail, err := check.run(ctx)
+		cancel()
+
+		result := CheckResult{
+			Name:     check.name,
+			Passed:   err == nil,
+			Duration: time.Since(start).String(),
+			Detail:   detail,
+		}
+		if err != nil {
+			result.Error = err.Error()
+			resp.Passed = false
+		}
+		resp.Checks = append(resp.Checks, result)
+	}
+
+	status := http.StatusOK
+	if !resp.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// render the info page with the shared layout
+func checkTemplate(ctx context.Context) (string, error) {
+	var buf bytes.Buffer
+	err := infoPage.ExecuteTemplate(&buf, "layout", pageData{Title: "selftest", Instance: Instance, Version: Version, Data: InfoResponse{}})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rendered %d bytes", buf.Len()), nil
+}
+
+// gather all registered metrics
+func checkMetrics(ctx context.Context) (string, error) {
+	families, err := Registry.Gather()
+	if err != nil {
+		return "", err
+	}
+	if len(families) == 0 {
+		return "", errors.New("no metric families registered")
+	}
+	return fmt.Sprintf("%d metric families", len(families)), nil
+}
+
+// keep one core busy hashing for a short period
+func checkCPU(ctx context.Context) (string, error) {
+	deadline := time.Now().Add(50 * time.Millisecond)
+	sum := sha256.Sum256(nil)
+	rounds := 0
+	for time.Now().Before(deadline) {
+		sum = sha256.Sum256(sum[:])
+		rounds++
+	}
+	return fmt.Sprintf("%d hash rounds", rounds), nil
+}
+
+// allocate a block of memory, touch every page, and release it
+func checkMemory(ctx context.Context) (string, error) {
+	const size = 16 << 20
+	block := make([]byte, size)
+	for i := 0; i < len(block); i += 4096 {
+		block[i] = 1
+	}
+	runtime.GC()
+	return fmt.Sprintf("allocated and released %d MB", size>>20), nil
+}
+
+// resolve an outbound host name
+func checkDNS(ctx context.Context, host string) (string, error) {
+	addrs, err := outboundLookup(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s resolved to %v", host, addrs), nil
+}
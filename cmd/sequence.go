@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// counted calls of a fail-first sequence
+type sequence struct {
+	calls    int
+	lastCall time.Time
+}
+
+type SequenceStatus struct {
+	Key   string `json:"key"`
+	Calls int    `json:"calls"`
+}
+
+// beyond maxSequences the sequences idle for longer, then random ones, are
+// forgotten
+const (
+	maxSequences    = 10000
+	sequenceIdleTTL = time.Hour
+)
+
+var (
+	sequencesMu sync.Mutex
+	sequences   = make(map[string]*sequence)
+)
+
+// count a call of the sequence and return its number, starting at 1
+func nextSequenceCall(key string) int {
+	sequencesMu.Lock()
+	defer sequencesMu.Unlock()
+	s, ok := sequences[key]
+	if !ok {
+		if len(sequences) >= maxSequences {
+			for k, old := range sequences {
+				if time.Since(old.lastCall) > sequenceIdleTTL {
+					delete(sequences, k)
+				}
+			}
+			for k := range sequences {
+				if len(sequences) < maxSequences*9/10 {
+					break
+				}
+				delete(sequences, k)
+			}
+		}
+		s = &sequence{}
+		sequences[key] = s
+	}
+	s.calls++
+	s.lastCall = time.Now()
+	return s.calls
+}
+
+// key of the fail-first sequence of the request: the sequence_key parameter,
+// or the correlation ID sent by the client
+func sequenceKey(r *http.Request) string {
+	if key := r.URL.Query().Get("sequence_key"); key != "" {
+		return key
+	}
+	return r.Header.Get(correlationIDHeader)
+}
+
+// SequencesHandler lists the /respond fail-first sequences (GET /respond/sequences),
+// resets all of them (DELETE /respond/sequences) or one of them
+// (DELETE /respond/sequences/{key})
+func SequencesHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/respond/sequences"), "/")
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		sequencesMu.Lock()
+		if key == "" {
+			sequences = make(map[string]*sequence)
+		} else {
+			delete(sequences, key)
+		}
+		sequencesMu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sequencesMu.Lock()
+	defer sequencesMu.Unlock()
+	if key != "" {
+		s, ok := sequences[key]
+		if !ok {
+			http.Error(w, "Sequence "+key+" not found.", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, SequenceStatus{Key: key, Calls: s.calls})
+		return
+	}
+	statuses := []SequenceStatus{}
+	for k, s := range sequences {
+		statuses = append(statuses, SequenceStatus{Key: k, Calls: s.calls})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Key < statuses[j].Key })
+	writeJSON(w, http.StatusOK, statuses)
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSequencesBounded(t *testing.T) {
+	defer func() { sequences = make(map[string]*sequence) }()
+	// every sequence is recent, none of them is idle
+	for i := 0; i < maxSequences+10; i++ {
+		nextSequenceCall(strconv.Itoa(i))
+	}
+	if n := len(sequences); n > maxSequences {
+		t.Errorf("got %d sequences, want at most %d", n, maxSequences)
+	}
+	if calls := nextSequenceCall("new"); calls != 1 {
+		t.Errorf("new sequence: got call %d, want 1", calls)
+	}
+}
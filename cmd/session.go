@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	sessionCookie = "dummybox_session"
+	// sessions idle for longer, then random ones, are forgotten once there are
+	// too many of them
+	maxSessions    = 10000
+	sessionIdleTTL = time.Hour
+)
+
+// SessionResponse reports whether the session sticks to the instance serving it
+type SessionResponse struct {
+	Session  string `json:"session"`
+	Instance string `json:"instance"`
+	Node     string `json:"node,omitempty"`
+	New      bool   `json:"new"`
+	// requests of the session on every instance, carried by the cookie
+	Hits int `json:"hits"`
+	// requests of the session on this instance
+	InstanceHits int `json:"instance_hits"`
+	// instance of the previous request, and whether it is this one
+	PreviousInstance string `json:"previous_instance,omitempty"`
+	Sticky           bool   `json:"sticky"`
+	// times the session moved to another instance
+	Switches int `json:"switches"`
+}
+
+type sessionState struct {
+	hits     int
+	lastSeen time.Time
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*sessionState)
+
+	sessionRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "session_requests_total",
+		Help:      "Requests of /session by affinity: new, sticky or switched.",
+	}, []string{"affinity"})
+)
+
+// count a request of the session on this instance and return its number
+func nextSessionHit(id string) int {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[id]
+	if !ok {
+		if len(sessions) >= maxSessions {
+			for k, old := range sessions {
+				if time.Since(old.lastSeen) > sessionIdleTTL {
+					delete(sessions, k)
+				}
+			}
+			// random ones too when they are all active
+			for k := range sessions {
+				if len(sessions) < maxSessions*9/10 {
+					break
+				}
+				delete(sessions, k)
+			}
+		}
+		s = &sessionState{}
+		sessions[id] = s
+	}
+	s.hits++
+	s.lastSeen = time.Now()
+	return s.hits
+}
+
+// SessionHandler issues a session cookie on the first visit and reports on
+// the next ones whether the requests of the session stick to the same
+// instance, to validate the session affinity of ingresses and Services.
+// The cookie carries the hits and the last instance, so any replica can tell.
+// DELETE ends the session
+func SessionHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "POST":
+	case "DELETE":
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := SessionResponse{Instance: Instance.Name, Node: Instance.Node}
+	var state url.Values
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		state, _ = url.ParseQuery(c.Value)
+	}
+	if state.Get("id") == "" {
+		state = url.Values{"id": {newID()}}
+		resp.New = true
+	}
+	resp.Session = state.Get("id")
+	resp.Hits, _ = strconv.Atoi(state.Get("hits"))
+	resp.Switches, _ = strconv.Atoi(state.Get("switches"))
+	resp.PreviousInstance = state.Get("instance")
+
+	resp.Hits++
+	resp.InstanceHits = nextSessionHit(resp.Session)
+	affinity := "new"
+	if !resp.New {
+		resp.Sticky = resp.PreviousInstance == Instance.Name
+		affinity = "sticky"
+		if !resp.Sticky {
+			resp.Switches++
+			affinity = "switched"
+		}
+	}
+	sessionRequests.WithLabelValues(affinity).Inc()
+
+	state.Set("hits", strconv.Itoa(resp.Hits))
+	state.Set("switches", strconv.Itoa(resp.Switches))
+	state.Set("instance", Instance.Name)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    state.Encode(),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
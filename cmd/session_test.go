@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestNextSessionHitBounded(t *testing.T) {
+	defer func() { sessions = make(map[string]*sessionState) }()
+	for i := 0; i < maxSessions+10; i++ {
+		nextSessionHit(strconv.Itoa(i))
+	}
+	if n := len(sessions); n > maxSessions {
+		t.Errorf("got %d sessions, want at most %d", n, maxSessions)
+	}
+	if hits := nextSessionHit("new"); hits != 1 {
+		t.Errorf("got %d hits for a new session, want 1", hits)
+	}
+}
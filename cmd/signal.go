@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+var signals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGSEGV": syscall.SIGSEGV,
+	"SIGABRT": syscall.SIGABRT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// SignalHandler sends the signal (default SIGTERM) to the process itself after delay
+func SignalHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("signal")
+	if name == "" {
+		name = "SIGTERM"
+	}
+	sig, ok := signals[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown signal %q.", name), http.StatusBadRequest)
+		return
+	}
+	delay, err := queryDuration(r, "delay", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	go func() {
+		time.Sleep(delay)
+		signalSelf(name, sig)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "The process receives %s in %s.\n", name, delay)
+}
+
+// send the signal to the process itself
+func signalSelf(name string, sig syscall.Signal) {
+	slog.Warn("sending signal to self", "signal", name)
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(sig); err != nil {
+		slog.Error("signal not sent", "signal", name, "error", err)
+	}
+}
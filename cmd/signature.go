@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// SignatureSettings configures the verification of the HMAC signature of
+// the requests to the paths, an empty secret disables it. The signature
+// covers the timestamp header, the method, the path, the query and the body,
+// a timestamp further than Tolerance from now or a signature already seen is
+// rejected
+type SignatureSettings struct {
+	Secret          string   `json:"-"`
+	Algorithm       string   `json:"algorithm"`
+	Header          string   `json:"header"`
+	TimestampHeader string   `json:"timestamp_header"`
+	Tolerance       Duration `json:"tolerance"`
+	Paths           []string `json:"paths"`
+}
+
+// SignatureFailure details why the signature of a request was rejected
+type SignatureFailure struct {
+	Error     string `json:"error"`
+	Header    string `json:"header"`
+	Algorithm string `json:"algorithm"`
+	// the lines signed before the body: timestamp, method, path and query
+	Signed []string `json:"signed"`
+	// the body the signature was checked against
+	BodyBytes  int    `json:"body_bytes"`
+	BodySHA256 string `json:"body_sha256"`
+}
+
+const (
+	// largest request body verified
+	maxSignedBody = 10 << 20
+	// signatures remembered to reject their replay
+	maxSeenSignatures = 100000
+)
+
+var signatureAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+var (
+	signatureSettings SignatureSettings
+
+	// the accepted signatures until their timestamp leaves the tolerance
+	seenSignaturesMu sync.Mutex
+	seenSignatures   = make(map[string]time.Time)
+
+	signatureVerifications = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "signature_verifications_total",
+		Help:      "Signatures of requests verified by result: valid, missing, malformed, expired, mismatch or replayed.",
+	}, []string{"result"})
+)
+
+// SetSignature configures the verification of the request signatures
+func SetSignature(s SignatureSettings) error {
+	s.Algorithm = strings.ToLower(s.Algorithm)
+	if _, ok := signatureAlgorithms[s.Algorithm]; !ok {
+		return fmt.Errorf("invalid signature algorithm %q, expected sha1, sha256 or sha512", s.Algorithm)
+	}
+	if s.Header == "" {
+		return errors.New("empty signature header")
+	}
+	if s.TimestampHeader == "" {
+		return errors.New("empty signature timestamp header")
+	}
+	if s.Tolerance <= 0 {
+		return fmt.Errorf("invalid signature tolerance %s, it must be positive", time.Duration(s.Tolerance))
+	}
+	signatureSettings = s
+	return nil
+}
+
+// whether the path is one of the signed paths or below one of them
+func signedPath(path string) bool {
+	for _, p := range signatureSettings.Paths {
+		if pathWithin(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// the bytes the signature is computed over: the timestamp, the method, the
+// path and the raw query each followed by a newline, then the body
+func signedContent(timestamp string, r *http.Request, body []byte) []byte {
+	content := []byte(timestamp + "\n" + r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n")
+	return append(content, body...)
+}
+
+// check the timestamp, in Unix seconds, is within the tolerance of now
+func checkSignatureTimestamp(timestamp string, now time.Time) (string, error) {
+	if timestamp == "" {
+		return "missing", fmt.Errorf("missing %s header", signatureSettings.TimestampHeader)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "malformed", errors.New("signature timestamp is not a number of Unix seconds")
+	}
+	tolerance := time.Duration(signatureSettings.Tolerance)
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > tolerance || skew < -tolerance {
+		return "expired", fmt.Errorf("signature timestamp %s from now, the tolerance is %s", skew.Round(time.Second), tolerance)
+	}
+	return "", nil
+}
+
+// check the signature header against the signed content, the header is the
+// hex or base64 HMAC, optionally prefixed by the algorithm as in
+// sha256=<hex>. It returns the failed result and the reason
+func checkSignature(header string, content []byte) (string, error) {
+	if header == "" {
+		return "missing", fmt.Errorf("missing %s header", signatureSettings.Header)
+	}
+	if algorithm, value, ok := strings.Cut(header, "="); ok && signatureAlgorithms[strings.ToLower(algorithm)] != nil {
+		if !strings.EqualFold(algorithm, signatureSettings.Algorithm) {
+			return "malformed", fmt.Errorf("signature computed with %s, expected %s", algorithm, signatureSettings.Algorithm)
+		}
+		header = value
+	}
+
+	mac := hmac.New(signatureAlgorithms[signatureSettings.Algorithm], []byte(signatureSettings.Secret))
+	mac.Write(content)
+	expected := mac.Sum(nil)
+	got, err := hex.DecodeString(header)
+	if err != nil {
+		if got, err = base64.StdEncoding.DecodeString(header); err != nil {
+			if got, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(header, "=")); err != nil {
+				return "malformed", errors.New("signature is neither hex nor base64")
+			}
+		}
+	}
+	if len(got) != len(expected) {
+		return "malformed", fmt.Errorf("signature of %d bytes, a %s HMAC has %d", len(got), signatureSettings.Algorithm, len(expected))
+	}
+	if !hmac.Equal(got, expected) {
+		return "mismatch", fmt.Errorf("signature does not match the %s HMAC of the request", signatureSettings.Algorithm)
+	}
+	return "valid", nil
+}
+
+// remember the signed content of a valid signature, by its hash, until it
+// leaves the tolerance, false when it was already seen. When full, the expired signatures are dropped first,
+// then random ones
+func rememberSignature(key string, now time.Time) bool {
+	seenSignaturesMu.Lock()
+	defer seenSignaturesMu.Unlock()
+	if until, ok := seenSignatures[key]; ok && now.Before(until) {
+		return false
+	}
+	if len(seenSignatures) >= maxSeenSignatures {
+		for s, until := range seenSignatures {
+			if !now.Before(until) {
+				delete(seenSignatures, s)
+			}
+		}
+		for s := range seenSignatures {
+			if len(seenSignatures) < maxSeenSignatures*9/10 {
+				break
+			}
+			delete(seenSignatures, s)
+		}
+	}
+	// a timestamp ahead of now stays valid up to the tolerance past it
+	seenSignatures[key] = now.Add(2 * time.Duration(signatureSettings.Tolerance))
+	return true
+}
+
+// SignatureMiddleware rejects the requests to the signed paths whose HMAC
+// signature header does not match, whose timestamp is out of the tolerance
+// or whose signature was already used, with the reason of the failure
+func SignatureMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signatureSettings.Secret == "" || !signedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxSignedBody {
+			http.Error(w, fmt.Sprintf("Signed body larger than %d bytes.", maxSignedBody), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		timestamp := strings.TrimSpace(r.Header.Get(signatureSettings.TimestampHeader))
+		signature := strings.TrimSpace(r.Header.Get(signatureSettings.Header))
+		result, err := checkSignatureTimestamp(timestamp, now)
+		content := signedContent(timestamp, r, body)
+		if err == nil {
+			result, err = checkSignature(signature, content)
+		}
+		if err == nil {
+			// the content rather than the signature, whose encodings vary
+			sum := sha256.Sum256(content)
+			if !rememberSignature(string(sum[:]), now) {
+				result, err = "replayed", errors.New("signature already used")
+			}
+		}
+		signatureVerifications.WithLabelValues(result).Inc()
+		if err != nil {
+			sum := sha256.Sum256(body)
+			writeJSON(w, http.StatusUnauthorized, SignatureFailure{
+				Error:      err.Error(),
+				Header:     signatureSettings.Header,
+				Algorithm:  signatureSettings.Algorithm,
+				Signed:     []string{timestamp, r.Method, r.URL.EscapedPath(), r.URL.RawQuery},
+				BodyBytes:  len(body),
+				BodySHA256: hex.EncodeToString(sum[:]),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
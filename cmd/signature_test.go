@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestamp, method, path, query, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n" + query + "\n" + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	if err := SetSignature(SignatureSettings{
+		Secret:          "shared",
+		Algorithm:       "sha256",
+		Header:          "X-Signature",
+		TimestampHeader: "X-Signature-Timestamp",
+		Tolerance:       Duration(time.Minute),
+		Paths:           []string{"/cpu"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { signatureSettings = SignatureSettings{} }()
+	h := SignatureMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name, timestamp, signature, query string
+		want                              int
+	}{
+		{"valid", now, sign("shared", now, "POST", "/cpu", "seconds=1", "{}"), "seconds=1", http.StatusOK},
+		{"replayed", now, sign("shared", now, "POST", "/cpu", "seconds=1", "{}"), "seconds=1", http.StatusUnauthorized},
+		{"other query", now, sign("shared", now, "POST", "/cpu", "seconds=1", "{}"), "seconds=9", http.StatusUnauthorized},
+		{"expired", old, sign("shared", old, "POST", "/cpu", "", "{}"), "", http.StatusUnauthorized},
+		{"no timestamp", "", sign("shared", "", "POST", "/cpu", "", "{}"), "", http.StatusUnauthorized},
+		{"wrong secret", now, sign("other", now, "POST", "/cpu", "", "{}"), "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/cpu?"+tt.query, strings.NewReader("{}"))
+		req.Header.Set("X-Signature", tt.signature)
+		if tt.timestamp != "" {
+			req.Header.Set("X-Signature-Timestamp", tt.timestamp)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("unsigned path: got status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// SLOSettings configures the error budget maintained by /slo and the
+// requests to the paths, and the paths below them
+type SLOSettings struct {
+	// target success ratio in percent, e.g. 99.5
+	Target float64 `json:"target"`
+	// rolling window the success ratio is measured over
+	Window Duration `json:"window"`
+	// routes sharing the error budget of /slo, "*" for all of them
+	Paths []string `json:"paths"`
+}
+
+type SLOResponse struct {
+	Target       float64 `json:"target"`
+	Window       string  `json:"window"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	SuccessRatio float64 `json:"success_ratio"`
+	Failed       bool    `json:"failed"`
+}
+
+// outcomes of the requests during one second of the window
+type sloBucket struct {
+	second          int64
+	requests, fails int
+}
+
+var (
+	sloMu       sync.Mutex
+	sloSettings SLOSettings
+	sloBuckets  []sloBucket
+
+	sloRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "slo_requests_total",
+		Help:      "Requests counted by the error budget of /slo and the SLO paths by result.",
+	}, []string{"result"})
+	sloRatio = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "slo_success_ratio",
+		Help:      "Success ratio of /slo and the SLO paths measured over the rolling window.",
+	})
+)
+
+// SetSLO configures the error budget mode and clears the window
+func SetSLO(s SLOSettings) {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	sloSettings = s
+	seconds := max(int(time.Duration(s.Window)/time.Second), 1)
+	sloBuckets = make([]sloBucket, seconds)
+}
+
+// requests and errors counted in the window, the lock must be held
+func sloCounts(now int64) (int, int) {
+	requests, fails := 0, 0
+	for _, b := range sloBuckets {
+		if now-b.second < int64(len(sloBuckets)) {
+			requests += b.requests
+			fails += b.fails
+		}
+	}
+	return requests, fails
+}
+
+// whether one more error, counted with the requests, still fits in the error
+// budget of the window, the lock must be held
+func sloBudgetLeft(requests, fails int) bool {
+	return float64(fails+1)/float64(requests+1) <= 1-sloSettings.Target/100
+}
+
+// count the outcome of a request in its second and export the success ratio,
+// the lock must be held
+func sloAdd(now int64, failed bool) {
+	b := &sloBuckets[now%int64(len(sloBuckets))]
+	if b.second != now {
+		*b = sloBucket{second: now}
+	}
+	b.requests++
+	if failed {
+		b.fails++
+	}
+	requests, fails := sloCounts(now)
+	sloRatio.Set(1 - float64(fails)/float64(requests))
+	if failed {
+		sloRequests.WithLabelValues("error").Inc()
+	} else {
+		sloRequests.WithLabelValues("success").Inc()
+	}
+}
+
+// sloRecord decides whether the request fails and records the outcome. A
+// request fails when the errors, including it, still fit in the error budget
+// of the window, so the success ratio converges to the target.
+func sloRecord() SLOResponse {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+
+	now := time.Now().Unix()
+	failed := sloBudgetLeft(sloCounts(now))
+	sloAdd(now, failed)
+	requests, fails := sloCounts(now)
+	ratio := 1 - float64(fails)/float64(requests)
+	return SLOResponse{
+		Target:       sloSettings.Target,
+		Window:       time.Duration(sloSettings.Window).String(),
+		Requests:     requests,
+		Errors:       fails,
+		SuccessRatio: ratio * 100,
+		Failed:       failed,
+	}
+}
+
+// SLOHandler fails just enough requests to keep the success ratio over the
+// rolling window at the target
+func SLOHandler(w http.ResponseWriter, r *http.Request) {
+	resp := sloRecord()
+	status := http.StatusOK
+	if resp.Failed {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, resp)
+}
+
+// whether the path shares the error budget, /slo counts itself
+func sloPath(path string) bool {
+	if pathWithin(path, "/slo") {
+		return false
+	}
+	for _, p := range sloSettings.Paths {
+		if pathWithin(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// SLOMiddleware keeps the success ratio of the requests to the SLO paths at
+// the target along with /slo: their 5xx answers count as errors, and they are
+// failed with 500 as long as the error budget of the window allows it
+func SLOMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sloPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sloMu.Lock()
+		now := time.Now().Unix()
+		inject := sloBudgetLeft(sloCounts(now))
+		if inject {
+			sloAdd(now, true)
+		}
+		sloMu.Unlock()
+		if inject {
+			http.Error(w, "Error injected within the error budget of the SLO.", http.StatusInternalServerError)
+			return
+		}
+
+		rec := &StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		sloMu.Lock()
+		sloAdd(time.Now().Unix(), rec.Status >= 500)
+		sloMu.Unlock()
+	})
+}
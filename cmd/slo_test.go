@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSLOMiddleware(t *testing.T) {
+	SetSLO(SLOSettings{Target: 90, Window: Duration(time.Minute), Paths: []string{"/payload"}})
+	defer SetSLO(SLOSettings{Window: Duration(time.Minute)})
+
+	h := SLOMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	errors := 0
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/payload", nil))
+		if rec.Code == http.StatusInternalServerError {
+			errors++
+		}
+	}
+	if errors < 9 || errors > 10 {
+		t.Errorf("got %d errors out of 100 requests, want about 10 for a 90%% target", errors)
+	}
+
+	// the other paths neither count nor fail
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/healthz: got status %d, want 200", rec.Code)
+		}
+	}
+	// the errors of the handlers spend the budget of the injected ones
+	failing := SLOMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	for i := 0; i < 10; i++ {
+		failing.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/payload", nil))
+	}
+	if resp := sloRecord(); resp.Requests != 111 || resp.Errors != errors+10 || resp.Failed {
+		t.Errorf("got %+v, want 111 requests, %d errors and /slo not failed", resp, errors+10)
+	}
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"net/http"
+)
+
+// ServerSettings describes the protections of the HTTP server against slow clients
+type ServerSettings struct {
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	MaxHeaderBytes    int      `json:"max_header_bytes"`
+}
+
+type SlowlorisResponse struct {
+	Settings    ServerSettings     `json:"settings"`
+	Connections ConnectionSettings `json:"connections"`
+	Effects     map[string]string  `json:"effects"`
+}
+
+var Server ServerSettings
+
+// SlowlorisHandler describes the current slow client protection settings
+func SlowlorisHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, SlowlorisResponse{
+		Settings:    Server,
+		Connections: Connections,
+		Effects: map[string]string{
+			"read_header_timeout":   "connections sending the request headers slower than this are closed, 0 disables the limit",
+			"read_timeout":          "connections sending the whole request (headers and body) slower than this are closed, 0 disables the limit",
+			"idle_timeout":          "keep-alive connections without a new request for this long are closed",
+			"max_header_bytes":      "requests with larger headers are rejected with 431",
+			"force_close":           "every response asks the client to close the connection",
+			"max_requests_per_conn": "connections are closed after serving this many requests, 0 means unlimited",
+			"idle_close_ratio":      "probability of closing a keep-alive connection as soon as it becomes idle",
+		},
+	})
+}
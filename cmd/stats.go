@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+type StatsSnapshot struct {
+	Time       time.Time `json:"time"`
+	BatchJobs  int       `json:"batch_jobs"`
+	HeapMB     float64   `json:"heap_mb"`
+	Goroutines int       `json:"goroutines"`
+	Inflight   int       `json:"inflight"`
+	RPS        float64   `json:"rps"`
+}
+
+// count the running batch jobs
+func activeBatchJobs() int {
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	n := 0
+	for _, j := range batchJobs {
+		if j.Status == batchRunning {
+			n++
+		}
+	}
+	return n
+}
+
+func countInflight() int {
+	n := 0
+	inflight.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// StatsStreamHandler pushes a snapshot of the job and system statistics every
+// second as server-sent events, e.g. curl -N localhost:8080/stats/stream
+func StatsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last, lastTime := inflightID.Load(), time.Now()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case now := <-ticker.C:
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+
+			// every request gets an in-flight id, so their difference is the number of requests
+			served := inflightID.Load()
+			snapshot := StatsSnapshot{
+				Time:       Skew(now),
+				BatchJobs:  activeBatchJobs(),
+				HeapMB:     float64(mem.HeapAlloc) / (1 << 20),
+				Goroutines: runtime.NumGoroutine(),
+				Inflight:   countInflight(),
+				RPS:        float64(served-last) / now.Sub(lastTime).Seconds(),
+			}
+			last, lastTime = served, now
+
+			data, _ := json.Marshal(snapshot)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
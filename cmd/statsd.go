@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsDSettings configures the mirroring of the dummybox metrics to a StatsD
+// or DogStatsD agent
+type StatsDSettings struct {
+	// host:port of the agent, empty disables the export
+	Addr     string   `json:"addr"`
+	Interval Duration `json:"interval"`
+	// dogstatsd sends the labels as tags, statsd appends their values to the name
+	Format string `json:"format"`
+}
+
+// largest UDP payload sent to the agent, below the usual MTU
+const statsdPacketSize = 1432
+
+// closed to stop the export, done is closed once the last send is over
+var statsdStop, statsdDone chan struct{}
+
+// StartStatsD sends the samplebox_ metrics of the registry to the agent every
+// interval: counters as their increase since the last send, gauges as they are,
+// histograms and summaries as the increase of their count and sum
+func StartStatsD(s StatsDSettings) error {
+	if s.Format != "statsd" && s.Format != "dogstatsd" {
+		return fmt.Errorf("invalid statsd format %q, expected statsd or dogstatsd", s.Format)
+	}
+	if s.Interval <= 0 {
+		return fmt.Errorf("invalid statsd interval %v, it must be greater than 0", s.Interval)
+	}
+	conn, err := net.Dial("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	log.Default().Printf("Sending metrics to StatsD agent %s", s.Addr)
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	statsdStop, statsdDone = stop, done
+	go func() {
+		defer close(done)
+		defer conn.Close()
+		ticker := time.NewTicker(time.Duration(s.Interval))
+		defer ticker.Stop()
+		last := make(map[string]float64)
+		for {
+			select {
+			case <-ticker.C:
+				last = sendStatsD(conn, s.Format, last)
+			case <-stop:
+				sendStatsD(conn, s.Format, last)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopStatsD sends the final values to the agent and stops the export, it
+// does nothing when the export is disabled
+func StopStatsD() {
+	if statsdStop == nil {
+		return
+	}
+	close(statsdStop)
+	<-statsdDone
+	statsdStop = nil
+}
+
+// send the metrics in packets, returning the counter values sent
+func sendStatsD(conn net.Conn, format string, last map[string]float64) map[string]float64 {
+	families, err := Registry.Gather()
+	if err != nil {
+		log.Default().Printf("StatsD export: %v", err)
+		return last
+	}
+	lines, next := statsdLines(families, format, last)
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line) >= statsdPacketSize {
+			conn.Write(packet.Bytes())
+			packet.Reset()
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		conn.Write(packet.Bytes())
+	}
+	return next
+}
+
+// statsdLines converts the metric families, last holds the counter values of
+// the previous send to compute their increase. The values of this send are
+// returned for the next one, the series gone since are forgotten
+func statsdLines(families []*dto.MetricFamily, format string, last map[string]float64) ([]string, map[string]float64) {
+	var lines []string
+	next := make(map[string]float64, len(last))
+	for _, f := range families {
+		name, ok := strings.CutPrefix(f.GetName(), "samplebox_")
+		if !ok {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			// the key identifies the series between two sends
+			key := f.GetName()
+			var tags []string
+			for _, l := range m.GetLabel() {
+				key += "," + l.GetName() + "=" + l.GetValue()
+				tags = append(tags, l.GetName()+":"+statsdTagSanitizer.Replace(l.GetValue()))
+			}
+			sort.Strings(tags)
+			delta := func(suffix string, v float64) float64 {
+				next[key+suffix] = v
+				return v - last[key+suffix]
+			}
+			add := func(suffix, kind string, v float64) {
+				// counters that did not move are left out
+				if kind == "c" && v == 0 {
+					return
+				}
+				lines = append(lines, statsdLine(name, suffix, kind, v, m.GetLabel(), tags, format))
+			}
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", "c", delta("", m.GetCounter().GetValue()))
+			case dto.MetricType_GAUGE:
+				add("", "g", m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				add(".count", "c", delta(".count", float64(m.GetHistogram().GetSampleCount())))
+				add(".sum", "c", delta(".sum", m.GetHistogram().GetSampleSum()))
+			case dto.MetricType_SUMMARY:
+				add(".count", "c", delta(".count", float64(m.GetSummary().GetSampleCount())))
+				add(".sum", "c", delta(".sum", m.GetSummary().GetSampleSum()))
+			}
+		}
+	}
+	return lines, next
+}
+
+func statsdLine(name, suffix, kind string, v float64, labels []*dto.LabelPair, tags []string, format string) string {
+	name = "dummybox." + name
+	value := strconv.FormatFloat(v, 'f', -1, 64)
+	if format == "dogstatsd" {
+		name += suffix
+		if len(tags) > 0 {
+			return name + ":" + value + "|" + kind + "|#" + strings.Join(tags, ",") + "\n"
+		}
+		return name + ":" + value + "|" + kind + "\n"
+	}
+	for _, l := range labels {
+		name += "." + statsdSanitizer.Replace(l.GetValue())
+	}
+	return name + suffix + ":" + value + "|" + kind + "\n"
+}
+
+var (
+	// the characters with a meaning in the StatsD protocol or in the metric paths
+	statsdSanitizer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ".", "_", "/", "_", " ", "_", "\n", "_", "\r", "_")
+	// the characters ending a DogStatsD tag or its line
+	statsdTagSanitizer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_", "\r", "_")
+)
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatsdLines(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "samplebox_test_total"}, []string{"path"})
+	reg.MustRegister(c)
+	c.WithLabelValues("a|b,c#d\ne").Add(2)
+	c.WithLabelValues("gone").Add(1)
+
+	families, _ := reg.Gather()
+	lines, last := statsdLines(families, "dogstatsd", map[string]float64{})
+	want := []string{"dummybox.test_total:2|c|#path:a_b_c_d_e\n", "dummybox.test_total:1|c|#path:gone\n"}
+	if !slices.Equal(lines, want) {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+
+	c.DeleteLabelValues("gone")
+	c.WithLabelValues("a|b,c#d\ne").Add(3)
+	families, _ = reg.Gather()
+	lines, last = statsdLines(families, "statsd", last)
+	if want := []string{"dummybox.test_total.a_b,c#d_e:3|c\n"}; !slices.Equal(lines, want) {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+	if len(last) != 1 {
+		t.Errorf("got %d series remembered, want the gone one forgotten", len(last))
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WeightedCode is a status code chosen with a relative weight
+type WeightedCode struct {
+	Code   int `json:"code"`
+	Weight int `json:"weight"`
+}
+
+// the highest weight of a code, the sum of the weights stays far from an
+// overflow
+const maxCodeWeight = 1000000
+
+// parse "200:8,500:2" into weighted codes, a code without weight weighs 1
+func parseWeightedCodes(s string) ([]WeightedCode, error) {
+	var codes []WeightedCode
+	for _, item := range strings.Split(s, ",") {
+		codeText, weightText, hasWeight := strings.Cut(strings.TrimSpace(item), ":")
+		code, err := strconv.Atoi(codeText)
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("invalid code %q, expected a status code between 200 and 599", codeText)
+		}
+		weight := 1
+		if hasWeight {
+			if weight, err = strconv.Atoi(weightText); err != nil || weight < 1 || weight > maxCodeWeight {
+				return nil, fmt.Errorf("invalid weight %q of code %d, expected an integer between 1 and %d", weightText, code, maxCodeWeight)
+			}
+		}
+		codes = append(codes, WeightedCode{Code: code, Weight: weight})
+	}
+	return codes, nil
+}
+
+// pick one of the codes with a probability proportional to its weight
+func pickCode(rng *rand.Rand, codes []WeightedCode) int {
+	total := 0
+	for _, c := range codes {
+		total += c.Weight
+	}
+	n := rng.Intn(total)
+	for _, c := range codes {
+		if n < c.Weight {
+			return c.Code
+		}
+		n -= c.Weight
+	}
+	return codes[len(codes)-1].Code
+}
+
+// StatusHandler answers /status/{codes} with the code, or one of the
+// comma separated weighted codes such as /status/200:8,500:2
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	codes, err := parseWeightedCodes(strings.TrimPrefix(r.URL.Path, "/status/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	code := pickCode(requestRand(r), codes)
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%d %s\n", code, http.StatusText(code))
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestParseWeightedCodes(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []WeightedCode
+	}{
+		{"200", []WeightedCode{{200, 1}}},
+		{"200:8, 500:2", []WeightedCode{{200, 8}, {500, 2}}},
+		{"503:1000000", []WeightedCode{{503, 1000000}}},
+	} {
+		got, err := parseWeightedCodes(tc.in)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("parseWeightedCodes(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", "abc", "199", "600", "200:0", "200:-1", "200:x", "200:1000001", "500:9223372036854775807,200:1"} {
+		if got, err := parseWeightedCodes(in); err == nil {
+			t.Errorf("parseWeightedCodes(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestPickCode(t *testing.T) {
+	codes := []WeightedCode{{200, 1}, {500, 0}, {503, 3}}
+	rng := rand.New(rand.NewSource(1))
+	counts := map[int]int{}
+	for i := 0; i < 4000; i++ {
+		counts[pickCode(rng, codes)]++
+	}
+	if counts[500] != 0 || counts[200] < 800 || counts[503] < 2800 {
+		t.Errorf("got %v, want about 1000 200 and 3000 503", counts)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	activeStreams = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "active_streams",
+		Help:      "Number of currently open infinite streams.",
+	})
+	streamBytes = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "stream_bytes_total",
+		Help:      "Bytes sent on infinite streams.",
+	})
+)
+
+// InfiniteStreamHandler writes a chunk of chunk_size bytes every interval
+// until the client disconnects
+func InfiniteStreamHandler(w http.ResponseWriter, r *http.Request) {
+	chunkSize, err := queryInt(r, "chunk_size", 1024)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if chunkSize < 1 || chunkSize > 1<<20 {
+		http.Error(w, "chunk_size must be between 1 and 1048576 bytes.", http.StatusBadRequest)
+		return
+	}
+	interval, err := queryDuration(r, "interval", time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	activeStreams.Inc()
+	defer activeStreams.Dec()
+
+	// a line of dots terminated by a newline, so the stream is readable with curl -N
+	chunk := append(bytes.Repeat([]byte("."), chunkSize-1), '\n')
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(max(interval, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		n, err := w.Write(chunk)
+		streamBytes.Add(float64(n))
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	tcpConnections = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "tcp_connections_total",
+		Help:      "Connections accepted by the raw TCP server.",
+	})
+	tcpActiveConnections = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "tcp_active_connections",
+		Help:      "Connections currently open on the raw TCP server.",
+	})
+	tcpBytes = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "tcp_bytes_total",
+		Help:      "Bytes received and sent by the raw TCP server.",
+	}, []string{"direction"})
+)
+
+// countingWriter counts the bytes written through it in the counter
+type countingWriter struct {
+	w       io.Writer
+	counter prometheus.Counter
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
+
+// chargenReader reads the RFC 864 character generator lines: 72 printable
+// characters, shifted by one on every line
+type chargenReader struct {
+	line int
+	pos  int
+}
+
+func (c *chargenReader) Read(p []byte) (int, error) {
+	const printable, width = 95, 72
+	for i := range p {
+		if c.pos == width {
+			p[i] = '\r'
+		} else if c.pos == width+1 {
+			p[i] = '\n'
+		} else {
+			p[i] = byte(' ' + (c.line+c.pos)%printable)
+		}
+		c.pos++
+		if c.pos == width+2 {
+			c.pos = 0
+			c.line++
+		}
+	}
+	return len(p), nil
+}
+
+func serveTCP(conn net.Conn, mode string) {
+	defer conn.Close()
+	tcpConnections.Inc()
+	tcpActiveConnections.Inc()
+	defer tcpActiveConnections.Dec()
+
+	received := countingWriter{w: io.Discard, counter: tcpBytes.WithLabelValues("received")}
+	sent := countingWriter{w: conn, counter: tcpBytes.WithLabelValues("sent")}
+	switch mode {
+	case "echo":
+		io.Copy(sent, io.TeeReader(conn, received))
+	case "discard":
+		io.Copy(received, conn)
+	case "chargen":
+		// whatever the client sends is discarded, the generator runs until it disconnects
+		go io.Copy(received, conn)
+		io.Copy(sent, &chargenReader{})
+	}
+}
+
+// StartTCPServer serves raw TCP connections on addr in the mode: echo sends
+// back what it receives, discard drops it and chargen sends characters forever
+func StartTCPServer(addr, mode string) error {
+	if mode != "echo" && mode != "discard" && mode != "chargen" {
+		return fmt.Errorf("invalid tcp mode %q, expected echo, discard or chargen", mode)
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		log.Default().Printf("TCP %s server running on %s", mode, addr)
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				// out of file descriptors or similar, keep accepting once it is over
+				log.Default().Printf("TCP accept: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			go serveTCP(conn, mode)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// throttledWriter writes the response body at rate bytes per second in chunks
+// of a tenth of a second, flushing every chunk so the client receives the
+// bytes at that pace
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	rate    float64
+	start   time.Time
+	written int64
+}
+
+// ResponseRateSettings caps the rate of the response bodies to Rate, a size
+// per second such as 512 or 1.5MB, except on the excluded paths. An empty or
+// 0 rate leaves them unthrottled
+type ResponseRateSettings struct {
+	Rate    string   `json:"rate"`
+	Exclude []string `json:"exclude"`
+}
+
+var (
+	// rate of every response body in bytes per second, 0 leaves them unthrottled
+	responseRate float64
+	// paths, and the paths below them, never throttled
+	responseRateExclude []string
+)
+
+// SetResponseRate caps the rate of every response body but the excluded ones
+func SetResponseRate(s ResponseRateSettings) error {
+	rate := int64(0)
+	if s.Rate != "" {
+		var err error
+		if rate, err = parseSize(s.Rate); err != nil {
+			return fmt.Errorf("invalid response rate: %w", err)
+		}
+	}
+	responseRate, responseRateExclude = float64(rate), s.Exclude
+	return nil
+}
+
+// throttle wraps the writer to send the body at rate bytes per second, the
+// writer is returned as is for a rate of 0
+func throttle(w http.ResponseWriter, r *http.Request, rate float64) http.ResponseWriter {
+	if rate <= 0 {
+		return w
+	}
+	return &throttledWriter{ResponseWriter: w, ctx: r.Context(), rate: rate}
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	if tw.start.IsZero() {
+		tw.start = time.Now()
+	}
+	chunk := max(1, int(tw.rate/10))
+	n := 0
+	for n < len(p) {
+		// wait until the bytes written so far are due
+		due := tw.start.Add(time.Duration(float64(tw.written) / tw.rate * float64(time.Second)))
+		select {
+		case <-time.After(time.Until(due)):
+		case <-tw.ctx.Done():
+			return n, tw.ctx.Err()
+		}
+
+		end := min(len(p), n+chunk)
+		c, err := tw.ResponseWriter.Write(p[n:end])
+		n += c
+		tw.written += int64(c)
+		if err != nil {
+			return n, err
+		}
+		http.NewResponseController(tw.ResponseWriter).Flush()
+	}
+	return n, nil
+}
+
+func (tw *throttledWriter) Flush() {
+	http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+func (tw *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(tw.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.NewResponseController access to the wrapped writer
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// parse the rate query parameter, bytes per second such as 512 or 10KB
+func queryRate(r *http.Request) (float64, error) {
+	v := r.URL.Query().Get("rate")
+	if v == "" {
+		return 0, nil
+	}
+	rate, err := parseSize(v)
+	if err != nil {
+		return 0, err
+	}
+	return float64(rate), nil
+}
+
+// ThrottleMiddleware caps the rate of every response body to the response
+// rate, the excluded paths are never throttled
+func ThrottleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range responseRateExclude {
+			if pathWithin(r.URL.Path, p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(throttle(w, r, responseRate), r)
+	})
+}
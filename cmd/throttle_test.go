@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestThrottleMiddlewareExclude(t *testing.T) {
+	if err := SetResponseRate(ResponseRateSettings{Rate: "1KB", Exclude: []string{"/healthz"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetResponseRate(ResponseRateSettings{})
+
+	var got http.ResponseWriter
+	h := ThrottleMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = w }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	if _, ok := got.(*throttledWriter); ok {
+		t.Error("excluded path: the body is throttled")
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/payload", nil))
+	if _, ok := got.(*throttledWriter); !ok {
+		t.Error("other path: the body is not throttled")
+	}
+}
+
+func TestSetResponseRate(t *testing.T) {
+	defer SetResponseRate(ResponseRateSettings{})
+	if err := SetResponseRate(ResponseRateSettings{Rate: "fast"}); err == nil {
+		t.Error("invalid rate accepted")
+	}
+	if err := SetResponseRate(ResponseRateSettings{}); err != nil || responseRate != 0 {
+		t.Errorf("empty rate: got %v, %v, want unthrottled", responseRate, err)
+	}
+}
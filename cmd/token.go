@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenResponse is shaped like an OAuth 2.0 token response
+type TokenResponse struct {
+	AccessToken string         `json:"access_token"`
+	TokenType   string         `json:"token_type"`
+	ExpiresIn   int64          `json:"expires_in,omitempty"`
+	IDToken     string         `json:"id_token,omitempty"`
+	Scope       string         `json:"scope,omitempty"`
+	Claims      map[string]any `json:"claims,omitempty"`
+}
+
+var (
+	// RSA key signing the tokens of /token, published by /jwks
+	signingMu  sync.Mutex
+	signingKey *rsa.PrivateKey
+	signingKID string
+)
+
+// load the PEM encoded RSA private key signing the tokens, PKCS #1 or PKCS #8
+func loadSigningKey(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("no PEM data in %s", path)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return fmt.Errorf("no RSA private key in %s: %w", path, err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return fmt.Errorf("no RSA private key in %s", path)
+		}
+	}
+	signingMu.Lock()
+	defer signingMu.Unlock()
+	setSigningKey(key)
+	return nil
+}
+
+// set the signing key and its id, the lock must be held
+func setSigningKey(key *rsa.PrivateKey) {
+	signingKey = key
+	// the RFC 7638 thumbprint, replicas sharing the key share the id
+	jwk := rsaJWK(&key.PublicKey, "")
+	thumbprint, _ := json.Marshal(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+	sum := sha256.Sum256(thumbprint)
+	signingKID = base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// the signing key and its id, generated on first use when none was loaded
+func currentSigningKey() (*rsa.PrivateKey, string, error) {
+	signingMu.Lock()
+	defer signingMu.Unlock()
+	if signingKey == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, "", err
+		}
+		setSigningKey(key)
+	}
+	return signingKey, signingKID, nil
+}
+
+// public key of the tokens minted here, when the id is the one of the signing key
+func ownSigningKey(kid string) (crypto.PublicKey, bool) {
+	signingMu.Lock()
+	defer signingMu.Unlock()
+	if signingKey == nil || kid != signingKID {
+		return nil, false
+	}
+	return &signingKey.PublicKey, true
+}
+
+func rsaJWK(pub *rsa.PublicKey, kid string) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// sign the claims with the algorithm, HS* with the mint secret and RS* or PS*
+// with the signing key
+func mintJWT(alg string, claims map[string]any) (string, error) {
+	if len(alg) != 5 {
+		return "", fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	hashFunc, ok := jwtHashes[alg[2:]]
+	if !ok {
+		return "", fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	var key *rsa.PrivateKey
+	switch alg[:2] {
+	case "HS":
+		if jwtSettings.MintSecret == "" {
+			return "", errors.New("HMAC tokens need a mint secret, none is configured")
+		}
+	case "RS", "PS":
+		var err error
+		if key, header["kid"], err = currentSigningKey(); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	encode := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signingInput := encode(header) + "." + encode(claims)
+	var signature []byte
+	if key == nil {
+		mac := hmac.New(hashFunc.New, []byte(jwtSettings.MintSecret))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	} else {
+		h := hashFunc.New()
+		h.Write([]byte(signingInput))
+		var err error
+		if alg[:2] == "RS" {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, hashFunc, h.Sum(nil))
+		} else {
+			signature, err = rsa.SignPSS(rand.Reader, key, hashFunc, h.Sum(nil), nil)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// standard claims of a token valid for ttl from now, no expiry for 0
+func defaultClaims(ttl time.Duration) map[string]any {
+	now := Now()
+	claims := map[string]any{
+		"iss": "dummybox",
+		"sub": "dummybox",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"jti": newID(),
+	}
+	if jwtSettings.Issuer != "" {
+		claims["iss"] = jwtSettings.Issuer
+	}
+	if jwtSettings.Audience != "" {
+		claims["aud"] = jwtSettings.Audience
+	}
+	if ttl > 0 {
+		claims["exp"] = now.Add(ttl).Unix()
+	}
+	return claims
+}
+
+// TokenHandler mints a JWT signed with the algorithm alg (RS256 by default,
+// HS256/384/512 with the mint secret, RS and PS ones with the key of /jwks),
+// valid for ttl (1h by default, 0 for no expiry). The JSON object of the body
+// adds to or overrides the default claims. The minting requires an auth
+// token. A form with a grant_type is handled by the OIDC token endpoint
+// instead, authenticating its clients itself
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Has("grant_type") {
+			oauthTokenHandler(w, r, form)
+			return
+		}
+	}
+	TokenAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mintTokenHandler(w, r, body)
+	})).ServeHTTP(w, r)
+}
+
+// mint the token of the query and the claims of the body
+func mintTokenHandler(w http.ResponseWriter, r *http.Request, body []byte) {
+	ttl, err := queryDuration(r, "ttl", time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ttl < 0 {
+		http.Error(w, "ttl must not be negative.", http.StatusBadRequest)
+		return
+	}
+	alg := r.URL.Query().Get("alg")
+	if alg == "" {
+		alg = "RS256"
+	}
+
+	claims := defaultClaims(ttl)
+	var custom map[string]any
+	if err := json.Unmarshal(body, &custom); err != nil && len(bytes.TrimSpace(body)) > 0 {
+		http.Error(w, fmt.Sprintf("Invalid claims, expected a JSON object: %s.", err), http.StatusBadRequest)
+		return
+	}
+	for k, v := range custom {
+		claims[k] = v
+	}
+
+	token, err := mintJWT(alg, claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, TokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(ttl.Seconds()), Claims: claims})
+}
+
+// JWKSHandler publishes the public key signing the RS and PS tokens of /token
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	key, kid, err := currentSigningKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, JWKS{Keys: []JWK{rsaJWK(&key.PublicKey, kid)}})
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenHandlerRequiresAuth(t *testing.T) {
+	if err := SetAuthTokens([]AuthToken{{Name: "ci", Token: "secret", Scopes: []string{"/token"}}}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetAuthTokens(nil)
+
+	rec := httptest.NewRecorder()
+	TokenHandler(rec, httptest.NewRequest("POST", "/token", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("minting without token: got status %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest("POST", "/token", nil)
+	req.Header.Set("X-Auth-Token", "secret")
+	rec = httptest.NewRecorder()
+	TokenHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("minting with the token: got status %d, want 200", rec.Code)
+	}
+
+	// the OIDC clients authenticate with their own credentials
+	req = httptest.NewRequest("POST", "/token", strings.NewReader("grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("unknown", "wrong")
+	rec = httptest.NewRecorder()
+	TokenHandler(rec, req)
+	if !strings.Contains(rec.Body.String(), "invalid_client") {
+		t.Errorf("OIDC token request: got %d %s, want the invalid_client error", rec.Code, rec.Body)
+	}
+}
+
+func TestMintJWTSecret(t *testing.T) {
+	defer SetJWT(JWTSettings{})
+	SetJWT(JWTSettings{Secret: "verify"})
+	if _, err := mintJWT("HS256", defaultClaims(0)); err == nil {
+		t.Error("an HMAC token was minted without a mint secret")
+	}
+	SetJWT(JWTSettings{Secret: "verify", MintSecret: "mint"})
+	token, err := mintJWT("HS256", defaultClaims(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("got token %q", token)
+	}
+	req := httptest.NewRequest("GET", "/auth/jwt", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	JWTAuthHandler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("a token of the mint secret verified against another secret: got status %d", rec.Code)
+	}
+}
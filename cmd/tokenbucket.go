@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds up to capacity tokens and refills rate tokens per second
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity, rate float64) *tokenBucket {
+	return &tokenBucket{capacity: capacity, rate: rate, tokens: capacity, last: time.Now()}
+}
+
+// refill adds the tokens earned since the last call, the lock must be held
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// take removes a token when available, otherwise it returns how long to wait for the next one
+func (b *tokenBucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, b.timeFor(1 - b.tokens)
+}
+
+// time to earn the tokens, the longest duration when the rate is that slow
+func (b *tokenBucket) timeFor(tokens float64) time.Duration {
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	if d := tokens / b.rate * float64(time.Second); d < math.MaxInt64 {
+		return time.Duration(d)
+	}
+	return time.Duration(math.MaxInt64)
+}
+
+// remaining number of whole tokens and time until the bucket is full again
+func (b *tokenBucket) state() (int, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.rate <= 0 {
+		return int(b.tokens), 0
+	}
+	return int(b.tokens), b.timeFor(b.capacity - b.tokens)
+}
+
+// whether the bucket refilled to its capacity, it then holds no state worth
+// keeping
+func (b *tokenBucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= b.capacity
+}
+
+// longest window and reset written in the headers, in seconds
+const maxHeaderSeconds = math.MaxInt32
+
+// whole seconds of the headers, bounded to fit an int however slow the rate
+func headerSeconds(seconds float64) int {
+	return int(min(math.Ceil(seconds), maxHeaderSeconds))
+}
+
+// RateLimitHeaders selects how rate limited endpoints describe their quota:
+// "draft" sends RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset,
+// "structured" sends the single RateLimit field, "legacy" sends X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (a Unix time), and "none" sends
+// nothing. The draft and structured styles come with RateLimit-Policy.
+var RateLimitHeaders = "draft"
+
+// writeHeaders describes the quota of the bucket in the response headers, in
+// one of the RateLimitHeaders styles
+func (b *tokenBucket) writeHeaders(h http.Header, style string) {
+	if style == "none" {
+		return
+	}
+	remaining, reset := b.state()
+	limit := int(b.capacity)
+	resetSeconds := headerSeconds(reset.Seconds())
+	window := headerSeconds(b.capacity / b.rate)
+
+	if style == "legacy" {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(Now().Add(time.Duration(resetSeconds)*time.Second).Unix(), 10))
+		return
+	}
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit, window))
+	if style == "structured" {
+		h.Set("RateLimit", fmt.Sprintf("limit=%d, remaining=%d, reset=%d", limit, remaining, resetSeconds))
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(resetSeconds))
+}
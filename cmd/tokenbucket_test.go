@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketSlowRate(t *testing.T) {
+	for _, rate := range []float64{1e-300, 0} {
+		b := newTokenBucket(2, rate)
+		b.take()
+		b.take()
+		if ok, wait := b.take(); ok || wait <= 0 {
+			t.Errorf("rate %v: got %v and wait %v, want a positive wait", rate, ok, wait)
+		}
+		if _, reset := b.state(); reset < 0 {
+			t.Errorf("rate %v: got reset %v, want it not negative", rate, reset)
+		}
+
+		h := http.Header{}
+		b.writeHeaders(h, "draft")
+		window, _ := strings.CutPrefix(h.Get("RateLimit-Policy"), "2;w=")
+		if n, err := strconv.Atoi(window); err != nil || n <= 0 || n > maxHeaderSeconds {
+			t.Errorf("rate %v: got policy %q, want a window up to %d seconds", rate, h.Get("RateLimit-Policy"), maxHeaderSeconds)
+		}
+		if n, err := strconv.Atoi(h.Get("RateLimit-Reset")); err != nil || n < 0 || n > maxHeaderSeconds {
+			t.Errorf("rate %v: got reset %q", rate, h.Get("RateLimit-Reset"))
+		}
+	}
+}
+
+func TestTokenBucketTimeFor(t *testing.T) {
+	b := newTokenBucket(1, 2)
+	if got := b.timeFor(1); got != 500*time.Millisecond {
+		t.Errorf("got %v, want 500ms", got)
+	}
+}
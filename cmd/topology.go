@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"net/http"
+)
+
+// TopologyMiddleware adds the zone, region and version of this instance as
+// response headers, so clients can measure how traffic is distributed
+func TopologyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Instance.Zone != "" {
+			w.Header().Set("X-Dummybox-Zone", Instance.Zone)
+		}
+		if Instance.Region != "" {
+			w.Header().Set("X-Dummybox-Region", Instance.Region)
+		}
+		w.Header().Set("X-Dummybox-Version", Version)
+		next.ServeHTTP(w, r)
+	})
+}
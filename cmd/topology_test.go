@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTopologyMiddleware(t *testing.T) {
+	previous := Instance
+	defer func() { Instance = previous }()
+	Instance.Zone, Instance.Region = "zone-a", ""
+
+	rec := httptest.NewRecorder()
+	TopologyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if got := rec.Header().Get("X-Dummybox-Zone"); got != "zone-a" {
+		t.Errorf("X-Dummybox-Zone = %q, want zone-a", got)
+	}
+	if _, ok := rec.Header()["X-Dummybox-Region"]; ok {
+		t.Error("X-Dummybox-Region set without a region")
+	}
+	if got := rec.Header().Get("X-Dummybox-Version"); got != Version {
+		t.Errorf("X-Dummybox-Version = %q, want %q", got, Version)
+	}
+}
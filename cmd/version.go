@@ -1,14 +1,60 @@
 package cmd
 
 import (
-	"encoding/json"
 	"net/http"
+	"runtime"
+	"runtime/debug"
 )
 
-var Version = "development"
+// build metadata injected with -ldflags, see .ko.yaml
+var (
+	Version   = "development"
+	BuildDate = ""
+	GitCommit = ""
+)
+
+type VersionResponse struct {
+	Version   string       `json:"version"`
+	BuildDate string       `json:"build_date,omitempty"`
+	GitCommit string       `json:"git_commit,omitempty"`
+	GoVersion string       `json:"go_version"`
+	Instance  InstanceInfo `json:"instance"`
+}
+
+var versionPage = parsePage("version")
+
+// ResolveBuildInfo fills the build metadata not injected at build time from
+// the information embedded by the go toolchain
+func ResolveBuildInfo() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if Version == "development" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && GitCommit == "":
+			GitCommit = setting.Value
+		case setting.Key == "vcs.time" && BuildDate == "":
+			BuildDate = setting.Value
+		}
+	}
+}
 
 func VersionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"version": Version})
+	resp := VersionResponse{
+		Version:   requestVersion(r),
+		BuildDate: BuildDate,
+		GitCommit: GitCommit,
+		GoVersion: runtime.Version(),
+		Instance:  Instance,
+	}
+
+	if wantsHTML(r) {
+		writeHTML(w, r, http.StatusOK, versionPage, "version", resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
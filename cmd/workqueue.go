@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type WorkMessage struct {
+	Body     string    `json:"body"`
+	Produced time.Time `json:"produced"`
+}
+
+type WorkQueueResponse struct {
+	Messages []WorkMessage `json:"messages,omitempty"`
+	Depth    int           `json:"depth"`
+}
+
+const (
+	// largest message body accepted by /queue/produce
+	maxWorkMessage = 64 << 10
+	// messages the work queue holds at most
+	maxWorkMessages = 100000
+	// slowest and fastest background consumers, in messages per second
+	minWorkConsumeRate = 0.001
+	maxWorkConsumeRate = 1e6
+)
+
+var (
+	workMu       sync.Mutex
+	workMessages []WorkMessage
+
+	workProduced = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "workqueue_produced_total",
+		Help:      "Messages produced on the work queue.",
+	})
+	workConsumed = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "samplebox",
+		Name:      "workqueue_consumed_total",
+		Help:      "Messages consumed from the work queue, by the background consumer or through /queue/consume.",
+	}, []string{"consumer"})
+	workDepth = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "workqueue_depth",
+		Help:      "Messages waiting in the work queue.",
+	}, func() float64 {
+		workMu.Lock()
+		defer workMu.Unlock()
+		return float64(len(workMessages))
+	})
+	workOldestAge = promauto.With(Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "samplebox",
+		Name:      "workqueue_oldest_message_age_seconds",
+		Help:      "Age of the oldest message waiting in the work queue.",
+	}, func() float64 {
+		workMu.Lock()
+		defer workMu.Unlock()
+		if len(workMessages) == 0 {
+			return 0
+		}
+		return time.Since(workMessages[0].Produced).Seconds()
+	})
+)
+
+// take up to n messages from the head of the queue
+func consumeWork(n int, consumer string) ([]WorkMessage, int) {
+	workMu.Lock()
+	defer workMu.Unlock()
+	n = min(n, len(workMessages))
+	consumed := append([]WorkMessage(nil), workMessages[:n]...)
+	workMessages = workMessages[n:]
+	workConsumed.WithLabelValues(consumer).Add(float64(n))
+	return consumed, len(workMessages)
+}
+
+// StartWorkConsumer consumes rate messages per second in the background, 0 disables it
+func StartWorkConsumer(rate float64) error {
+	if rate == 0 {
+		return nil
+	}
+	if !(rate >= minWorkConsumeRate && rate <= maxWorkConsumeRate) {
+		return fmt.Errorf("invalid work queue consume rate %v, it must be 0 or between %v and %v messages per second", rate, minWorkConsumeRate, maxWorkConsumeRate)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		for range ticker.C {
+			consumeWork(1, "background")
+		}
+	}()
+	return nil
+}
+
+// WorkProduceHandler appends the request body as a message, count times
+// (default 1), and answers 503 when the queue cannot hold them
+func WorkProduceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	count, err := queryInt(r, "count", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if count < 1 || count > 100000 {
+		http.Error(w, "count must be between 1 and 100000.", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWorkMessage))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	message := WorkMessage{Body: string(body), Produced: time.Now()}
+	workMu.Lock()
+	if len(workMessages)+count > maxWorkMessages {
+		workMu.Unlock()
+		http.Error(w, "Work queue is full.", http.StatusServiceUnavailable)
+		return
+	}
+	for i := 0; i < count; i++ {
+		workMessages = append(workMessages, message)
+	}
+	depth := len(workMessages)
+	workMu.Unlock()
+	workProduced.Add(float64(count))
+
+	writeJSON(w, http.StatusAccepted, WorkQueueResponse{Depth: depth})
+}
+
+// WorkConsumeHandler takes count messages (default 1) from the queue, 204 when it is empty
+func WorkConsumeHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := queryInt(r, "count", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if count < 1 {
+		http.Error(w, "count must be at least 1.", http.StatusBadRequest)
+		return
+	}
+
+	messages, depth := consumeWork(count, "http")
+	if len(messages) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for i := range messages {
+		messages[i].Produced = Skew(messages[i].Produced)
+	}
+	writeJSON(w, http.StatusOK, WorkQueueResponse{Messages: messages, Depth: depth})
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStartWorkConsumerRate(t *testing.T) {
+	for _, rate := range []float64{1e10, math.Inf(1), math.NaN(), 1e-11, -1} {
+		if err := StartWorkConsumer(rate); err == nil {
+			t.Errorf("rate %v was accepted", rate)
+		}
+	}
+	if err := StartWorkConsumer(0); err != nil {
+		t.Errorf("rate 0 was rejected: %v", err)
+	}
+}
+
+func TestWorkProduceHandlerLimit(t *testing.T) {
+	defer consumeWork(maxWorkMessages, "test")
+	w := httptest.NewRecorder()
+	WorkProduceHandler(w, httptest.NewRequest("POST", "/queue/produce?count=100000", strings.NewReader("m")))
+	if w.Code != 202 {
+		t.Fatalf("got status %d, want 202", w.Code)
+	}
+	w = httptest.NewRecorder()
+	WorkProduceHandler(w, httptest.NewRequest("POST", "/queue/produce", strings.NewReader("m")))
+	if w.Code != 503 {
+		t.Errorf("got status %d for a full queue, want 503", w.Code)
+	}
+}
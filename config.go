@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crlsmrls/dummybox/cmd"
+)
+
+// config holds the settings given as command line flags, each flag falls back
+// to an environment variable prefixed with DUMMYBOX_
+type config struct {
+	instanceName     string
+	instanceColor    string
+	labels           map[string]string
+	zone             string
+	region           string
+	node             string
+	listen           cmd.ListenSettings
+	server           cmd.ServerSettings
+	connections      cmd.ConnectionSettings
+	queueWorkers     int
+	queueSize        int
+	backpressure     cmd.BackpressureSettings
+	breaker          cmd.BreakerSettings
+	rateLimitHeaders string
+	slo              cmd.SLOSettings
+	businessMetrics  bool
+	businessOrders   float64
+	workConsumeRate  float64
+	grpcPort         int
+	tcpPort          int
+	tcpMode          string
+	mirror           cmd.MirrorSettings
+	cache            cmd.CacheSettings
+	outbound         cmd.OutboundSettings
+	clock            cmd.ClockSettings
+	seed             int64
+	startupDelay     time.Duration
+	metricsBuckets   []float64
+	statsd           cmd.StatsDSettings
+	pushgateway      cmd.PushgatewaySettings
+	authToken        string
+	profiling        cmd.ProfileSettings
+	kubeIntrospect   bool
+	peers            cmd.PeerSettings
+	leader           cmd.LeaderSettings
+	recordRequests   int
+	kv               cmd.KVSettings
+	jwt              cmd.JWTSettings
+	signature        cmd.SignatureSettings
+	rateLimit        cmd.RateLimitSettings
+	concurrency      cmd.ConcurrencySettings
+	responseRate     cmd.ResponseRateSettings
+	cors             cmd.CORSSettings
+	compression      cmd.CompressionSettings
+	file             fileConfig
+}
+
+// fileConfig holds the settings that are too structured for flags, loaded
+// from the JSON file given with --config
+type fileConfig struct {
+	Hosts       []cmd.HostRule       `json:"hosts"`
+	Canary      []cmd.CanaryRule     `json:"canary"`
+	Bulkheads   []cmd.Bulkhead       `json:"bulkheads"`
+	Respond     []cmd.RespondRule    `json:"respond"`
+	Latency     *cmd.LatencyProfile  `json:"latency_profile"`
+	Probes      []cmd.Probe          `json:"probes"`
+	EgressSuite []cmd.EgressCheck    `json:"egress_suite"`
+	Mocks       []cmd.Mock           `json:"mocks"`
+	Scenario    *cmd.Scenario        `json:"scenario"`
+	Schedule    []cmd.ScheduledTask  `json:"schedule"`
+	OIDCClients []cmd.OIDCClient     `json:"oidc_clients"`
+	AuthTokens  []cmd.AuthToken      `json:"auth_tokens"`
+	IPFilter    cmd.IPFilterSettings `json:"ip_filter"`
+	Security    cmd.SecurityHeaders  `json:"security_headers"`
+}
+
+func loadConfig() (*config, error) {
+	hostname, _ := os.Hostname()
+
+	c := &config{}
+	flag.StringVar(&c.instanceName, "instance-name", envString("INSTANCE_NAME", hostname), "name of this instance shown in pages, responses and logs")
+	flag.StringVar(&c.instanceColor, "instance-color", envString("INSTANCE_COLOR", "#3b82f6"), "color used to theme the HTML pages")
+	flag.StringVar(&c.zone, "zone", envString("ZONE", ""), "topology zone reported in response headers and logs")
+	flag.StringVar(&c.region, "region", envString("REGION", ""), "topology region reported in response headers and logs")
+	flag.StringVar(&c.node, "node", envString("NODE", ""), "node the instance runs on, reported in responses, logs and to the peers")
+	labels := flag.String("labels", envString("LABELS", ""), "comma separated list of key=value labels")
+	listen := flag.String("listen", envString("LISTEN", ":8080"), "comma separated list of host:port addresses of the HTTP server, the host may be an IP, a network interface name or empty for all addresses")
+	flag.StringVar(&c.listen.Family, "ip-family", envString("IP_FAMILY", "dual"), "IP family of the HTTP server listeners: ipv4, ipv6 or dual")
+	readHeaderTimeout := flag.Duration("read-header-timeout", envDuration("READ_HEADER_TIMEOUT", 10*time.Second), "time allowed to read the request headers, 0 disables the limit")
+	readTimeout := flag.Duration("read-timeout", envDuration("READ_TIMEOUT", 0), "time allowed to read the whole request, 0 disables the limit")
+	idleTimeout := flag.Duration("idle-timeout", envDuration("IDLE_TIMEOUT", 120*time.Second), "time a keep-alive connection may stay idle")
+	flag.IntVar(&c.server.MaxHeaderBytes, "max-header-bytes", envInt("MAX_HEADER_BYTES", 1<<20), "maximum size of the request headers")
+	flag.BoolVar(&c.connections.ForceClose, "connection-close", envBool("CONNECTION_CLOSE", false), "answer every request with Connection: close")
+	flag.IntVar(&c.connections.MaxRequestsPerConn, "max-requests-per-conn", envInt("MAX_REQUESTS_PER_CONN", 0), "close connections after this many requests, 0 means unlimited")
+	flag.Float64Var(&c.connections.IdleCloseRatio, "idle-close-ratio", envFloat("IDLE_CLOSE_RATIO", 0), "probability (0-1) of closing a keep-alive connection when it becomes idle")
+	flag.IntVar(&c.queueWorkers, "queue-workers", envInt("QUEUE_WORKERS", 4), "number of workers processing /queue requests")
+	flag.IntVar(&c.queueSize, "queue-size", envInt("QUEUE_SIZE", 16), "number of /queue requests waiting for a worker before rejecting new ones")
+	flag.Float64Var(&c.backpressure.Capacity, "backpressure-capacity", envFloat("BACKPRESSURE_CAPACITY", 10), "number of /backpressure requests accepted in a burst")
+	flag.Float64Var(&c.backpressure.Rate, "backpressure-rate", envFloat("BACKPRESSURE_RATE", 1), "number of /backpressure requests accepted per second once the burst is used")
+	flag.IntVar(&c.breaker.Threshold, "breaker-threshold", envInt("BREAKER_THRESHOLD", 5), "consecutive /breaker failures opening the circuit breaker")
+	breakerCooldown := flag.Duration("breaker-cooldown", envDuration("BREAKER_COOLDOWN", 10*time.Second), "time the circuit breaker stays open before a trial request")
+	flag.StringVar(&c.rateLimitHeaders, "ratelimit-headers", envString("RATELIMIT_HEADERS", "draft"), "rate limit headers sent by rate limited endpoints: draft, structured, legacy or none")
+	flag.Float64Var(&c.slo.Target, "slo-target", envFloat("SLO_TARGET", 99.5), "success ratio in percent maintained by /slo")
+	sloWindow := flag.Duration("slo-window", envDuration("SLO_WINDOW", 5*time.Minute), "rolling window the /slo success ratio is measured over")
+	sloPaths := flag.String("slo-paths", envString("SLO_PATHS", ""), "comma separated paths, and the paths below them, sharing the error budget of /slo, * for all")
+	flag.BoolVar(&c.businessMetrics, "business-metrics", envBool("BUSINESS_METRICS", false), "export wandering fake business metrics")
+	flag.Float64Var(&c.businessOrders, "business-orders-rate", envFloat("BUSINESS_ORDERS_RATE", 5), "average fake orders per second")
+	flag.Float64Var(&c.workConsumeRate, "workqueue-consume-rate", envFloat("WORKQUEUE_CONSUME_RATE", 1), "messages per second consumed from the work queue in the background, 0 disables it")
+	flag.IntVar(&c.grpcPort, "grpc-port", envInt("GRPC_PORT", 0), "port of the gRPC echo server with reflection, 0 disables it")
+	flag.IntVar(&c.tcpPort, "tcp-port", envInt("TCP_PORT", 0), "port of the raw TCP server, 0 disables it")
+	flag.StringVar(&c.tcpMode, "tcp-mode", envString("TCP_MODE", "echo"), "mode of the raw TCP server: echo, discard or chargen")
+	flag.StringVar(&c.mirror.URL, "mirror-url", envString("MIRROR_URL", ""), "base URL incoming requests are mirrored to, empty disables mirroring")
+	flag.Float64Var(&c.mirror.Percent, "mirror-percent", envFloat("MIRROR_PERCENT", 100), "percentage of the incoming requests mirrored")
+	cacheOriginLatency := flag.Duration("cache-origin-latency", envDuration("CACHE_ORIGIN_LATENCY", 500*time.Millisecond), "latency of the slow origin behind /cached")
+	cacheTTL := flag.Duration("cache-ttl", envDuration("CACHE_TTL", 30*time.Second), "time /cached entries are served from the cache")
+	flag.BoolVar(&c.cache.SingleFlight, "cache-singleflight", envBool("CACHE_SINGLEFLIGHT", false), "coalesce concurrent /cached misses of a key into a single origin call")
+	hostOverrides := flag.String("host-overrides", envString("HOST_OVERRIDES", ""), "comma separated list of host=ip overrides used by the outbound requests")
+	dnsServers := flag.String("dns-servers", envString("DNS_SERVERS", ""), "comma separated list of DNS servers used by the outbound requests")
+	clockOffset := flag.Duration("clock-offset", envDuration("CLOCK_OFFSET", 0), "offset added to every timestamp written in logs and responses")
+	clockDrift := flag.Duration("clock-drift", envDuration("CLOCK_DRIFT", 0), "additional offset the written timestamps gain every hour")
+	flag.DurationVar(&c.startupDelay, "startup-delay", envDuration("STARTUP_DELAY", 0), "time /startupz and /readyz report the server as not started, while it already accepts connections")
+	flag.Int64Var(&c.seed, "seed", envInt64("SEED", 0), "seed of every randomized behavior, 0 seeds from the clock")
+	metricsBuckets := flag.String("metrics-buckets", envString("METRICS_BUCKETS", "0.1,0.15,0.2,0.25,0.3"), "comma separated list of the upper bounds in seconds of the request duration histogram buckets")
+	flag.StringVar(&c.statsd.Addr, "statsd-addr", envString("STATSD_ADDR", ""), "host:port of a StatsD or DogStatsD agent the metrics are mirrored to, empty disables it")
+	statsdInterval := flag.Duration("statsd-interval", envDuration("STATSD_INTERVAL", 10*time.Second), "time between two sends of the metrics to the StatsD agent")
+	flag.StringVar(&c.statsd.Format, "statsd-format", envString("STATSD_FORMAT", "dogstatsd"), "StatsD dialect: dogstatsd sends labels as tags, statsd appends their values to the metric name")
+	flag.StringVar(&c.pushgateway.URL, "pushgateway-url", envString("PUSHGATEWAY_URL", ""), "base URL of a Prometheus Pushgateway the metrics are pushed to on shutdown, empty disables it")
+	flag.StringVar(&c.pushgateway.Job, "pushgateway-job", envString("PUSHGATEWAY_JOB", "dummybox"), "job label of the metrics pushed to the Pushgateway")
+	pushgatewayInterval := flag.Duration("pushgateway-interval", envDuration("PUSHGATEWAY_INTERVAL", 0), "time between two pushes to the Pushgateway, 0 only pushes on shutdown")
+	flag.StringVar(&c.authToken, "auth-token", envString("AUTH_TOKEN", ""), "token allowed on every protected endpoint (/debug, /cpu, /memory, /signal, /panic, /chaos...) in the X-Auth-Token header, along with the auth_tokens of the config file; none leaves them open")
+	flag.IntVar(&c.profiling.BlockRate, "profile-block-rate", envInt("PROFILE_BLOCK_RATE", 0), "nanoseconds spent blocked per event sampled by the block profile, 0 disables it")
+	flag.IntVar(&c.profiling.MutexFraction, "profile-mutex-fraction", envInt("PROFILE_MUTEX_FRACTION", 0), "one out of this many mutex contention events is sampled by the mutex profile, 0 disables it")
+	flag.BoolVar(&c.kubeIntrospect, "kube-introspect", envBool("KUBE_INTROSPECT", false), "report the own Pod object and its sibling replicas in /info, read from the Kubernetes API with the pod service account")
+	peers := flag.String("peers", envString("PEERS", ""), "comma separated list of host:port of the other dummybox replicas")
+	flag.StringVar(&c.peers.DNS, "peers-dns", envString("PEERS_DNS", ""), "host:port where the host resolves to every replica, such as a headless Service")
+	peersInterval := flag.Duration("peers-interval", envDuration("PEERS_INTERVAL", 0), "time between two background latency measurements of the peers, 0 disables them")
+	flag.StringVar(&c.leader.Lease, "leader-elect-lease", envString("LEADER_ELECT_LEASE", ""), "name of the Kubernetes Lease the replicas compete for, empty disables the leader election")
+	leaderDuration := flag.Duration("leader-elect-duration", envDuration("LEADER_ELECT_DURATION", 15*time.Second), "time the lease stays valid without renewal")
+	flag.IntVar(&c.recordRequests, "record-requests", envInt("RECORD_REQUESTS", 100), "number of the last requests received kept for /recorded, 0 disables the recording")
+	flag.Int64Var(&c.kv.MaxValueBytes, "kv-max-value-bytes", envInt64("KV_MAX_VALUE_BYTES", 1<<20), "largest value stored by /kv")
+	flag.Int64Var(&c.kv.MaxBytes, "kv-max-bytes", envInt64("KV_MAX_BYTES", 64<<20), "bytes the values of /kv may hold in total")
+	flag.StringVar(&c.jwt.Secret, "jwt-secret", envString("JWT_SECRET", ""), "HMAC secret verifying the HS256, HS384 and HS512 tokens of /auth/jwt")
+	flag.StringVar(&c.jwt.MintSecret, "jwt-mint-secret", envString("JWT_MINT_SECRET", ""), "HMAC secret signing the HS256, HS384 and HS512 tokens of /token, empty disables them")
+	flag.StringVar(&c.jwt.JWKSURL, "jwt-jwks-url", envString("JWT_JWKS_URL", ""), "URL of the JSON Web Key Set verifying the RSA and ECDSA tokens of /auth/jwt")
+	flag.StringVar(&c.jwt.Issuer, "jwt-issuer", envString("JWT_ISSUER", ""), "issuer the tokens of /auth/jwt must have, empty accepts any, and of the tokens of /token")
+	flag.StringVar(&c.jwt.Audience, "jwt-audience", envString("JWT_AUDIENCE", ""), "audience the tokens of /auth/jwt must have, empty accepts any, and of the tokens of /token")
+	flag.StringVar(&c.jwt.SigningKey, "jwt-signing-key", envString("JWT_SIGNING_KEY", ""), "PEM file of the RSA private key signing the tokens of /token, generated at first use when empty")
+	flag.StringVar(&c.signature.Secret, "signature-secret", envString("SIGNATURE_SECRET", ""), "shared secret of the HMAC signature the requests to the signed paths must carry, empty disables the verification")
+	flag.StringVar(&c.signature.Algorithm, "signature-algorithm", envString("SIGNATURE_ALGORITHM", "sha256"), "hash of the HMAC signature: sha1, sha256 or sha512")
+	flag.StringVar(&c.signature.Header, "signature-header", envString("SIGNATURE_HEADER", "X-Signature"), "header carrying the HMAC signature of the request")
+	flag.StringVar(&c.signature.TimestampHeader, "signature-timestamp-header", envString("SIGNATURE_TIMESTAMP_HEADER", "X-Signature-Timestamp"), "header carrying the Unix time the request was signed at")
+	signatureTolerance := flag.Duration("signature-tolerance", envDuration("SIGNATURE_TOLERANCE", 5*time.Minute), "time the signature timestamp may be away from now")
+	signaturePaths := flag.String("signature-paths", envString("SIGNATURE_PATHS", "/cpu,/memory,/signal,/panic,/chaos,/latency,/scenario,/schedule,/mocks,/canary"), "comma separated paths, and the paths below them, whose requests must be signed")
+	flag.Float64Var(&c.rateLimit.Rate, "rate-limit", envFloat("RATE_LIMIT", 0), "requests per second accepted per rate limit key, 0 disables the rate limiting")
+	flag.Float64Var(&c.rateLimit.Burst, "rate-limit-burst", envFloat("RATE_LIMIT_BURST", 0), "requests accepted in a burst per rate limit key, the rate when 0")
+	flag.StringVar(&c.rateLimit.Key, "rate-limit-key", envString("RATE_LIMIT_KEY", "ip"), "what the rate limit applies to: ip (client IP), token (auth token) or global")
+	rateLimitExclude := flag.String("rate-limit-exclude", envString("RATE_LIMIT_EXCLUDE", "/healthz,/readyz,/startupz,/metrics"), "comma separated paths, and the paths below them, never rate limited")
+	flag.IntVar(&c.concurrency.MaxInFlight, "max-in-flight", envInt("MAX_IN_FLIGHT", 0), "requests served at the same time, the next ones wait in the queue; 0 disables the limit")
+	flag.IntVar(&c.concurrency.QueueSize, "max-in-flight-queue", envInt("MAX_IN_FLIGHT_QUEUE", 0), "requests waiting for a slot of the in-flight limit before rejecting new ones with 503")
+	maxInFlightTimeout := flag.Duration("max-in-flight-queue-timeout", envDuration("MAX_IN_FLIGHT_QUEUE_TIMEOUT", 10*time.Second), "longest wait for a slot of the in-flight limit before 503, 0 waits as long as the client")
+	maxInFlightExclude := flag.String("max-in-flight-exclude", envString("MAX_IN_FLIGHT_EXCLUDE", "/healthz,/readyz,/startupz,/metrics"), "comma separated paths, and the paths below them, never held by the in-flight limit")
+	flag.StringVar(&c.responseRate.Rate, "response-rate", envString("RESPONSE_RATE", ""), "bytes per second every response body is written at, such as 64KB, empty leaves them unthrottled")
+	responseRateExclude := flag.String("response-rate-exclude", envString("RESPONSE_RATE_EXCLUDE", "/healthz,/readyz,/startupz,/metrics"), "comma separated paths, and the paths below them, never throttled by the response rate")
+	corsOrigins := flag.String("cors-origins", envString("CORS_ORIGINS", ""), "comma separated origins allowed to call cross-origin, * for any or *.example.com for the subdomains; empty disables CORS")
+	corsMethods := flag.String("cors-methods", envString("CORS_METHODS", "GET,POST,PUT,PATCH,DELETE,HEAD,OPTIONS"), "comma separated methods allowed cross-origin")
+	corsHeaders := flag.String("cors-headers", envString("CORS_HEADERS", ""), "comma separated request headers allowed cross-origin, empty allows the ones the preflight asks for")
+	corsExposeHeaders := flag.String("cors-expose-headers", envString("CORS_EXPOSE_HEADERS", ""), "comma separated response headers readable cross-origin")
+	flag.BoolVar(&c.cors.Credentials, "cors-credentials", envBool("CORS_CREDENTIALS", false), "allow the cross-origin requests with credentials, cookies and auth headers")
+	corsMaxAge := flag.Duration("cors-max-age", envDuration("CORS_MAX_AGE", 10*time.Minute), "time the browsers cache a preflight answer")
+	compressionEncodings := flag.String("compression", envString("COMPRESSION", ""), "comma separated encodings (gzip or deflate) the response bodies are compressed with, in order of preference; empty disables compression")
+	flag.StringVar(&c.compression.MinSize, "compression-min-size", envString("COMPRESSION_MIN_SIZE", "1KB"), "size from which the response bodies are compressed, such as 512 or 1KB")
+	configFile := flag.String("config", envString("CONFIG", ""), "path to a JSON config file")
+	flag.Parse()
+
+	c.server.ReadHeaderTimeout = cmd.Duration(*readHeaderTimeout)
+	c.server.ReadTimeout = cmd.Duration(*readTimeout)
+	c.server.IdleTimeout = cmd.Duration(*idleTimeout)
+	c.breaker.Cooldown = cmd.Duration(*breakerCooldown)
+	c.slo.Window = cmd.Duration(*sloWindow)
+	c.slo.Paths = cmd.SplitList(*sloPaths)
+	c.cache.OriginLatency = cmd.Duration(*cacheOriginLatency)
+	c.cache.TTL = cmd.Duration(*cacheTTL)
+	c.clock.Offset = cmd.Duration(*clockOffset)
+	c.clock.Drift = cmd.Duration(*clockDrift)
+	c.statsd.Interval = cmd.Duration(*statsdInterval)
+	c.pushgateway.Interval = cmd.Duration(*pushgatewayInterval)
+	c.peers.Interval = cmd.Duration(*peersInterval)
+	c.leader.Duration = cmd.Duration(*leaderDuration)
+	c.concurrency.QueueTimeout = cmd.Duration(*maxInFlightTimeout)
+	c.cors.MaxAge = cmd.Duration(*corsMaxAge)
+
+	var err error
+	if c.labels, err = parseLabels(*labels); err != nil {
+		return nil, err
+	}
+	if c.outbound.HostOverrides, err = parseLabels(*hostOverrides); err != nil {
+		return nil, err
+	}
+	c.outbound.DNSServers = cmd.SplitList(*dnsServers)
+	c.listen.Addresses = cmd.SplitList(*listen)
+	c.peers.Static = cmd.SplitList(*peers)
+	c.signature.Paths = cmd.SplitList(*signaturePaths)
+	c.signature.Tolerance = cmd.Duration(*signatureTolerance)
+	c.rateLimit.Exclude = cmd.SplitList(*rateLimitExclude)
+	c.concurrency.Exclude = cmd.SplitList(*maxInFlightExclude)
+	c.responseRate.Exclude = cmd.SplitList(*responseRateExclude)
+	c.cors.Origins = cmd.SplitList(*corsOrigins)
+	c.cors.Methods = cmd.SplitList(*corsMethods)
+	c.cors.Headers = cmd.SplitList(*corsHeaders)
+	c.cors.ExposeHeaders = cmd.SplitList(*corsExposeHeaders)
+	c.compression.Encodings = cmd.SplitList(*compressionEncodings)
+	if c.metricsBuckets, err = parseBuckets(*metricsBuckets); err != nil {
+		return nil, err
+	}
+	switch c.rateLimitHeaders {
+	case "draft", "structured", "legacy", "none":
+	default:
+		return nil, fmt.Errorf("invalid ratelimit headers %q, expected draft, structured, legacy or none", c.rateLimitHeaders)
+	}
+	if c.slo.Target < 0 || c.slo.Target > 100 {
+		return nil, fmt.Errorf("invalid slo target %v, it must be between 0 and 100", c.slo.Target)
+	}
+	if c.concurrency.MaxInFlight < 0 || c.concurrency.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid max in flight %d or queue %d, they must not be negative", c.concurrency.MaxInFlight, c.concurrency.QueueSize)
+	}
+	if c.recordRequests < 0 {
+		return nil, fmt.Errorf("invalid record requests %d, it must not be negative", c.recordRequests)
+	}
+	if c.backpressure.Rate <= 0 {
+		return nil, fmt.Errorf("invalid backpressure rate %v, it must be greater than 0", c.backpressure.Rate)
+	}
+	if *configFile != "" {
+		if err := readConfigFile(*configFile, &c.file); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func readConfigFile(path string, fc *fileConfig) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(fc); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// get the value of the DUMMYBOX_ prefixed environment variable or the default
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv("DUMMYBOX_" + key); ok {
+		return v
+	}
+	return def
+}
+
+// get the DUMMYBOX_ prefixed environment variable as an integer, or the default
+// when it is not set or not a valid integer
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(envString(key, "")); err == nil {
+		return n
+	}
+	return def
+}
+
+// get the DUMMYBOX_ prefixed environment variable as a 64 bit integer, or the
+// default when it is not set or not a valid integer
+func envInt64(key string, def int64) int64 {
+	if n, err := strconv.ParseInt(envString(key, ""), 10, 64); err == nil {
+		return n
+	}
+	return def
+}
+
+// get the DUMMYBOX_ prefixed environment variable as a float, or the default
+// when it is not set or not a valid number
+func envFloat(key string, def float64) float64 {
+	if f, err := strconv.ParseFloat(envString(key, ""), 64); err == nil {
+		return f
+	}
+	return def
+}
+
+// get the DUMMYBOX_ prefixed environment variable as a boolean, or the default
+// when it is not set or not a valid boolean
+func envBool(key string, def bool) bool {
+	if b, err := strconv.ParseBool(envString(key, "")); err == nil {
+		return b
+	}
+	return def
+}
+
+// get the DUMMYBOX_ prefixed environment variable as a duration, or the
+// default when it is not set or not a valid duration
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(envString(key, "")); err == nil {
+		return d
+	}
+	return def
+}
+
+// parse a comma separated list of increasing histogram bucket bounds
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, item := range cmd.SplitList(s) {
+		b, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics bucket %q, expected a number of seconds", item)
+		}
+		if len(buckets) > 0 && b <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("invalid metrics buckets %q, they must be increasing", s)
+		}
+		buckets = append(buckets, b)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("invalid metrics buckets %q, at least one is required", s)
+	}
+	return buckets, nil
+}
+
+// parse "key1=value1,key2=value2" into a map
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
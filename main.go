@@ -1,27 +1,362 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/crlsmrls/dummybox/cmd"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// get version from ENV variable VERSION
-var Version = "development"
+// get version from ENV variable VERSION, build date and git commit are
+// injected at build time as well
+var (
+	Version   = "development"
+	BuildDate = ""
+	GitCommit = ""
+)
 
 func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmd.SetClock(cfg.clock)
+	cmd.SetSeed(cfg.seed)
+	cmd.SetStartupDelay(cfg.startupDelay)
+	cmd.SetProfiling(cfg.profiling)
 	cmd.Version = Version
+	cmd.BuildDate = BuildDate
+	cmd.GitCommit = GitCommit
+	cmd.ResolveBuildInfo()
+	cmd.Instance = cmd.InstanceInfo{
+		Name:   cfg.instanceName,
+		Color:  cfg.instanceColor,
+		Labels: cfg.labels,
+		Zone:   cfg.zone,
+		Region: cfg.region,
+		Node:   cfg.node,
+	}
+	if err := cmd.SetHostRules(cfg.file.Hosts); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetCanaryRules(cfg.file.Canary); err != nil {
+		log.Fatal(err)
+	}
+	cmd.Server = cfg.server
+	cmd.Connections = cfg.connections
+	if err := cmd.StartWorkerPool(cfg.queueWorkers, cfg.queueSize); err != nil {
+		log.Fatal(err)
+	}
+	cmd.RateLimitHeaders = cfg.rateLimitHeaders
+	cmd.SetRecording(cfg.recordRequests)
+	cmd.SetKV(cfg.kv)
+	cmd.SetBackpressure(cfg.backpressure)
+	cmd.SetConcurrencyLimit(cfg.concurrency)
+	cmd.SetCORS(cfg.cors)
+	cmd.SetSecurityHeaders(cfg.file.Security)
+	cmd.SetBreaker(cfg.breaker)
+	cmd.SetSLO(cfg.slo)
+	cmd.SetCache(cfg.cache)
+	if err := cmd.SetOutbound(cfg.outbound); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetMirror(cfg.mirror); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetBulkheads(cfg.file.Bulkheads); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetRespondRules(cfg.file.Respond); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetLatencyProfile(cfg.file.Latency); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetEgressSuite(cfg.file.EgressSuite); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetJWT(cfg.jwt); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetResponseRate(cfg.responseRate); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetCompression(cfg.compression); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetRateLimit(cfg.rateLimit); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetSignature(cfg.signature); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetIPFilter(cfg.file.IPFilter); err != nil {
+		log.Fatal(err)
+	}
+	authTokens := cfg.file.AuthTokens
+	if cfg.authToken != "" {
+		// the token of the flag is allowed on every protected endpoint
+		authTokens = append(authTokens, cmd.AuthToken{Name: "auth-token", Token: cfg.authToken, Scopes: []string{"*"}})
+	}
+	if err := cmd.SetAuthTokens(authTokens); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetOIDCClients(cfg.file.OIDCClients); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetMocks(cfg.file.Mocks); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.SetKubeIntrospect(cfg.kubeIntrospect); err != nil {
+		log.Fatal(err)
+	}
+
+	// every log line carries the instance identity
+	logAttrs := []any{"instance", cfg.instanceName, "version", cmd.Version}
+	if cfg.zone != "" {
+		logAttrs = append(logAttrs, "zone", cfg.zone)
+	}
+	if cfg.region != "" {
+		logAttrs = append(logAttrs, "region", cfg.region)
+	}
+	if cfg.node != "" {
+		logAttrs = append(logAttrs, "node", cfg.node)
+	}
+	for key, value := range cfg.labels {
+		logAttrs = append(logAttrs, key, value)
+	}
+	logOptions := &slog.HandlerOptions{
+		// log lines carry the skewed time
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				a.Value = slog.TimeValue(cmd.Skew(a.Value.Time()))
+			}
+			return a
+		},
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, logOptions)).With(logAttrs...))
+
+	m := NewMetrics(cmd.Registry, cfg.metricsBuckets)
+	m.info.WithLabelValues(cmd.Version).Set(1)
 
 	dMux := http.NewServeMux()
+	// the routes changing the state of the process or reaching other hosts
+	// require an auth token, when one is configured
+	protect := func(pattern string, handler http.HandlerFunc) {
+		dMux.Handle(pattern, cmd.TokenAuthMiddleware(handler))
+	}
 	dMux.HandleFunc("/positions", cmd.PositionsHandler)
 	dMux.HandleFunc("/version", cmd.VersionHandler)
 	dMux.HandleFunc("/info", cmd.InfoHandler)
+	dMux.HandleFunc("/lb", cmd.LBHandler)
+	dMux.HandleFunc("/session", cmd.SessionHandler)
+	dMux.HandleFunc("/cookies", cmd.CookiesHandler)
+	dMux.HandleFunc("/cors", cmd.CORSHandler)
+	protect("/headers/security", cmd.SecurityHeadersHandler)
+	dMux.HandleFunc("/cookies/set", cmd.CookiesSetHandler)
+	dMux.HandleFunc("/cookies/delete", cmd.CookiesDeleteHandler)
+	dMux.HandleFunc("/auth/basic/", cmd.BasicAuthHandler)
+	dMux.HandleFunc("/auth/digest/", cmd.DigestAuthHandler)
+	dMux.HandleFunc("/auth/jwt", cmd.JWTAuthHandler)
+	dMux.HandleFunc("/token", cmd.TokenHandler)
+	dMux.HandleFunc("/jwks", cmd.JWKSHandler)
+	dMux.HandleFunc("/.well-known/openid-configuration", cmd.OIDCConfigurationHandler)
+	dMux.HandleFunc("/authorize", cmd.AuthorizeHandler)
+	dMux.HandleFunc("/host", cmd.HostHandler)
+	protect("/canary", cmd.CanaryHandler)
+	dMux.HandleFunc("/payload", cmd.PayloadHandler)
+	dMux.HandleFunc("/compressed", cmd.CompressedHandler)
+	dMux.HandleFunc("/drip", cmd.DripHandler)
+	dMux.HandleFunc("/abort", cmd.AbortHandler)
+	dMux.HandleFunc("/stream/infinite", cmd.InfiniteStreamHandler)
+	dMux.HandleFunc("/slowloris", cmd.SlowlorisHandler)
+	dMux.HandleFunc("/malformed", cmd.MalformedHandler)
+	dMux.HandleFunc("/inflight", cmd.InflightHandler)
+	protect("/queue", cmd.QueueHandler)
+	protect("/queue/produce", cmd.WorkProduceHandler)
+	protect("/queue/consume", cmd.WorkConsumeHandler)
+	dMux.HandleFunc("/backpressure", cmd.BackpressureHandler)
+	protect("/breaker", cmd.BreakerHandler)
+	protect("/breaker/", cmd.BreakerAdminHandler)
+	dMux.HandleFunc("/bulkheads", cmd.BulkheadsHandler)
+	protect("/respond", cmd.RespondHandler)
+	protect("/respond/rules", cmd.RespondRulesHandler)
+	protect("/respond/sequences", cmd.SequencesHandler)
+	protect("/respond/sequences/", cmd.SequencesHandler)
+	protect("/respond/latency-profile", cmd.LatencyProfileHandler)
+	protect("/mocks", cmd.MocksHandler)
+	protect("/mocks/", cmd.MockHandler)
+	protect("/recorded", cmd.RecordedHandler)
+	protect("/counter", cmd.CounterHandler)
+	protect("/counter/", cmd.CounterHandler)
+	protect("/kv", cmd.KVHandler)
+	protect("/kv/", cmd.KVHandler)
+	dMux.HandleFunc("/status/", cmd.StatusHandler)
+	protect("/latency", cmd.GlobalLatencyHandler)
+	protect("/chaos", cmd.ChaosHandler)
+	protect("/scenario", cmd.ScenarioHandler)
+	protect("/schedule", cmd.ScheduleHandler)
+	protect("/schedule/", cmd.ScheduleHandler)
+	dMux.HandleFunc("/slo", cmd.SLOHandler)
+	dMux.HandleFunc("/probes", cmd.ProbesHandler)
+	protect("/probe/http", cmd.HTTPProbeHandler)
+	protect("/probe/tcp", cmd.TCPProbeHandler)
+	protect("/probe/udp", cmd.UDPProbeHandler)
+	protect("/probe/tls", cmd.TLSProbeHandler)
+	protect("/probe/suite", cmd.EgressSuiteHandler)
+	protect("/loadgen", cmd.LoadgenHandler)
+	protect("/loadgen/", cmd.LoadJobHandler)
+	protect("/proxy", cmd.ProxyHandler)
+	protect("/chain", cmd.ChainHandler)
+	protect("/callback", cmd.CallbackHandler)
+	protect("/callback/", cmd.CallbackJobHandler)
+	protect("/batch", cmd.BatchHandler)
+	protect("/batch/", cmd.BatchJobHandler)
+	protect("/cpu", cmd.CPUHandler)
+	protect("/cpu/jobs", cmd.CPUJobsHandler)
+	protect("/cpu/jobs/", cmd.CPUJobsHandler)
+	protect("/memory", cmd.MemoryHandler)
+	protect("/memory/allocations", cmd.MemoryAllocationsHandler)
+	protect("/memory/allocations/", cmd.MemoryAllocationsHandler)
+	protect("/ws/rooms/", cmd.RoomHandler)
+	dMux.HandleFunc("/stats/stream", cmd.StatsStreamHandler)
+	dMux.HandleFunc("/cached/", cmd.CachedHandler)
+	protect("/cache/", cmd.CacheHandler)
+	dMux.HandleFunc("/healthz", cmd.HealthzHandler)
+	dMux.HandleFunc("/readyz", cmd.ReadyzHandler)
+	dMux.HandleFunc("/startupz", cmd.StartupzHandler)
+	protect("/health", cmd.HealthHandler)
+	protect("/runtime", cmd.RuntimeHandler)
+	dMux.HandleFunc("/limits", cmd.LimitsHandler)
+	dMux.HandleFunc("/peers", cmd.PeersHandler)
+	dMux.HandleFunc("/leader", cmd.LeaderHandler)
+	protect("/replicas/call", cmd.ReplicasCallHandler)
+	protect("/panic", cmd.PanicHandler)
+	protect("/signal", cmd.SignalHandler)
+	protect("/metrics-gen", cmd.MetricsGenHandler)
+	protect("/metrics-gen/", cmd.MetricSetHandler)
+	protect("/selftest", cmd.SelftestHandler)
+	protect("/debug/pprof/", cmd.PprofHandler().ServeHTTP)
+	protect("/debug/heapdump", cmd.HeapDumpHandler)
+	protect("/debug/goroutines", cmd.GoroutinesHandler)
+	dMux.Handle("/metrics", promhttp.HandlerFor(cmd.Registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+
+	// the first middleware sees the request first
+	middlewares := []func(http.Handler) http.Handler{
+		m.Middleware(dMux),
+		cmd.RecoverMiddleware,
+		cmd.ConnectionMiddleware,
+		cmd.ClockMiddleware,
+		cmd.TopologyMiddleware,
+		cmd.CorrelationIDMiddleware,
+		cmd.SeedMiddleware,
+		cmd.InflightMiddleware,
+		cmd.RecordMiddleware,
+		cmd.CORSMiddleware,
+		cmd.SecurityHeadersMiddleware,
+		cmd.IPFilterMiddleware,
+		cmd.SLOMiddleware,
+		cmd.RateLimitMiddleware,
+		cmd.ConcurrencyLimitMiddleware,
+		cmd.ThrottleMiddleware,
+		cmd.CompressionMiddleware,
+		cmd.SignatureMiddleware,
+		cmd.MirrorMiddleware,
+		cmd.BulkheadMiddleware,
+		cmd.GlobalLatencyMiddleware,
+		cmd.ChaosMiddleware,
+		cmd.CanaryMiddleware,
+		cmd.MockMiddleware,
+	}
+	var handler http.Handler = dMux
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.server.ReadTimeout),
+		IdleTimeout:       time.Duration(cfg.server.IdleTimeout),
+		MaxHeaderBytes:    cfg.server.MaxHeaderBytes,
+		ConnContext:       cmd.ConnContext,
+		ConnState:         cmd.ConnState,
+	}
+
+	if err := cmd.StartProbers(cfg.file.Probes); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.grpcPort != 0 {
+		if err := cmd.StartGRPCServer(fmt.Sprintf(":%d", cfg.grpcPort)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.tcpPort != 0 {
+		if err := cmd.StartTCPServer(fmt.Sprintf(":%d", cfg.tcpPort), cfg.tcpMode); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.statsd.Addr != "" {
+		if err := cmd.StartStatsD(cfg.statsd); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := cmd.SetPeers(cfg.peers); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.leader.Lease != "" {
+		if err := cmd.StartLeaderElection(cfg.leader); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.pushgateway.URL != "" {
+		if err := cmd.StartPushgateway(cfg.pushgateway); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.file.Scenario != nil {
+		if err := cmd.StartScenario(*cfg.file.Scenario); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := cmd.AddScheduledTasks(cfg.file.Schedule); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.StartWorkConsumer(cfg.workConsumeRate); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.businessMetrics {
+		cmd.StartBusinessMetrics(cfg.businessOrders)
+	}
 
-	go func() {
-		log.Default().Println("Server running on port 8080")
-		log.Fatal(http.ListenAndServe(":8080", dMux))
-	}()
+	listeners, err := cmd.Listen(cfg.listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range listeners {
+		l := l
+		go func() {
+			log.Default().Printf("Server listening on %s", l.Addr())
+			log.Fatal(server.Serve(l))
+		}()
+	}
 
-	select {}
+	if cfg.pushgateway.URL == "" && cfg.statsd.Addr == "" {
+		select {}
+	}
+	// send the final values before exiting
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	log.Default().Printf("Received %v, sending metrics before exiting", sig)
+	cmd.StopStatsD()
+	cmd.PushMetrics()
 }
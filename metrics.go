@@ -1,16 +1,23 @@
 package main
 
 import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crlsmrls/dummybox/cmd"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 type metrics struct {
 	devices  prometheus.Gauge
 	info     *prometheus.GaugeVec
 	duration *prometheus.HistogramVec
+	requests *prometheus.CounterVec
 }
 
-func NewMetrics(reg prometheus.Registerer) *metrics {
+func NewMetrics(reg prometheus.Registerer, buckets []float64) *metrics {
 	m := &metrics{
 		devices: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: "samplebox",
@@ -27,12 +34,66 @@ func NewMetrics(reg prometheus.Registerer) *metrics {
 			Namespace: "samplebox",
 			Name:      "request_duration_seconds",
 			Help:      "Duration of the request.",
-			// 4 times larger for apdex score
-			// Buckets: prometheus.ExponentialBuckets(0.1, 1.5, 5),
-			// Buckets: prometheus.LinearBuckets(0.1, 5, 5),
-			Buckets: []float64{0.1, 0.15, 0.2, 0.25, 0.3},
-		}, []string{"status", "method"}),
+			Buckets:   buckets,
+		}, []string{"status", "method", "route"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "samplebox",
+			Name:      "requests_total",
+			Help:      "Requests served by route, method and status.",
+		}, []string{"status", "method", "route"}),
 	}
-	reg.MustRegister(m.devices, m.info)
+	reg.MustRegister(m.devices, m.info, m.duration, m.requests)
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	return m
 }
+
+// the methods labeled as they are, any other one is labeled "other"
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Middleware measures the requests per route, the pattern of the mux handling
+// the request rather than the raw path, so that path parameters, query
+// strings and made up methods do not explode the cardinality
+func (m *metrics) Middleware(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			method := r.Method
+			if !knownMethods[method] {
+				method = "other"
+			}
+			start := time.Now()
+			rec := &cmd.StatusRecorder{ResponseWriter: w}
+			returned := false
+			// measured as well when the handler aborts the response
+			defer func() {
+				// a handler writing nothing answers 200, one panicking before
+				// writing is answered 500 by the recovery
+				status := "200"
+				switch {
+				case rec.Hijacked:
+					status = "hijacked"
+				case rec.Status != 0:
+					status = strconv.Itoa(rec.Status)
+				case !returned:
+					status = "500"
+				}
+				// exemplars link the observation to the trace of the request
+				observer := m.duration.WithLabelValues(status, method, route)
+				if labels := cmd.ExemplarLabels(rec.Header()); len(labels) > 0 {
+					observer.(prometheus.ExemplarObserver).ObserveWithExemplar(time.Since(start).Seconds(), labels)
+				} else {
+					observer.Observe(time.Since(start).Seconds())
+				}
+				m.requests.WithLabelValues(status, method, route).Inc()
+			}()
+			next.ServeHTTP(rec, r)
+			returned = true
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareStatus(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry(), prometheus.DefBuckets)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	h := m.Middleware(mux)(mux)
+
+	for _, path := range []string{"/empty", "/teapot"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	}()
+
+	for _, tc := range []struct{ status, route string }{
+		{"200", "/empty"},
+		{"418", "/teapot"},
+		{"500", "/panic"},
+	} {
+		if got := testutil.ToFloat64(m.requests.WithLabelValues(tc.status, "GET", tc.route)); got != 1 {
+			t.Errorf("%s: got %v requests with status %s, want 1", tc.route, got, tc.status)
+		}
+	}
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("hijacked", "GET", "/empty")); got != 0 {
+		t.Errorf("/empty: got %v hijacked requests, want 0", got)
+	}
+}